@@ -0,0 +1,189 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"k8s.io/klog"
+
+	"github.com/GoogleCloudPlatform/gke-terraform-generator/pkg/api"
+	"github.com/GoogleCloudPlatform/gke-terraform-generator/pkg/ipam"
+	"github.com/GoogleCloudPlatform/gke-terraform-generator/pkg/overlay"
+)
+
+var (
+	// overlayFiles are patches that are applied to every cluster, in order.
+	overlayFiles []string
+	// printMerged determines whether each cluster is printed after the overlays
+	// and defaults are applied.
+	printMerged bool
+)
+
+// addOverlayFlags adds the flags that apply overlays to a command.
+func addOverlayFlags(command *cobra.Command) {
+	command.Flags().StringSliceVar(&overlayFiles, "overlay", nil, "overlay yaml file that patches every cluster, may be repeated")
+	command.Flags().BoolVar(&printMerged, "print-merged", false, "print each cluster after the overlays and defaults are applied")
+}
+
+// readClusters reads every cluster in configFile, which is either a YAML file
+// with one or more documents or a directory of YAML files.  It exits if no
+// cluster can be read.  Otherwise the clusters that were read are returned,
+// along with whether any file failed.
+func readClusters() ([]*api.Document, bool) {
+	documents, err := api.UnmarshalDocuments(configFile)
+	if err != nil {
+		klog.Errorf("Error unmarshaling the configuration file: %v", err)
+		if len(documents) == 0 {
+			exitWithError(err)
+		}
+		return documents, true
+	}
+	return documents, false
+}
+
+// readOverlays reads the patches of the overlay files.  It exits if an overlay
+// can not be read.
+func readOverlays() []*overlay.Patch {
+	patches, err := overlay.Load(overlayFiles)
+	if err != nil {
+		klog.Errorf("Error reading the overlays: %v", err)
+		exitWithError(err)
+	}
+	return patches
+}
+
+// prepareCluster applies the overlays, the project id, the defaults and the
+// planned network ranges to a cluster, prints the result to out when
+// --print-merged is set, and then validates it.  Validation errors are printed
+// to out.
+func prepareCluster(out io.Writer, document *api.Document, patches []*overlay.Patch) error {
+	gkeTF := document.GkeTF
+
+	if err := overlay.Apply(gkeTF, patches); err != nil {
+		klog.Errorf("Error applying overlays: %v", err)
+		return err
+	}
+
+	// set project id.  This will also override the value if it exists in the
+	// YAML file.
+	if projectID != "" {
+		gkeTF.Spec.ProjectId = projectID
+	}
+
+	if err := api.SetApiDefaultValues(gkeTF); err != nil {
+		klog.Errorf("Error setting api defaults: %v", err)
+		return err
+	}
+
+	// plan the network ranges that are empty when a supernet is set
+	if err := ipam.FillNetworkSpec(&gkeTF.Spec); err != nil {
+		klog.Errorf("Error planning network ranges: %v", err)
+		return err
+	}
+
+	if printMerged {
+		b, err := overlay.Marshal(redacted(gkeTF))
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(out, "---\n%s", b); err != nil {
+			return err
+		}
+	}
+
+	if err := api.ValidateYamlInput(gkeTF); err != nil {
+		printDiagnostics(out, document, err)
+		return fmt.Errorf("%s is not valid", document)
+	}
+	return nil
+}
+
+// redacted returns gkeTF without its secrets, the encryption key of a gcs backend, so that it
+// can be printed.  gkeTF itself is not changed.
+func redacted(gkeTF *api.GkeTF) *api.GkeTF {
+	backend := gkeTF.Spec.Backend
+	if backend == nil || backend.GCS == nil || backend.GCS.EncryptionKey == "" {
+		return gkeTF
+	}
+	gcs := *backend.GCS
+	gcs.EncryptionKey = "REDACTED"
+	redactedBackend := *backend
+	redactedBackend.GCS = &gcs
+	redactedTF := *gkeTF
+	redactedTF.Spec.Backend = &redactedBackend
+	return &redactedTF
+}
+
+// clusterFailures collects the errors of each cluster, so that every cluster
+// is processed before gke-tf exits.
+type clusterFailures struct {
+	total    int
+	failures []string
+}
+
+// add records the error of a cluster, if there is one.
+func (c *clusterFailures) add(name string, err error) {
+	c.total++
+	if err != nil {
+		c.failures = append(c.failures, fmt.Sprintf("%s: %v", name, err))
+	}
+}
+
+// err returns an error that lists every cluster that failed, or nil.
+func (c *clusterFailures) err() error {
+	if len(c.failures) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d of %d clusters failed:\n%s", len(c.failures), c.total, indent(strings.Join(c.failures, "\n")))
+}
+
+// printDiagnostics writes an error, such as the one returned by
+// api.ValidateYamlInput, to out. Diagnostics are printed one per line, prefixed
+// with file:line:column when the field can be found in the file.
+func printDiagnostics(out io.Writer, document *api.Document, err error) {
+	file := document.File
+	diags, ok := err.(api.Diagnostics)
+	if !ok {
+		fmt.Fprintf(out, "%s: %v\n", file, err)
+		return
+	}
+
+	source, err := ioutil.ReadFile(file)
+	if err == nil {
+		err = diags.LocateDocument(source, document.Index)
+	}
+	if err != nil {
+		klog.Warningf("Unable to locate validation errors in %s: %v", file, err)
+	}
+	for _, d := range diags {
+		if d.Line > 0 {
+			fmt.Fprintf(out, "%s:%d:%d: %s\n", file, d.Line, d.Column, d)
+		} else {
+			fmt.Fprintf(out, "%s: %s\n", file, d)
+		}
+	}
+}
+
+// indent prefixes every line of s with two spaces.
+func indent(s string) string {
+	return "  " + strings.Replace(s, "\n", "\n  ", -1)
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/GoogleCloudPlatform/gke-terraform-generator/pkg/api"
+	"github.com/GoogleCloudPlatform/gke-terraform-generator/pkg/overlay"
+)
+
+func TestPrepareClusterPrintMerged(t *testing.T) {
+	key := "MTIzNDU2Nzg5MDEyMzQ1Njc4OTAxMjM0NTY3ODkwMTI="
+	dir, err := ioutil.TempDir("", "gke-tf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	patch := filepath.Join(dir, "prod.yaml")
+	if err := ioutil.WriteFile(patch, []byte("spec:\n  region: us-east1\n  backend:\n    gcs:\n      bucket: my-state\n      encryptionKey: "+key+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	documents, err := api.UnmarshalDocuments("../examples/min-example.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	patches, err := overlay.Load([]string{patch})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(merged bool, project string) {
+		printMerged, projectID = merged, project
+	}(printMerged, projectID)
+	printMerged, projectID = true, "my-project"
+
+	var out bytes.Buffer
+	if err := prepareCluster(&out, documents[0], patches); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(out.String(), "---\n") {
+		t.Fatalf("expected a YAML document, got:\n%s", out.String())
+	}
+
+	// the merged cluster has the overlay, the project id and the defaults
+	var merged api.GkeTF
+	if err := yaml.Unmarshal(out.Bytes(), &merged); err != nil {
+		t.Fatalf("the merged cluster is not valid YAML: %v\n%s", err, out.String())
+	}
+	if merged.Spec.Region != "us-east1" || merged.Spec.ProjectId != "my-project" || merged.Spec.Version != "latest" {
+		t.Errorf("expected the overlay, the project id and the defaults, got:\n%s", out.String())
+	}
+
+	// the encryption key is a secret, which is only redacted from the output
+	if strings.Contains(out.String(), key) || merged.Spec.Backend.GCS.EncryptionKey != "REDACTED" {
+		t.Errorf("expected the encryption key to be redacted, got:\n%s", out.String())
+	}
+	if documents[0].GkeTF.Spec.Backend.GCS.EncryptionKey != key {
+		t.Errorf("expected the encryption key of the cluster to be kept, got %q", documents[0].GkeTF.Spec.Backend.GCS.EncryptionKey)
+	}
+}
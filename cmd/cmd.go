@@ -56,9 +56,17 @@ func init() {
 	NewRootCommand(os.Stdout)
 }
 
+// errorExitCode is the exit code of exitWithError.  The diff command sets it to
+// diffErrorExitCode, since 1 means that there are differences.
+var errorExitCode = 1
+
 // Execute is the extry point that main.go runs.
 func Execute() {
-	if err := RootCMD.Execute(); err != nil {
+	if command, err := RootCMD.ExecuteC(); err != nil {
+		// the flags of diff are parsed before it runs
+		if command.Name() == "diff" {
+			errorExitCode = diffErrorExitCode
+		}
 		exitWithError(err)
 	}
 }
@@ -67,12 +75,18 @@ func Execute() {
 func NewRootCommand(out io.Writer) *cobra.Command {
 	RootCMD.AddCommand(NewVersionCommand(out))
 	RootCMD.AddCommand(NewGenCommand())
+	RootCMD.AddCommand(NewValidateCommand(out))
+	RootCMD.AddCommand(NewIpamCommand(out))
+	RootCMD.AddCommand(NewConvertCommand(out))
+	RootCMD.AddCommand(NewSchemaCommand(out))
+	RootCMD.AddCommand(NewExplainCommand(out))
+	RootCMD.AddCommand(NewDiffCommand(out))
 	return RootCMD
 }
 
 // exitWithError will terminate execution with an error result
-// It prints the error to stderr and exits with a non-zero exit code
+// It prints the error to stderr and exits with errorExitCode
 func exitWithError(err error) {
 	klog.Errorf("Error: %v", err)
-	os.Exit(1)
+	os.Exit(errorExitCode)
 }
@@ -0,0 +1,98 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"k8s.io/klog"
+
+	"github.com/GoogleCloudPlatform/gke-terraform-generator/pkg/api"
+)
+
+var (
+	// convertTo is the API version that the convert command converts to.
+	convertTo string
+	// inPlace determines whether the convert command overwrites the file.
+	inPlace bool
+)
+
+// NewConvertCommand is the entry point for cobra for the convert command.
+func NewConvertCommand(out io.Writer) *cobra.Command {
+	convertCommand := &cobra.Command{
+		Use:   "convert",
+		Short: "Converts a GKE TF yaml configuration file to another API version",
+		Long: fmt.Sprintf(`Converts a GKE TF yaml configuration file to another API version.
+
+Every document in the file is converted and its apiVersion is set. Only the
+keys that differ between the versions are changed, so comments and formatting
+are kept. The result is printed, or written back to the file with --in-place.
+
+Documents without an apiVersion are %s. gen and validate convert
+older documents when they are read, so converting is only needed to use the
+new keys. The supported versions are:
+
+  %s`, api.V1alpha1, strings.Join(api.Versions(), "\n  ")),
+	}
+	// Add root flags so we can get logging flags
+	convertCommand.Flags().AddFlagSet(RootCMD.Flags())
+	convertCommand.Flags().StringVarP(&configFile, "file", "f", "", "config yaml file")
+	convertCommand.Flags().StringVar(&convertTo, "to", api.HubVersion, "API version to convert to, for example v1beta1")
+	convertCommand.Flags().BoolVar(&inPlace, "in-place", false, "overwrite the file instead of printing the result")
+
+	if err := cobra.MarkFlagRequired(convertCommand.Flags(), "file"); err != nil {
+		exitWithError(err)
+	}
+
+	convertCommand.Run = func(cmd *cobra.Command, args []string) {
+		version, err := api.ParseVersion(convertTo)
+		if err != nil {
+			exitWithError(err)
+		}
+
+		info, err := os.Stat(configFile)
+		if err != nil {
+			exitWithError(err)
+		}
+		source, err := ioutil.ReadFile(configFile)
+		if err != nil {
+			exitWithError(err)
+		}
+
+		converted, err := api.ConvertDocuments(source, version)
+		if err != nil {
+			exitWithError(fmt.Errorf("unable to convert %s: %v", configFile, err))
+		}
+
+		if !inPlace {
+			if _, err := out.Write(converted); err != nil {
+				exitWithError(err)
+			}
+			return
+		}
+		if err := ioutil.WriteFile(configFile, converted, info.Mode()); err != nil {
+			exitWithError(err)
+		}
+		klog.Infof("Converted %s to %s", configFile, version)
+	}
+	return convertCommand
+}
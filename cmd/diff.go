@@ -0,0 +1,142 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+	"k8s.io/klog"
+
+	"github.com/GoogleCloudPlatform/gke-terraform-generator/pkg/generator"
+)
+
+// exitCode determines whether the diff command exits with diffExitCode when there are
+// differences.
+var exitCode bool
+
+const (
+	// diffExitCode is the exit code of diff --exit-code when there are differences.
+	diffExitCode = 1
+	// diffErrorExitCode is the exit code of diff when it fails, as that of diff(1), so that a
+	// failure is not mistaken for differences.
+	diffErrorExitCode = 2
+)
+
+// NewDiffCommand is the entry point for cobra for the diff command.
+func NewDiffCommand(out io.Writer) *cobra.Command {
+	defaultDir, err := os.Getwd()
+	if err != nil {
+		klog.Errorf("Error getting directory: %v", err)
+		exitWithError(err)
+	}
+
+	diffCommand := &cobra.Command{
+		Use:   "diff",
+		Short: "Shows the changes that gen would make to the terraform files",
+		Long: `Shows the changes that gen would make to the terraform files.
+
+The terraform is rendered in memory, with the same flags as gen, and compared
+with the files in the output directory. A unified diff is printed for every
+file that would change, and nothing is written. The terraform in the user
+sections of the existing files is kept, as gen keeps it, so it is not shown as
+a change. The files in the directory that gen generated but would no longer
+write are shown as removed.
+
+With --exit-code the command exits with 1 when there are differences, so that
+a CI job can check that the committed terraform is up to date with the
+committed YAML. As with diff(1), the command exits with 2 when it fails.`,
+		Example: `  gke-tf diff -f cluster.yaml -d terraform --exit-code`,
+	}
+	// Add root flags so we can get logging flags
+	diffCommand.Flags().AddFlagSet(RootCMD.Flags())
+	diffCommand.Flags().StringVarP(&outDir, "directory", "d", defaultDir, "output directory to compare with")
+	diffCommand.Flags().StringVarP(&configFile, "file", "f", "", "config yaml file or directory")
+	diffCommand.Flags().StringVarP(&projectID, "project-id", "p", "", "gcp project id")
+	diffCommand.Flags().StringVarP(&tfTypeStr, "tf-type", "t", "Vanilla", "terraform types are CFT, Vanilla or Builder")
+	diffCommand.Flags().BoolVar(&rootModule, "root-module", false, "compare the root module that uses every cluster")
+	diffCommand.Flags().BoolVar(&strict, "strict", false, "fail when a field is set that the terraform type ignores")
+	diffCommand.Flags().BoolVar(&skipSyntaxCheck, "skip-syntax-check", false, "compare the terraform without checking that it is valid HCL")
+	diffCommand.Flags().BoolVar(&noFormat, "no-format", false, "compare the terraform as the templates render it, without formatting it")
+	diffCommand.Flags().StringVar(&syntax, "format", syntaxHCL, "syntax of the terraform files, hcl or json")
+	diffCommand.Flags().StringVar(&templatesDir, "templates-dir", "", "directory of templates that override or add to those of the terraform type")
+	diffCommand.Flags().BoolVar(&parameterize, "parameterize", false, "compare the terraform with the fields as variables")
+	diffCommand.Flags().BoolVar(&asModule, "as-module", false, "compare the terraform as a child module, with its example root module")
+	diffCommand.Flags().BoolVar(&exitCode, "exit-code", false, "exit with 1 when there are differences, errors exit with 2")
+
+	addOverlayFlags(diffCommand)
+
+	if err := cobra.MarkFlagRequired(diffCommand.Flags(), "file"); err != nil {
+		exitWithError(err)
+	}
+
+	diffCommand.Run = func(cmd *cobra.Command, args []string) {
+		errorExitCode = diffErrorExitCode
+		if err := checkDiffArgs(); err != nil {
+			klog.Errorf("Error checking cli arguments: %v", err)
+			os.Exit(errorExitCode)
+		}
+
+		rendered := map[string][]byte{}
+		generateClusters(func(files map[string][]byte) error {
+			for name, b := range files {
+				rendered[name] = b
+			}
+			return nil
+		})
+
+		diff, err := generator.Diff(outDir, rendered)
+		if err != nil {
+			exitWithError(err)
+		}
+		if _, err := io.WriteString(out, diff); err != nil {
+			exitWithError(err)
+		}
+		if diff != "" && exitCode {
+			os.Exit(diffExitCode)
+		}
+	}
+	return diffCommand
+}
+
+// checkDiffArgs checks the cli arguments of the diff command.  Unlike gen, the
+// output directory is not created if it does not exist.
+func checkDiffArgs() error {
+	if outDir == "" {
+		return errors.New("--directory option must be set with a directory name")
+	}
+	if configFile == "" {
+		return errors.New("--file option must be set with a file name")
+	}
+	if _, err := os.Stat(configFile); err != nil {
+		return fmt.Errorf("Error openning config file: %s ... %s", configFile, err.Error())
+	}
+	// the merged clusters would be printed in the middle of the diff
+	if printMerged {
+		return errors.New("--print-merged can not be used with diff")
+	}
+	if err := parseTFType(); err != nil {
+		return err
+	}
+	if err := checkRootModule(); err != nil {
+		return err
+	}
+	return checkSyntax()
+}
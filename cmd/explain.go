@@ -0,0 +1,202 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/GoogleCloudPlatform/gke-terraform-generator/pkg/schema"
+	"github.com/GoogleCloudPlatform/gke-terraform-generator/pkg/templates"
+)
+
+// recursive determines whether the explain command prints every nested field.
+var recursive bool
+
+// NewExplainCommand is the entry point for cobra for the explain command.
+func NewExplainCommand(out io.Writer) *cobra.Command {
+	explainCommand := &cobra.Command{
+		Use:   "explain [path]",
+		Short: "Describes a field of the GKE TF yaml configuration",
+		Long: `Describes a field of the GKE TF yaml configuration.
+
+The field is named by its path from the top of a document, for example
+spec.nodePools.spec.imageType. The type, default, allowed values, description
+and documentation links of the field are printed, along with the terraform
+types that use it and the fields that it holds. A field that a terraform type
+ignores has no effect on the terraform that gen creates with that type.
+
+Without a path the top level fields are described. With --recursive the
+names and types of every nested field are printed.`,
+		Example: `  gke-tf explain spec.nodePools.spec.imageType
+  gke-tf explain spec.addons --recursive`,
+		Args: cobra.MaximumNArgs(1),
+	}
+	// Add root flags so we can get logging flags
+	explainCommand.Flags().AddFlagSet(RootCMD.Flags())
+	explainCommand.Flags().BoolVar(&recursive, "recursive", false, "print the names and types of every nested field")
+
+	explainCommand.Run = func(cmd *cobra.Command, args []string) {
+		var path string
+		if len(args) > 0 {
+			path = args[0]
+		}
+		field, err := schema.Explain(path)
+		if err != nil {
+			exitWithError(err)
+		}
+		if err := printField(out, field); err != nil {
+			exitWithError(err)
+		}
+	}
+	return explainCommand
+}
+
+// printField prints the documentation of a field and of its fields.
+func printField(out io.Writer, field *schema.Field) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "FIELD:    %s <%s>\n", field.Name, field.Type)
+	if field.Path != "" {
+		fmt.Fprintf(&b, "PATH:     %s\n", field.Path)
+	}
+	if field.Required {
+		fmt.Fprintf(&b, "REQUIRED: true\n")
+	}
+	if field.Schema.Default != nil {
+		fmt.Fprintf(&b, "DEFAULT:  %s\n", formatValue(field.Schema.Default))
+	}
+	if len(field.Schema.Enum) > 0 {
+		var values []string
+		for _, value := range field.Schema.Enum {
+			values = append(values, formatValue(value))
+		}
+		fmt.Fprintf(&b, "ALLOWED:  %s\n", strings.Join(values, ", "))
+	}
+	for _, bound := range []struct {
+		name  string
+		value *int64
+	}{
+		{"MINIMUM:  ", field.Schema.Minimum},
+		{"MAXIMUM:  ", field.Schema.Maximum},
+		{"MIN LEN:  ", field.Schema.MinLength},
+		{"MAX LEN:  ", field.Schema.MaxLength},
+		{"MIN ITEMS:", field.Schema.MinItems},
+		{"MAX ITEMS:", field.Schema.MaxItems},
+	} {
+		if bound.value != nil {
+			fmt.Fprintf(&b, "%s %d\n", bound.name, *bound.value)
+		}
+	}
+	if field.Schema.Pattern != "" {
+		fmt.Fprintf(&b, "PATTERN:  %s\n", field.Schema.Pattern)
+	}
+	if field.Schema.Format != "" {
+		fmt.Fprintf(&b, "FORMAT:   %s\n", field.Schema.Format)
+	}
+
+	supported, ignored, err := fieldBackends(field.Path)
+	if err != nil {
+		return err
+	}
+	if len(ignored) == 0 {
+		fmt.Fprintf(&b, "BACKENDS: %s\n", strings.Join(supported, ", "))
+	} else if len(supported) == 0 {
+		fmt.Fprintf(&b, "BACKENDS: none, ignored by %s\n", strings.Join(ignored, ", "))
+	} else {
+		fmt.Fprintf(&b, "BACKENDS: %s, ignored by %s\n", strings.Join(supported, ", "), strings.Join(ignored, ", "))
+	}
+
+	if field.Description != "" {
+		fmt.Fprintf(&b, "\nDESCRIPTION:\n")
+		for _, line := range strings.Split(field.Description, "\n") {
+			fmt.Fprintf(&b, "     %s\n", line)
+		}
+	}
+	if len(field.Links) > 0 {
+		fmt.Fprintf(&b, "\nLINKS:\n")
+		for _, link := range field.Links {
+			fmt.Fprintf(&b, "     %s\n", link)
+		}
+	}
+
+	if len(field.Fields) > 0 {
+		fmt.Fprintf(&b, "\nFIELDS:\n")
+		if recursive {
+			printTree(&b, field.Fields, "   ")
+		} else {
+			for _, f := range field.Fields {
+				fmt.Fprintf(&b, "   %s\t<%s>%s\n", f.Name, f.Type, requiredMark(f))
+				if f.Description != "" {
+					fmt.Fprintf(&b, "     %s\n\n", strings.Split(f.Description, "\n")[0])
+				} else {
+					fmt.Fprintf(&b, "\n")
+				}
+			}
+		}
+	}
+
+	_, err = io.WriteString(out, b.String())
+	return err
+}
+
+// printTree prints the names and types of fields and of their nested fields.
+func printTree(b *strings.Builder, fields []*schema.Field, indent string) {
+	for _, f := range fields {
+		fmt.Fprintf(b, "%s%s\t<%s>%s\n", indent, f.Name, f.Type, requiredMark(f))
+		printTree(b, f.Fields, indent+"   ")
+	}
+}
+
+func requiredMark(field *schema.Field) string {
+	if field.Required {
+		return " -required-"
+	}
+	return ""
+}
+
+// fieldBackends returns the terraform types that use the field at path, and those that ignore it.
+func fieldBackends(path string) ([]string, []string, error) {
+	var supported, ignored []string
+	for _, tfType := range templates.Types() {
+		gkeTemplates, err := templates.NewGKETemplates(tfType)
+		if err != nil {
+			return nil, nil, err
+		}
+		if gkeTemplates.Supports(path) {
+			supported = append(supported, tfType.Name())
+		} else {
+			ignored = append(ignored, tfType.Name())
+		}
+	}
+	return supported, ignored, nil
+}
+
+// formatValue formats a default or allowed value, printing lists and maps as JSON.
+func formatValue(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return s
+	}
+	b, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(b)
+}
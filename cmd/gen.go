@@ -17,9 +17,10 @@ limitations under the License.
 package cmd
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"strings"
+	"io"
 
 	"github.com/spf13/cobra"
 
@@ -28,7 +29,10 @@ import (
 	"k8s.io/klog"
 
 	"github.com/GoogleCloudPlatform/gke-terraform-generator/pkg/api"
+	"github.com/GoogleCloudPlatform/gke-terraform-generator/pkg/backend"
 	"github.com/GoogleCloudPlatform/gke-terraform-generator/pkg/files"
+	"github.com/GoogleCloudPlatform/gke-terraform-generator/pkg/generator"
+	"github.com/GoogleCloudPlatform/gke-terraform-generator/pkg/overlay"
 	"github.com/GoogleCloudPlatform/gke-terraform-generator/pkg/templates"
 )
 
@@ -41,12 +45,50 @@ var (
 	projectID string
 	// overwriteFile boolean determines whether TF files can be written over
 	overwriteFile bool
-	// gkeTF is the api cluster representation.
-	gkeTF *api.GkeTF
+	// rootModule determines whether a root module that uses every cluster is written.
+	rootModule bool
+	// strict determines whether gen fails when a field is set that the terraform type ignores.
+	strict bool
+	// force determines whether gen overwrites files that were edited outside of their user sections.
+	force bool
+	// backup determines whether the files that gen overwrites are kept with a timestamp suffix.
+	backup bool
+	// skipSyntaxCheck determines whether the rendered terraform is written without parsing it as HCL.
+	skipSyntaxCheck bool
+	// noFormat determines whether the rendered terraform is written without formatting it.
+	noFormat bool
+	// syntax is the syntax of the terraform files, hcl or json.
+	syntax string
+	// output is where the terraform files are written, a directory, a tarball or stdout.
+	output string
 	// tfType is the type of terraform
 	tfTypeStr string
 	// tfType is the type of terraform
 	tfType templates.TFType
+	// templatesDir is a directory of templates that override or add to those of tfType.
+	templatesDir string
+	// parameterize determines whether the fields of a cluster are written as variables, whose
+	// values are in a terraform.tfvars.
+	parameterize bool
+	// asModule determines whether a cluster is written as a child module without providers,
+	// with an example root module that calls it.
+	asModule bool
+)
+
+const (
+	// outputDir writes the terraform files to the output directory.
+	outputDir = "dir"
+	// outputTar writes the terraform files to stdout as a tarball.
+	outputTar = "tar"
+	// outputStdout prints the terraform files to stdout.
+	outputStdout = "stdout"
+)
+
+const (
+	// syntaxHCL writes the terraform files in the native syntax, such as main.tf.
+	syntaxHCL = "hcl"
+	// syntaxJSON writes the terraform files in the JSON syntax, such as main.tf.json.
+	syntaxJSON = "json"
 )
 
 // NewGenCommand is the entry point for cobra for the gen command.
@@ -60,15 +102,112 @@ func NewGenCommand() *cobra.Command {
 	genCommand := &cobra.Command{
 		Use:   "gen",
 		Short: "Generates GKE TF File with given locals",
+		Long: `Generates GKE TF File with given locals.
+
+The config file may hold several clusters as YAML documents separated by ---,
+or the --file flag may name a directory of .yaml and .yml files. Each cluster
+is then written to a subdirectory of the output directory named after its
+metadata.name. Every cluster is generated even if another one fails.
+
+With --root-module a main.tf is also written to the output directory that uses
+each cluster as a module, so that all of them can be applied together.
+
+Overlay files given with --overlay are applied to every cluster, in order,
+before the defaults. A mapping document is a strategic merge patch that
+matches node pools by metadata.name, and a list document holds JSON6902
+operations. --print-merged prints each cluster after the overlays and
+defaults are applied, to stderr with the validation errors.
+
+Every rendered file is parsed as HCL before it is written, and a file that is
+not valid fails the cluster, with the template line and the fields whose values
+are on it. --skip-syntax-check writes the terraform without the check.
+
+The terraform is formatted as terraform fmt formats it, and the blank lines
+that the templates leave are removed, so that the output is stable and easy to
+diff. --no-format writes the terraform as the templates render it.
+
+With -t Builder the terraform is built in Go as an HCL syntax tree instead of
+being rendered from templates. It is the same terraform as Vanilla, but every
+value of the YAML is quoted and escaped, so a label such as "cost center" or a
+value that holds ${ can not break it.
+
+With --format json the terraform is written in the JSON syntax of terraform
+instead, as main.tf.json, network.tf.json, outputs.tf.json and
+variables.tf.json, so that other tools can process it as data. JSON has no
+comments, so these files have no header or user sections, and they are
+replaced as a whole.
+
+With --parameterize the fields of the YAML are written as references to
+variables instead of values, such as var.node_pools_default_machine_type, so
+that the same terraform can be applied with other values. The variables are
+declared by parameters.tf, named after the path of their field, and the
+values of the YAML are written to terraform.tfvars, which terraform loads
+automatically. The fields that decide the structure of the terraform, such
+as spec.private, the names of the node pools and their taints, are still
+written as they are. --parameterize can not be used with
+--root-module, since the variables have no defaults.
+
+With --as-module each cluster is written as a child module that can be
+published to a registry and called by other terraform: its provider blocks
+are moved to an example root module in examples/basic, which calls the module
+with the values of the cluster and has its outputs. With --parameterize the
+values of terraform.tfvars are passed by the example instead, since terraform
+ignores the tfvars of a child module. --as-module can not be used with
+--root-module either.
+
+With --templates-dir the templates of a directory are used on top of those of
+the terraform type: main.tf.tmpl replaces the template of main.tf, and a
+template such as org.tf.tmpl adds org.tf. The templates are executed with the
+same cluster data, functions and partials as the embedded ones, and templates
+whose names start with _, such as _helpers.tmpl, add partials instead of
+rendering files. An optional manifest.yaml lists the files to render, in
+order, and names the templates:
+
+  name: Acme
+  files: [main.tf, network.tf, outputs.tf, variables.tf, org.tf]
+
+A warning is printed for every field that is set but that the terraform type
+ignores, such as spec.stubDomains with Vanilla. With --strict these fields
+fail the cluster instead. gke-tf explain lists the terraform types that use a
+field.
+
+The terraform files are written to the output directory. Every file of a
+cluster is rendered first and then moved into place together, so that a
+failure leaves the previous files untouched. With --backup the files that are
+overwritten are kept next to them with a timestamp suffix.
+
+Each generated file starts with a header that holds its checksum, and ends
+with a user section between gke-tf:begin-user-section and
+gke-tf:end-user-section comments. The terraform in a user section is kept when
+the file is generated again, and other files in the directory, such as a
+custom.tf, are never touched. A file that was edited outside of its user
+sections, or that was not generated by gke-tf, is only overwritten with
+--force.
+
+With --output tar the terraform files are written to stdout as a tarball
+instead, and with --output stdout they are printed one after the other.`,
 	}
 	// Add root flags so we can get logging flags
 	genCommand.Flags().AddFlagSet(RootCMD.Flags())
 	// TODO add long help descriptions for these
 	genCommand.Flags().StringVarP(&outDir, "directory", "d", defaultDir, "output directory")
-	genCommand.Flags().StringVarP(&configFile, "file", "f", "", "config yaml file")
+	genCommand.Flags().StringVarP(&configFile, "file", "f", "", "config yaml file or directory")
 	genCommand.Flags().StringVarP(&projectID, "project-id", "p", "", "gcp project id")
-	genCommand.Flags().StringVarP(&tfTypeStr, "tf-type", "t", "Vanilla", "terraform types are CFT or Vanilla")
+	genCommand.Flags().StringVarP(&tfTypeStr, "tf-type", "t", "Vanilla", "terraform types are CFT, Vanilla or Builder")
 	genCommand.Flags().BoolVarP(&overwriteFile, "overwrite-file", "o", false, "overwrite file flag")
+	genCommand.Flags().BoolVar(&rootModule, "root-module", false, "write a root module that uses every cluster")
+	genCommand.Flags().BoolVar(&strict, "strict", false, "fail when a field is set that the terraform type ignores")
+	genCommand.Flags().BoolVar(&force, "force", false, "overwrite files that were edited outside of their user sections")
+	genCommand.Flags().BoolVar(&backup, "backup", false, "keep the files that are overwritten, with a timestamp suffix")
+	genCommand.Flags().StringVar(&output, "output", outputDir, "where the terraform is written, dir, tar or stdout")
+	genCommand.Flags().BoolVar(&skipSyntaxCheck, "skip-syntax-check", false, "write the terraform without checking that it is valid HCL")
+	genCommand.Flags().BoolVar(&noFormat, "no-format", false, "write the terraform as the templates render it, without formatting it")
+	genCommand.Flags().StringVar(&syntax, "format", syntaxHCL, "syntax of the terraform files, hcl or json")
+	genCommand.Flags().StringVar(&templatesDir, "templates-dir", "", "directory of templates that override or add to those of the terraform type")
+	genCommand.Flags().BoolVar(&parameterize, "parameterize", false, "write the fields as variables, with their values in a terraform.tfvars")
+	genCommand.Flags().BoolVar(&asModule, "as-module", false, "write a child module without providers, with an example root module that calls it")
+
+	addOverlayFlags(genCommand)
 
 	if err := cobra.MarkFlagRequired(genCommand.Flags(), "file"); err != nil {
 		exitWithError(err)
@@ -82,94 +221,261 @@ func NewGenCommand() *cobra.Command {
 			os.Exit(1)
 		}
 
-		gkeTF, err = api.UnmarshalGkeTF(configFile)
-		if err != nil {
-			klog.Errorf("Error unmarshaling the configuration file: %v", err)
+		writer := newWriter()
+		generateClusters(writer.WriteFiles)
+		if err := writer.Close(); err != nil {
 			exitWithError(err)
 		}
+	}
+	return genCommand
+}
 
-		klog.Infof("Creating terraform for your GKE cluster %s.", gkeTF.Name)
+// generateClusters renders the terraform of every cluster of the config file, and
+// of the root module with --root-module, and passes the files of each to write.
+// It exits if a cluster fails, after every cluster has been tried.
+func generateClusters(write func(files map[string][]byte) error) {
+	documents, readFailed := readClusters()
+	patches := readOverlays()
 
-		// set project id.  This will also override the value if it exists in the
-		// YAML file.
-		if projectID != "" {
-			gkeTF.Spec.ProjectId = projectID
+	// a single cluster is written to the output directory, and several clusters
+	// are written to a subdirectory each
+	info, err := os.Stat(configFile)
+	if err != nil {
+		exitWithError(err)
+	}
+	subdirectories := len(documents) > 1 || info.IsDir() || rootModule
+
+	var failures clusterFailures
+	var names []string
+	for _, document := range documents {
+		files, err := generateCluster(document, patches)
+		if err == nil {
+			// terraform only reads the backend of the root module, which calls the clusters
+			if rootModule && document.GkeTF.Spec.Backend != nil {
+				klog.Warningf("spec.backend of %s is ignored by terraform, since the cluster is a module of the root module", document.GkeTF.Name)
+			}
+			if spec := document.GkeTF.Spec.Backend; spec != nil && spec.GCS != nil && spec.GCS.EncryptionKey != "" {
+				klog.Warningf("The encryption key of the state of %s is written to %s, which should not be committed", document.GkeTF.Name, backend.ConfigFileName)
+			}
+			if subdirectories {
+				files = generator.InDirectory(document.GkeTF.Name, files)
+			}
+			err = write(files)
 		}
-
-		err = api.SetApiDefaultValues(gkeTF, configFile)
 		if err != nil {
-			klog.Errorf("Error setting api defaults: %v", err)
-			exitWithError(err)
+			klog.Errorf("Error creating terraform for %s: %v", document.GkeTF.Name, err)
 		}
+		failures.add(document.GkeTF.Name, err)
+		names = append(names, document.GkeTF.Name)
+	}
 
-		err = api.ValidateYamlInput(gkeTF)
-		if err != nil {
-			klog.Errorf("Error validating api values: %v", err)
-			exitWithError(err)
-		}
+	if err := failures.err(); err != nil {
+		exitWithError(err)
+	}
+	if readFailed {
+		exitWithError(fmt.Errorf("%s is not valid", configFile))
+	}
 
-		template, err := templates.NewGKETemplates(tfType)
-		if err != nil {
-			klog.Errorf("Error creating setting up terraform templates: %v", err)
-			exitWithError(err)
+	if rootModule {
+		files, err := generator.RootModule(names, generateOptions())
+		if err == nil {
+			err = write(files)
 		}
-
-		// this runs CopyTo on the template created.
-		// This func does all the grunt work of processing each go template and writing the
-		// terraform results to a file.
-		err = template.CopyTo(overwriteFile, outDir, gkeTF)
 		if err != nil {
-			klog.Errorf("Error creating terraform: %v", err)
+			klog.Errorf("Error creating the root module: %v", err)
 			exitWithError(err)
 		}
+	}
+}
 
+// newWriter returns the writer of the --output flag.
+func newWriter() generator.Writer {
+	switch output {
+	case outputTar:
+		return generator.NewTarWriter(os.Stdout)
+	case outputStdout:
+		return generator.NewStreamWriter(os.Stdout)
 	}
-	return genCommand
+	return generator.NewDirWriter(outDir, generator.DirOptions{AllowOverwrite: overwriteFile, Force: force, Backup: backup})
 }
 
-// checkCliArgs in essence checks the cli arguments to ensure that the proper
-// flags have been set by the user.
-func checkCliArgs() error {
+// generateCluster prepares and validates a cluster and renders its terraform.
+func generateCluster(document *api.Document, patches []*overlay.Patch) (map[string][]byte, error) {
+	gkeTF := document.GkeTF
+	klog.Infof("Creating terraform for your GKE cluster %s.", gkeTF.Name)
 
-	if outDir == "" {
-		return errors.New("--directory option must be set with a directory name")
+	if err := prepareCluster(os.Stderr, document, patches); err != nil {
+		return nil, err
+	}
+	if gkeTF.Spec.Network.Spec.Existing == nil {
+		klog.Infof("Network capacity:\n%s", api.CalculateNetworkCapacity(&gkeTF.Spec))
 	}
 
-	if err := files.CreateDirIfNotExist(outDir); err != nil {
-		return fmt.Errorf("Error creating directory: %s ... %s", outDir, err.Error())
+	template, err := templates.NewGKETemplates(tfType)
+	if err != nil {
+		klog.Errorf("Error creating setting up terraform templates: %v", err)
+		return nil, err
 	}
 
-	test, err := files.IsWritable(outDir)
+	if err := checkIgnoredFields(os.Stderr, document, template); err != nil {
+		return nil, err
+	}
+
+	files, err := generator.Generate(context.Background(), gkeTF, generateOptions())
+	if syntaxErr, ok := err.(*templates.SyntaxError); ok {
+		printSyntaxError(os.Stderr, document, syntaxErr)
+	}
+	return files, err
+}
+
+// generateOptions returns the options of the generator that the flags set.
+func generateOptions() generator.Options {
+	return generator.Options{
+		TFType:          tfType,
+		SkipSyntaxCheck: skipSyntaxCheck,
+		NoFormat:        noFormat,
+		JSON:            syntax == syntaxJSON,
+		Parameterize:    parameterize,
+		AsModule:        asModule,
+	}
+}
+
+// printSyntaxError points to the fields of a cluster that most likely caused the
+// templates to render terraform that is not valid HCL.
+func printSyntaxError(out io.Writer, document *api.Document, syntaxErr *templates.SyntaxError) {
+	var diags api.Diagnostics
+	for _, path := range syntaxErr.Fields {
+		diags = append(diags, &api.Diagnostic{
+			Path:    path,
+			Message: fmt.Sprintf("is on line %d of %s, which is not valid HCL", syntaxErr.Line, syntaxErr.Template),
+		})
+	}
+	if len(diags) > 0 {
+		printDiagnostics(out, document, diags)
+	}
+}
+
+// checkIgnoredFields prints the fields of a cluster that are set but that the
+// terraform type ignores.  With --strict an error is returned if there are any.
+func checkIgnoredFields(out io.Writer, document *api.Document, template *templates.GKETemplates) error {
+	ignored, err := template.IgnoredSetFields(document.GkeTF)
 	if err != nil {
-		return fmt.Errorf("Error openning directory: %s ... %s", outDir, err.Error())
+		return err
+	}
+	if len(ignored) == 0 {
+		return nil
 	}
 
-	if !test {
-		return errors.New("Unable to open directory: " + outDir)
+	var diags api.Diagnostics
+	for _, path := range ignored {
+		diags = append(diags, &api.Diagnostic{
+			Path:    path,
+			Message: fmt.Sprintf("is ignored by the %s terraform type", tfType.Name()),
+		})
+	}
+	printDiagnostics(out, document, diags)
+
+	if strict {
+		return fmt.Errorf("%d fields are ignored by the %s terraform type", len(ignored), tfType.Name())
+	}
+	klog.Warningf("%d fields of %s are ignored by the %s terraform type, use --strict to fail instead", len(ignored), document.GkeTF.Name, tfType.Name())
+	return nil
+}
+
+// checkCliArgs in essence checks the cli arguments to ensure that the proper
+// flags have been set by the user.
+func checkCliArgs() error {
+
+	switch output {
+	case outputDir:
+		if err := checkOutDir(); err != nil {
+			return err
+		}
+	case outputTar, outputStdout:
+	default:
+		return fmt.Errorf("unable to determine the output %q, please set the --output flag with %s, %s or %s", output, outputDir, outputTar, outputStdout)
 	}
 
 	if configFile == "" {
 		return errors.New("--file option must be set with a file name")
 	}
 
-	test, err = files.IsFile(configFile)
+	// the configuration is either a file or a directory of files
+	if _, err := os.Stat(configFile); err != nil {
+		return fmt.Errorf("Error openning config file: %s ... %s", configFile, err.Error())
+	}
+
+	if err := parseTFType(); err != nil {
+		return err
+	}
+	if err := checkRootModule(); err != nil {
+		return err
+	}
+	return checkSyntax()
+}
 
+// checkRootModule checks that --root-module is not used with the flags that need the clusters
+// to be called with their values and providers.
+func checkRootModule() error {
+	if !rootModule {
+		return nil
+	}
+	// the root module does not set the variables of the clusters
+	if parameterize {
+		return errors.New("--parameterize can not be used with --root-module")
+	}
+	// nor does it configure their providers
+	if asModule {
+		return errors.New("--as-module can not be used with --root-module, each module has an example root module")
+	}
+	return nil
+}
+
+// checkSyntax checks the --format flag.
+func checkSyntax() error {
+	switch syntax {
+	case syntaxHCL, syntaxJSON:
+		return nil
+	}
+	return fmt.Errorf("unable to determine the format %q, please set the --format flag with %s or %s", syntax, syntaxHCL, syntaxJSON)
+}
+
+// parseTFType sets tfType from the -t flag.  With --templates-dir the templates of the
+// directory are registered as a new terraform type, on top of those of the -t flag.
+func parseTFType() error {
+	var ok bool
+	if tfType, ok = templates.Lookup(tfTypeStr); !ok {
+		return fmt.Errorf("unable to determine terraform type, please set the -t flag with %s", templates.TypeNames())
+	}
+	if templatesDir == "" {
+		return nil
+	}
+	custom, err := templates.RegisterDir(templatesDir, tfType)
 	if err != nil {
-		return fmt.Errorf("Error openning config file: %s ... %s", configFile, err.Error())
+		return fmt.Errorf("unable to load the templates of %s: %v", templatesDir, err)
 	}
+	tfType = custom
+	return nil
+}
 
-	if !test {
-		return errors.New("Configuration file is not found: " + configFile)
+// checkOutDir creates the output directory if it does not exist, and checks
+// that it can be written to.
+func checkOutDir() error {
+	if outDir == "" {
+		return errors.New("--directory option must be set with a directory name")
 	}
 
-	switch strings.ToUpper(tfTypeStr) {
-	case "CFT":
-		tfType = templates.CFT
-	case "VANILLA":
-		tfType = templates.VANILLA
-	default:
-		return errors.New("unable to determine terraform type, please set the -t flag with CFT or Vanilla")
+	if err := files.CreateDirIfNotExist(outDir); err != nil {
+		return fmt.Errorf("Error creating directory: %s ... %s", outDir, err.Error())
+	}
+
+	test, err := files.IsWritable(outDir)
+	if err != nil {
+		return fmt.Errorf("Error openning directory: %s ... %s", outDir, err.Error())
 	}
 
+	if !test {
+		return errors.New("Unable to open directory: " + outDir)
+	}
 	return nil
 }
@@ -0,0 +1,117 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+
+	"github.com/GoogleCloudPlatform/gke-terraform-generator/pkg/api"
+	"github.com/GoogleCloudPlatform/gke-terraform-generator/pkg/ipam"
+)
+
+var (
+	// supernet is the CIDR that the ipam command plans ranges in.
+	supernet string
+	// ipamNodes is the maximum number of nodes in the cluster.
+	ipamNodes int64
+	// ipamMaxPodsPerNode is the maximum number of pods on each node.
+	ipamMaxPodsPerNode int
+	// ipamServices is the number of service IPs.
+	ipamServices int64
+	// usedRanges are the CIDRs that are already in use.
+	usedRanges []string
+	// networkName is the name of the network in the printed block.
+	networkName string
+	// subnetName is the name of the subnet in the printed block.
+	subnetName string
+)
+
+// NewIpamCommand is the entry point for cobra for the ipam command.
+func NewIpamCommand(out io.Writer) *cobra.Command {
+	ipamCommand := &cobra.Command{
+		Use:   "ipam",
+		Short: "Plans the subnet, pod, service and master ranges of a GKE network",
+		Long: `Plans the subnet, pod, service and master ranges of a GKE network.
+
+The ranges are carved out of the supernet so that they do not overlap each
+other or any of the used ranges. The subnet and pod ranges are sized for the
+number of nodes, which is the total over all zones. A network block is printed
+that can be pasted into the spec of a cluster configuration file.
+
+Alternatively set supernet, and optionally usedRanges, in spec.network.spec of
+the configuration file and leave the ranges empty. The gen and validate
+commands then plan the empty ranges for the node pools.`,
+	}
+	// Add root flags so we can get logging flags
+	ipamCommand.Flags().AddFlagSet(RootCMD.Flags())
+	ipamCommand.Flags().StringVar(&supernet, "supernet", "", "CIDR that the ranges are planned in, for example 10.0.0.0/14")
+	ipamCommand.Flags().Int64Var(&ipamNodes, "nodes", 0, "maximum number of nodes in the cluster")
+	ipamCommand.Flags().IntVar(&ipamMaxPodsPerNode, "max-pods-per-node", 110, "maximum number of pods on each node")
+	ipamCommand.Flags().Int64Var(&ipamServices, "services", ipam.DefaultServices, "number of service IPs")
+	ipamCommand.Flags().StringSliceVar(&usedRanges, "used", nil, "CIDR that is already in use, may be repeated")
+	ipamCommand.Flags().StringVar(&networkName, "network-name", "my-network", "name of the network")
+	ipamCommand.Flags().StringVar(&subnetName, "subnet-name", "my-subnet", "name of the subnet")
+
+	for _, flag := range []string{"supernet", "nodes"} {
+		if err := cobra.MarkFlagRequired(ipamCommand.Flags(), flag); err != nil {
+			exitWithError(err)
+		}
+	}
+
+	ipamCommand.Run = func(cmd *cobra.Command, args []string) {
+		if ipamNodes <= 0 || ipamMaxPodsPerNode <= 0 {
+			exitWithError(errors.New("--nodes and --max-pods-per-node must be greater than zero"))
+		}
+
+		plan, err := ipam.NewPlan(&ipam.Request{
+			Supernet:     supernet,
+			Nodes:        ipamNodes,
+			PodAddresses: ipam.PodAddressesFor(ipamNodes, ipamMaxPodsPerNode),
+			Services:     ipamServices,
+			Used:         usedRanges,
+		})
+		if err != nil {
+			exitWithError(err)
+		}
+
+		network := map[string]*api.GkeNetwork{
+			"network": {
+				ObjectMeta: api.ObjectMeta{Name: networkName},
+				Spec: api.NetworkSpec{
+					SubnetName:          subnetName,
+					SubnetRange:         plan.SubnetRange,
+					PodSubnetRange:      plan.PodSubnetRange,
+					ServiceSubnetRange:  plan.ServiceSubnetRange,
+					MasterIPV4CIDRBlock: plan.MasterIPV4CIDRBlock,
+				},
+			},
+		}
+		b, err := yaml.Marshal(network)
+		if err != nil {
+			exitWithError(err)
+		}
+		if _, err := fmt.Fprintf(out, "%s", b); err != nil {
+			exitWithError(err)
+		}
+	}
+	return ipamCommand
+}
@@ -0,0 +1,59 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"io"
+
+	"github.com/spf13/cobra"
+
+	"github.com/GoogleCloudPlatform/gke-terraform-generator/pkg/schema"
+)
+
+// schemaFormat is the format of the printed schema.
+var schemaFormat string
+
+// NewSchemaCommand is the entry point for cobra for the schema command.
+func NewSchemaCommand(out io.Writer) *cobra.Command {
+	schemaCommand := &cobra.Command{
+		Use:   "schema",
+		Short: "Prints the JSON Schema or OpenAPI document of the GKE TF yaml configuration",
+		Long: `Prints the JSON Schema or OpenAPI document of the GKE TF yaml configuration.
+
+Editors and pre-commit hooks can use the JSON Schema to validate configuration
+files as they are written. The descriptions, defaults, enums, minimums,
+maximums and patterns come from the api package. An OpenAPI v3 document with
+the same schemas under components.schemas is printed with --format openapi.
+
+Rules that involve several fields, such as the network range overlaps, are
+only checked by gke-tf validate.`,
+	}
+	// Add root flags so we can get logging flags
+	schemaCommand.Flags().AddFlagSet(RootCMD.Flags())
+	schemaCommand.Flags().StringVar(&schemaFormat, "format", schema.JSONSchema, "schema format, jsonschema or openapi")
+
+	schemaCommand.Run = func(cmd *cobra.Command, args []string) {
+		b, err := schema.Generate(schemaFormat)
+		if err != nil {
+			exitWithError(err)
+		}
+		if _, err := out.Write(b); err != nil {
+			exitWithError(err)
+		}
+	}
+	return schemaCommand
+}
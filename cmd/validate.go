@@ -0,0 +1,108 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/spf13/cobra"
+
+	"github.com/GoogleCloudPlatform/gke-terraform-generator/pkg/api"
+	"github.com/GoogleCloudPlatform/gke-terraform-generator/pkg/overlay"
+)
+
+// NewValidateCommand is the entry point for cobra for the validate command.
+func NewValidateCommand(out io.Writer) *cobra.Command {
+	validateCommand := &cobra.Command{
+		Use:   "validate",
+		Short: "Validates a GKE TF yaml configuration file without generating terraform",
+		Long: `Validates a GKE TF yaml configuration file without generating terraform.
+
+The file may hold several clusters as YAML documents separated by ---, or the
+--file flag may name a directory of .yaml and .yml files. Every cluster is
+validated, and the command fails if any of them is not valid.
+
+Defaults are applied before the configuration is validated. Every problem is
+reported with its yaml path, its line and column in the file, the offending
+value and the rule that it breaks. The command exits with a non-zero exit
+code if any problems are found.
+
+The network ranges are checked for overlaps, and the maximum number of nodes
+that each range supports is printed. The ranges of an existing network are
+referenced by name and must not be set.
+
+Overlay files given with --overlay are applied to every cluster, in order,
+before the defaults. A mapping document is a strategic merge patch that
+matches node pools by metadata.name, and a list document holds JSON6902
+operations. --print-merged prints each cluster after the overlays and
+defaults are applied.`,
+	}
+	// Add root flags so we can get logging flags
+	validateCommand.Flags().AddFlagSet(RootCMD.Flags())
+	validateCommand.Flags().StringVarP(&configFile, "file", "f", "", "config yaml file or directory")
+	validateCommand.Flags().StringVarP(&projectID, "project-id", "p", "", "gcp project id")
+
+	addOverlayFlags(validateCommand)
+
+	if err := cobra.MarkFlagRequired(validateCommand.Flags(), "file"); err != nil {
+		exitWithError(err)
+	}
+
+	validateCommand.Run = func(cmd *cobra.Command, args []string) {
+		documents, readFailed := readClusters()
+		patches := readOverlays()
+
+		var failures clusterFailures
+		for _, document := range documents {
+			if len(documents) > 1 {
+				if _, err := fmt.Fprintf(out, "Cluster %s from %s:\n", document.GkeTF.Name, document); err != nil {
+					exitWithError(err)
+				}
+			}
+			failures.add(document.GkeTF.Name, validateCluster(out, document, patches))
+		}
+
+		if err := failures.err(); err != nil {
+			exitWithError(err)
+		}
+		if readFailed {
+			exitWithError(fmt.Errorf("%s is not valid", configFile))
+		}
+	}
+	return validateCommand
+}
+
+// validateCluster validates a single cluster and prints its network capacity.
+func validateCluster(out io.Writer, document *api.Document, patches []*overlay.Patch) error {
+	gkeTF := document.GkeTF
+	err := prepareCluster(out, document, patches)
+
+	// the ranges of an existing network are not known
+	if gkeTF.Spec.Network != nil && gkeTF.Spec.Network.Spec.Existing == nil {
+		capacity := api.CalculateNetworkCapacity(&gkeTF.Spec)
+		if _, err := fmt.Fprintf(out, "Network capacity:\n%s\n", indent(capacity.String())); err != nil {
+			return err
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(out, "%s is valid\n", document)
+	return err
+}
@@ -1,16 +1,18 @@
 module github.com/GoogleCloudPlatform/gke-terraform-generator
 
 require (
-	github.com/creasty/defaults v1.3.0
 	github.com/go-playground/locales v0.12.1 // indirect
 	github.com/go-playground/universal-translator v0.16.0 // indirect
-	github.com/imdario/mergo v0.3.7
+	github.com/hashicorp/hcl/v2 v2.8.2
 	github.com/leodido/go-urn v1.1.0 // indirect
+	github.com/pmezard/go-difflib v1.0.0
 	github.com/spf13/cobra v0.0.4
 	github.com/spf13/pflag v1.0.3
+	github.com/zclconf/go-cty v1.2.0
 	golang.org/x/tools v0.0.0-20190708203411-c8855242db9c
 	gopkg.in/go-playground/assert.v1 v1.2.1 // indirect
 	gopkg.in/go-playground/validator.v9 v9.29.0
 	gopkg.in/yaml.v2 v2.2.2
+	gopkg.in/yaml.v3 v3.0.1
 	k8s.io/klog v0.3.3
 )
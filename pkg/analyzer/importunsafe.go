@@ -39,8 +39,7 @@ func run(pass *analysis.Pass) (interface{}, error) {
 		for _, imp := range f.Imports {
 			path, err := strconv.Unquote(imp.Path.Value)
 			if err == nil && path == "unsafe" {
-				msg := fmt.Sprintf("package unsafe must not be imported pkg: %s", f.Name.Name)
-				pass.Reportf(imp.Pos(), msg)
+				pass.Reportf(imp.Pos(), "package unsafe must not be imported pkg: %s", f.Name.Name)
 			}
 		}
 	}
@@ -36,7 +36,7 @@ type ClusterSpec struct {
 	// The GCP ProjectId that is used to host the GKE cluster.
 	ProjectId string `yaml:"projectId" validate:"required"`
 	// Create a private GKE cluster.
-	Private string `yaml:"private,omitempty" default:"true" validate:"eq=true|eq=false"`
+	Private Bool `yaml:"private,omitempty" default:"true"`
 	// Region is the GCP Region that is used for the network and if a regional cluster is created
 	// it is used for that as well.
 	Region string `yaml:"region" validate:"required"` // TODO validate that if it is not a regional cluster, then we need zones
@@ -48,10 +48,10 @@ type ClusterSpec struct {
 	// This value will be used for the GKE nodepools as well, unless a nodepool has a version.
 	Version string `yaml:"version" default:"latest" validate:"required"`
 	// Regional denotes if the GKE cluster will be created as a regional cluster.
-	Regional string `yaml:"regional,omitempty" default:"true" validate:"eq=true|eq=false"`
+	Regional Bool `yaml:"regional,omitempty" default:"true"`
 
 	// RemoveDefaultNodePool enables the removal of the default GKE nodepool, which is the best practice.
-	RemoveDefaultNodePool *bool `yaml:"removeDefaultNodePool,omitempty" default:"true"`
+	RemoveDefaultNodePool Bool `yaml:"removeDefaultNodePool,omitempty" default:"true"`
 
 	// Zones are the GCP zones that the cluster runs inside of.
 	Zones *[]string `yaml:"zones"`
@@ -74,14 +74,14 @@ type ClusterSpec struct {
 	// TODO test below values
 
 	// Description of the cluster.
-	Description *string `yaml:"Description"`
+	Description *string `yaml:"description"`
 
 	IpMasqLinkLocal     *string `yaml:"ipMasqLinkLocal"`
 	IpMasqRsyncInterval *string `yaml:"ipMasqRsyncInterval"`
 	// RFC3339 format
 	MaintenanceStartTime *string `yaml:"maintenanceStartTime"`
 
-	IssueClientCertificate *string `yaml:"IssueClientCertificate" default:"false"`
+	IssueClientCertificate Bool `yaml:"issueClientCertificate" default:"false"`
 
 	// MasterAuthorizedNetworksConfig is a slice of the desired configuration options for master authorized networks.
 	// Omit the nested cidr_blocks attribute to disallow external access (except the cluster node IPs, which GKE automatically whitelists)
@@ -108,7 +108,7 @@ type ClusterSpec struct {
 	WorkloadIdentityConfig *WorkloadIdentityConfigSpec `yaml:"workloadIdentityConfig" validate:"omitempty,dive"`
 
 	// TODO check if we have this
-	DeployUsingPrivateEndpoint *bool `yaml:"deployUsingPrivateEndpoint"`
+	DeployUsingPrivateEndpoint Bool `yaml:"deployUsingPrivateEndpoint"`
 
 	// DefaultMaxPodsPerNode for all node pools. Controls the subnet slicing per node.  See
 	// https://cloud.google.com/kubernetes-engine/docs/how-to/flexible-pod-cidr
@@ -116,20 +116,29 @@ type ClusterSpec struct {
 	DefaultMaxPodsPerNode int16 `yaml:"defaultMaxPodsPerNode" default:"110" validate:"gte=8,lte=110"`
 
 	// Enable TPU support
-	// https://cloud.google.com/tpu/docs/kubernetes-engine-setuphttps://cloud.google.com/tpu/docs/kubernetes-engine-setup
-	Tpu string `yaml:"tpu,omitempty" default:"false" validate:"eq=true|eq=false"`
+	// https://cloud.google.com/tpu/docs/kubernetes-engine-setup
+	Tpu Bool `yaml:"tpu,omitempty" default:"false"`
 
 	// Enable Kubernetes Alpha support
 	// https://cloud.google.com/kubernetes-engine/docs/concepts/alpha-clusters
-	Alpha string `yaml:"alpha,omitempty" default:"false" validate:"eq=true|eq=false"`
+	Alpha Bool `yaml:"alpha,omitempty" default:"false"`
 
 	// Enable IntraNodeVisibility
 	// https://cloud.google.com/kubernetes-engine/docs/how-to/intranode-visibility
 	// Requires enabling VPC flow logs on the subnet first
-	IntraNodeVisibility string `yaml:"intraNodeVisibility,omitempty" default:"false" validate:"eq=true|eq=false"`
+	IntraNodeVisibility Bool `yaml:"intraNodeVisibility,omitempty" default:"false"`
 
 	// Bastion defines configuration specific for the bastion created with a private clusters.
 	Bastion *GkeBastion `yaml:"bastion,omitempty"` // TODO validate
+
+	// Terraform selects the versions of terraform and of the google providers that the terraform of the cluster
+	// targets.  The syntax of the terraform follows the version of terraform, and the providers are pinned in
+	// versions.tf.  The versions that are not set default to those of the terraform type.
+	Terraform *TerraformSpec `yaml:"terraform,omitempty"`
+
+	// Backend configures where terraform keeps the state of the cluster, which is written to backend.tf.  Without
+	// it the state is kept in the terraform.tfstate file of the directory of the terraform.
+	Backend *BackendSpec `yaml:"backend,omitempty"`
 }
 
 // GkeNetwork wraps a NetworkSpec.
@@ -145,20 +154,46 @@ type GkeNetwork struct {
 type NetworkSpec struct {
 	// SubnetName is the name of the GCP Subnet that is created.
 	SubnetName string `yaml:"subnetName" validate:"required"`
-	// SubnetRange is the base range for the GKE Nodes.
-	SubnetRange string `yaml:"subnetRange" validate:"required,cidrv4"` // TODO calculate these based on nodes
-	// PodSubnetRange is the ip aliased range used for GKE pods.
-	PodSubnetRange string `yaml:"podSubnetRange" validate:"required,cidrv4"`
-	// ServiceSubnetRange is the service subnet that is aliased.
-	ServiceSubnetRange string `yaml:"serviceSubnetRange" validate:"required,cidrv4"`
-	// The IP range in CIDR notation to use for the hosted master network
+	// SubnetRange is the base range for the GKE Nodes.  It is required unless Existing is set.
+	SubnetRange string `yaml:"subnetRange,omitempty" validate:"omitempty,cidrv4"`
+	// PodSubnetRange is the ip aliased range used for GKE pods.  It is required unless Existing is set.
+	PodSubnetRange string `yaml:"podSubnetRange,omitempty" validate:"omitempty,cidrv4"`
+	// ServiceSubnetRange is the service subnet that is aliased.  It is required unless Existing is set.
+	ServiceSubnetRange string `yaml:"serviceSubnetRange,omitempty" validate:"omitempty,cidrv4"`
+	// The IP range in CIDR notation to use for the hosted master network.
+	// It must be a /28 and must not overlap with the other ranges.
 	MasterIPV4CIDRBlock string `yaml:"masterIPV4CIDRBlock" validate:"cidrv4"`
 
-	// TODO test for this - The given master_ipv4_cidr 10.0.0.0/28 overlaps with an existing network 10.0.0.0/24.
+	// Supernet is a CIDR that the empty ranges above are planned in, for example 10.0.0.0/14.
+	// The ranges are sized for the node pools scaled up to their maxCount in every zone.
+	Supernet string `yaml:"supernet,omitempty" validate:"omitempty,cidrv4"`
+	// UsedRanges are CIDRs in the Supernet that are already in use and must not be planned.
+	UsedRanges []string `yaml:"usedRanges,omitempty" validate:"omitempty,dive,cidrv4"`
+
+	// Existing references a network and subnet that are managed outside of gke-tf, for example
+	// in a Shared VPC host project.  The network is named by the metadata name of the GkeNetwork
+	// and the subnet by SubnetName.  No network resources are created, and SubnetRange,
+	// PodSubnetRange, ServiceSubnetRange, Supernet and UsedRanges must not be set.
+	Existing *ExistingNetworkSpec `yaml:"existing,omitempty" validate:"omitempty"`
+
 	// TODO we make have to make MasterIPV4CIDRBlock required if it is a private cluster.  Need more testing.
 
 }
 
+// ExistingNetworkSpec references the secondary ranges of an existing subnet, and the Shared VPC
+// host project that owns it.
+type ExistingNetworkSpec struct {
+	// HostProjectId is the Shared VPC host project that owns the network.  When it is set the
+	// GKE service agent of the cluster project is granted roles/compute.networkUser on the subnet
+	// and roles/container.hostServiceAgentUser in the host project.  It defaults to the cluster
+	// project.
+	HostProjectId string `yaml:"hostProjectId,omitempty"`
+	// PodRangeName is the name of the secondary range in the subnet that is used for GKE pods.
+	PodRangeName string `yaml:"podRangeName" validate:"required"`
+	// ServiceRangeName is the name of the secondary range in the subnet that is used for services.
+	ServiceRangeName string `yaml:"serviceRangeName" validate:"required"`
+}
+
 // GkeBastion wraps a BastionSpec.
 type GkeBastion struct {
 	TypeMeta   `yaml:",inline"`
@@ -195,7 +230,7 @@ type MasterAuthorizedNetworksConfigSpec struct {
 // to BigQuery
 type ResourceUsageExportConfigSpec struct {
 	// Enable network egress metering
-	EnableNetworkEgressMetering *string `yaml:"enableNetworkEgressMetering" default: "false" validate:"eq=false|eq=true"`
+	EnableNetworkEgressMetering Bool `yaml:"enableNetworkEgressMetering" default:"false"`
 	// The BigQuery dataset to send data to
 	DatasetId *string `yaml:"datasetId" validate:"required"`
 }
@@ -213,6 +248,64 @@ type StubDomainsSpec struct {
 	DNSServerIPAddresses []string `yaml:"dnsServerIPAddresses" validate:"required,dive,ipv4"`
 }
 
+// TerraformSpec holds the version constraints of terraform and of the google providers, in the syntax of
+// terraform, such as ">= 0.12" or "~> 2.13".
+type TerraformSpec struct {
+	// RequiredVersion is the version constraint of terraform.  The terraform is written in the syntax of the
+	// oldest version that it allows: the 0.11 syntax, "${var.region}", which only the CFT templates support,
+	// the 0.12 syntax, or that of 0.13, whose required_providers have a source.
+	RequiredVersion string `yaml:"requiredVersion,omitempty"`
+	// GoogleProvider is the version constraint of the google provider.
+	GoogleProvider string `yaml:"googleProvider,omitempty"`
+	// GoogleBetaProvider is the version constraint of the google-beta provider.
+	GoogleBetaProvider string `yaml:"googleBetaProvider,omitempty"`
+}
+
+// BackendSpec holds the backend that keeps the terraform state of a cluster.  Exactly one of GCS, Local and Custom
+// must be set.
+type BackendSpec struct {
+	// GCS keeps the state in a Cloud Storage bucket.
+	GCS *GCSBackendSpec `yaml:"gcs,omitempty" validate:"omitempty,dive"`
+	// Local keeps the state in a file.
+	Local *LocalBackendSpec `yaml:"local,omitempty"`
+	// Custom is any other backend of terraform, such as remote or s3, whose configuration is written as it is.
+	Custom *CustomBackendSpec `yaml:"custom,omitempty" validate:"omitempty,dive"`
+}
+
+// GCSBackendSpec holds the configuration of the gcs backend of terraform.
+type GCSBackendSpec struct {
+	// Bucket is the name of the Cloud Storage bucket that holds the state.
+	Bucket string `yaml:"bucket" validate:"required"`
+	// Prefix is the path of the state in the bucket.  It defaults to the name of the cluster, so that the clusters
+	// can share a bucket.
+	Prefix string `yaml:"prefix,omitempty"`
+	// EncryptionKey is a base64 encoded AES-256 key that encrypts the state.  It is a secret, so it is not written
+	// to backend.tf but to backend.hcl, which is passed to terraform init -backend-config and should not be
+	// committed.  The GOOGLE_ENCRYPTION_KEY environment variable of terraform can set it instead.
+	EncryptionKey string `yaml:"encryptionKey,omitempty"`
+	// Bootstrap writes the terraform that creates the bucket, with versioning and uniform bucket-level access, to
+	// the bootstrap directory.  It is applied once, before the terraform of the cluster.
+	Bootstrap Bool `yaml:"bootstrap,omitempty" default:"false"`
+	// Location is the location of the bucket that the bootstrap terraform creates.  It defaults to the region of
+	// the cluster.
+	Location string `yaml:"location,omitempty"`
+}
+
+// LocalBackendSpec holds the configuration of the local backend of terraform.
+type LocalBackendSpec struct {
+	// Path is the path of the state file, relative to the directory of the terraform.  It defaults to
+	// terraform.tfstate.
+	Path string `yaml:"path,omitempty"`
+}
+
+// CustomBackendSpec holds a backend of terraform that gke-tf passes through.
+type CustomBackendSpec struct {
+	// Type is the type of the backend, such as remote or s3.
+	Type string `yaml:"type" validate:"required"`
+	// Config is the body of the backend block in the terraform language, such as organization = "acme".
+	Config string `yaml:"config,omitempty"`
+}
+
 // WorkloadIdentityConfigSpec holds the cluster-scoped setting for which
 // Identity Namespace to use for this cluster
 // https://cloud.google.com/kubernetes-engine/docs/how-to/workload-identity
@@ -242,24 +335,24 @@ type NodePoolSpec struct {
 	// cluster in a healthy, running state.
 	// See https://cloud.google.com/kubernetes-engine/docs/how-to/node-auto-repair.
 	// This feature defaults to true, by default, and is enabled.
-	AutoRepair *bool `yaml:"autoRepair,omitempty" default:"true"`
+	AutoRepair Bool `yaml:"autoRepair,omitempty" default:"true"`
 	// AutoUpgrade enables Node auto-upgrades help you keep the nodes in your cluster up to date
 	// with the cluster master version when your master is updated on your behalf.
 	// See https://cloud.google.com/kubernetes-engine/docs/how-to/node-auto-upgrades.
 	// This feature defaults to false, and not enabled.
-	AutoUpgrade *bool `yaml:"autoUpgrade,omitempty" default:"false"`
+	AutoUpgrade Bool `yaml:"autoUpgrade,omitempty" default:"false"`
 	// Preemptible causes the nodepool create with Preemptible VMs which are Google
 	// Compute Engine VM instances that last a maximum of 24 hours and
 	// provide no availability guarantees.
 	// See https://cloud.google.com/kubernetes-engine/docs/how-to/preemptible-vms.
 	// Preemptible defaults to false.
-	Preemptible *bool `yaml:"preemptible" default:"false"`
+	Preemptible Bool `yaml:"preemptible" default:"false"`
 	// Version is the GKE version for the nodepool.. This value defaults to 'latest'.
 	// This value will override the version in the parent struct.
 	Version *string `yaml:"version,omitempty"`
 	// DiskSizeGB is the node disk size.
 	// This value defaults to 100.
-	DiskSizeGB int `yaml:"diskSizeGB" default:"100", validate:"gte=10,lte=65536"`
+	DiskSizeGB int `yaml:"diskSizeGB" default:"100" validate:"gte=10,lte=65536"`
 	// DiskType is the node disk type.
 	// Values can be pd-ssd or pd-standard, and it defaults to pd-ssd.
 	DiskType string `yaml:"diskType" default:"pd-ssd" validate:"eq=pd-ssd|eq=pd-standard"`
@@ -279,7 +372,7 @@ type NodePoolSpec struct {
 	// See https://cloud.google.com/kubernetes-engine/docs/how-to/min-cpu-platform
 	// Run `gcloud compute zones describe <zone>` and view the `availableCpuPlatforms`
 	// Valid values today are "Intel Broadwell" or "Intel Haswell"
-	MinCpuPlatform string `yaml:"minCpuPlatform,omitempty" validate="eq='Intel Broadwell'|eq='Intel Haswell'"`
+	MinCpuPlatform string `yaml:"minCpuPlatform,omitempty" validate:"omitempty,eq=Intel Broadwell|eq=Intel Haswell"`
 
 	// Tags slice containing node network tags for this specific nodepool.
 	// See https://cloud.google.com/vpc/docs/add-remove-network-tags.
@@ -307,7 +400,7 @@ type NodePoolSpec struct {
 	ServiceAccount *string `yaml:"serviceAccount" validate:"omitempty,email"`
 	// Gvisor (GKE Sandbox) - Enabled per node pool
 	// https://cloud.google.com/kubernetes-engine/docs/how-to/sandbox-pods
-	Gvisor string `yaml:"gvisor" default:"false" validate:"eq=true|eq=false"`
+	Gvisor Bool `yaml:"gvisor" default:"false"`
 }
 
 // Defines how pods on this node pool can interact (or not) with the GCE Metadata APIs.
@@ -351,7 +444,7 @@ type TaintSpec struct {
 	// Effect is the effect field in a taint.
 	// https://www.terraform.io/docs/providers/google/r/container_cluster.html#taint
 	// NO_SCHEDULE, PREFER_NO_SCHEDULE, and NO_EXECUTE
-	Effect string `yaml:"effect" validate:"eq=NO_SCHEDULE|eq=PREFER_NO_SCHEDULE|eq=NO_EXECUTE`
+	Effect string `yaml:"effect" validate:"eq=NO_SCHEDULE|eq=PREFER_NO_SCHEDULE|eq=NO_EXECUTE"`
 }
 
 // AddonsSpec is struct that contains multiple bool flags that are used to denote which addons are to be installed.
@@ -378,12 +471,12 @@ type AddonsSpec struct {
 	// Istio installs managed istio on the cluster.
 	// Default value for Istio is false
 	// See: https://cloud.google.com/istio/docs/istio-on-gke/overview
-	Istio string `yaml:"istio,omitempty" default:"true" validate:"eq=true|eq=false"`
+	Istio Bool `yaml:"istio,omitempty" default:"true"`
 	// Cloudrun installs managed Cloudrun on the cluster.
 	// Default value for Cloudrun is false
 	//
 	// See  https://cloud.google.com/run/docs/gke/setup.
-	Cloudrun string `yaml:"cloudrun,omitempty" default:"false" validate:"eq=true|eq=false"`
+	Cloudrun Bool `yaml:"cloudrun,omitempty" default:"false"`
 	// Logging enables stack driver logging for the cluster.
 	// Default value for Logging is true.
 	// Automatically send logs from the cluster to the Google Cloud Logging
@@ -405,32 +498,32 @@ type AddonsSpec struct {
 	// Default value for NetworkPolicy is true
 	//
 	// See https://cloud.google.com/kubernetes-engine/docs/how-to/network-policy.
-	NetworkPolicy string `yaml:"networkPolicy,omitempty" default:"true" validate:"eq=true|eq=false"`
+	NetworkPolicy Bool `yaml:"networkPolicy,omitempty" default:"true"`
 	// HPA enables horizontal pod autoscaling for the cluster.
 	// Default value for HPA is true
 	//
 	// See https://cloud.google.com/kubernetes-engine/docs/how-to/scaling-apps.
-	HPA string `yaml:"hpa,omitempty" default:"true" validate:"eq=true|eq=false"`
+	HPA Bool `yaml:"hpa,omitempty" default:"true"`
 	// VPA enables vertical pod autoscaling for the cluster.
 	// Default value for VPA is false.
 	//
 	// See https://cloud.google.com/kubernetes-engine/docs/concepts/verticalpodautoscaler.
-	VPA *bool `yaml:"vpa,omitempty" default:"false"`
+	VPA Bool `yaml:"vpa,omitempty" default:"false"`
 	// ClusterAutoscaling enables cluster nodepool autoscaling.
 	// Default value Autoscaling is true.
 	//
 	// See https://cloud.google.com/kubernetes-engine/docs/concepts/cluster-autoscaler
-	ClusterAutoscaling *bool `yaml:"clusterAutoscaling,omitempty" default:"true"`
+	ClusterAutoscaling Bool `yaml:"clusterAutoscaling,omitempty" default:"true"`
 	// BinaryAuth enables binary authorization for the cluster.
 	// Default value BinaryAuth is true.
 	//
 	// See https://cloud.google.com/binary-authorization/docs/.
-	BinaryAuth *bool `yaml:"binaryAuth,omitempty" default:"true"`
+	BinaryAuth Bool `yaml:"binaryAuth,omitempty" default:"true"`
 
 	// HTTPLoadBalancing enables HTTP Load Balancing for the cluster.
 	// Default value HTTPLoadBalancing is true.
 	// TODO figure out what this actually is, cannot find it in gcloud
-	HTTPLoadBalancing *bool `yaml:"httpLoadBalancing,omitempty" default:"true"`
+	HTTPLoadBalancing Bool `yaml:"httpLoadBalancing,omitempty" default:"true"`
 	// PodSecurityPolicy enables Pod Security Policy for the Cluster.
 	// Default value PodSecurityPolicy is false.
 	// Enables the pod security policy admission controller for the cluster.
@@ -440,18 +533,20 @@ type AddonsSpec struct {
 	// API objects. For more information, see
 	//
 	// https://cloud.google.com/kubernetes-engine/docs/how-to/pod-security-policies.
-	PodSecurityPolicy *bool `yaml:"podSecurityPolicy,omitempty" default:"false"`
+	PodSecurityPolicy Bool `yaml:"podSecurityPolicy,omitempty" default:"false"`
 }
 
 // TypeMeta is metadata that all resources must have, which includes all objects
 // users must create.
 type TypeMeta struct {
+	// APIVersion defines the versioned schema of this representation of an object.
+	// See Versions for the supported versions of a GkeTF, which defaults to gke-tf.dev/v1alpha1.
+	APIVersion string `yaml:"apiVersion,omitempty" protobuf:"bytes,2,opt,name=apiVersion"`
+
 	// Kind is a string value representing the REST resource this object represents.
 	// Servers may infer this from the endpoint the client submits requests to.
+	// A GkeTF must be of kind gke-cluster.
 	Kind string `yaml:"kind,omitempty" protobuf:"bytes,1,opt,name=kind"`
-
-	// APIVersion defines the versioned schema of this representation of an object.
-	APIVersion string `yaml:"apiVersion,omitempty" protobuf:"bytes,2,opt,name=apiVersion"`
 }
 
 // ObjectMeta is metadata that all resources must have, which includes all objects
@@ -478,18 +573,24 @@ type ObjectMeta struct {
 	Annotations map[string]string `yaml:"annotations,omitempty" protobuf:"bytes,12,rep,name=annotations"`
 }
 
-// unmarshalConfigurationFile reads the YAML file, configFile, and executes
-// yaml.UnmarshalStrict, loading the value into spec.
+// unmarshalConfigurationFile reads the YAML file, configFile, converts it to the
+// HubVersion and executes yaml.UnmarshalStrict, loading the value into spec.
 func UnmarshalGkeTF(configFile string) (gkeTf *GkeTF, err error) {
 	gkeTf = &GkeTF{}
 	yamlFile, err := ioutil.ReadFile(configFile)
 	if err != nil {
 		return nil, err
 	}
+	if yamlFile, err = upgradeDocuments(yamlFile); err != nil {
+		return nil, err
+	}
 	err = yaml.UnmarshalStrict(yamlFile, gkeTf)
 	if err != nil {
 		return nil, err
 	}
+	if err := checkTypeMeta(&gkeTf.TypeMeta); err != nil {
+		return nil, err
+	}
 
 	return gkeTf, nil
 }
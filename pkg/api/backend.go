@@ -0,0 +1,92 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"encoding/base64"
+	"regexp"
+	"strings"
+)
+
+// encryptionKeySize is the size of the AES-256 key of the gcs backend, in bytes.
+const encryptionKeySize = 32
+
+// bucketName matches the names of Cloud Storage buckets without dots, which are at most 63
+// characters long and start and end with a letter or a digit.  Names with dots are domain names
+// and need their owner to be verified, so they are not supported.
+var bucketName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{1,61}[a-z0-9]$`)
+
+// backendType matches the types of the backends of terraform, such as s3 or etcdv3.
+var backendType = regexp.MustCompile(`^[a-z][a-z0-9]*$`)
+
+// validateBackend checks that a single backend is set, and the fields that terraform would only
+// reject when it initializes the backend.  The required fields are checked by the struct
+// validation.
+func validateBackend(spec *ClusterSpec) Diagnostics {
+	backend := spec.Backend
+	if backend == nil {
+		return nil
+	}
+
+	set := 0
+	for _, isSet := range []bool{backend.GCS != nil, backend.Local != nil, backend.Custom != nil} {
+		if isSet {
+			set++
+		}
+	}
+	if set != 1 {
+		return Diagnostics{{
+			Path:    "spec.backend",
+			Message: "must set exactly one of gcs, local and custom",
+		}}
+	}
+
+	var diags Diagnostics
+	if gcs := backend.GCS; gcs != nil {
+		if gcs.Bucket != "" && (!bucketName.MatchString(gcs.Bucket) || strings.HasPrefix(gcs.Bucket, "goog")) {
+			diags = append(diags, &Diagnostic{
+				Path:    "spec.backend.gcs.bucket",
+				Value:   gcs.Bucket,
+				Message: "is not a valid bucket name, of 3 to 63 lower case letters, digits, dashes and underscores",
+			})
+		}
+		if gcs.EncryptionKey != "" {
+			if key, err := base64.StdEncoding.DecodeString(gcs.EncryptionKey); err != nil || len(key) != encryptionKeySize {
+				// the key is not printed, it is a secret
+				diags = append(diags, &Diagnostic{
+					Path:    "spec.backend.gcs.encryptionKey",
+					Message: "must be a base64 encoded AES-256 key",
+				})
+			}
+		}
+		if gcs.Location != "" && !gcs.Bootstrap.IsTrue() {
+			diags = append(diags, &Diagnostic{
+				Path:    "spec.backend.gcs.location",
+				Value:   gcs.Location,
+				Message: "is the location of the bucket that bootstrap creates, but bootstrap is not set",
+			})
+		}
+	}
+	if custom := backend.Custom; custom != nil && custom.Type != "" && !backendType.MatchString(custom.Type) {
+		diags = append(diags, &Diagnostic{
+			Path:    "spec.backend.custom.type",
+			Value:   custom.Type,
+			Message: "is not the type of a terraform backend, such as remote or s3",
+		})
+	}
+	return diags
+}
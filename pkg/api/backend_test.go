@@ -0,0 +1,107 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateBackend(t *testing.T) {
+	key := "MTIzNDU2Nzg5MDEyMzQ1Njc4OTAxMjM0NTY3ODkwMTI="
+	for _, test := range []struct {
+		name     string
+		backend  *BackendSpec
+		expected []string
+	}{
+		{
+			name:    "gcs",
+			backend: &BackendSpec{GCS: &GCSBackendSpec{Bucket: "my-state", EncryptionKey: key, Bootstrap: NewBool(true), Location: "US"}},
+		},
+		{
+			name:    "local",
+			backend: &BackendSpec{Local: &LocalBackendSpec{}},
+		},
+		{
+			name:    "custom",
+			backend: &BackendSpec{Custom: &CustomBackendSpec{Type: "remote", Config: `organization = "acme"`}},
+		},
+		{
+			name:     "none",
+			backend:  &BackendSpec{},
+			expected: []string{"spec.backend"},
+		},
+		{
+			name:     "two",
+			backend:  &BackendSpec{GCS: &GCSBackendSpec{Bucket: "my-state"}, Local: &LocalBackendSpec{}},
+			expected: []string{"spec.backend"},
+		},
+		{
+			name:     "bucket name",
+			backend:  &BackendSpec{GCS: &GCSBackendSpec{Bucket: "My_State."}},
+			expected: []string{"spec.backend.gcs.bucket"},
+		},
+		{
+			name:     "google bucket name",
+			backend:  &BackendSpec{GCS: &GCSBackendSpec{Bucket: "google-state"}},
+			expected: []string{"spec.backend.gcs.bucket"},
+		},
+		{
+			name:     "encryption key",
+			backend:  &BackendSpec{GCS: &GCSBackendSpec{Bucket: "my-state", EncryptionKey: "c2VjcmV0"}},
+			expected: []string{"spec.backend.gcs.encryptionKey"},
+		},
+		{
+			name:     "custom type",
+			backend:  &BackendSpec{Custom: &CustomBackendSpec{Type: "Remote Backend"}},
+			expected: []string{"spec.backend.custom.type"},
+		},
+		{
+			name:     "location without bootstrap",
+			backend:  &BackendSpec{GCS: &GCSBackendSpec{Bucket: "my-state", Location: "US"}},
+			expected: []string{"spec.backend.gcs.location"},
+		},
+	} {
+		gkeTF := parseYAML(t, configFile)
+		if err := SetApiDefaultValues(gkeTF); err != nil {
+			t.Fatalf("failed %v", err)
+		}
+		gkeTF.Spec.Backend = test.backend
+
+		diags := validateBackend(&gkeTF.Spec)
+		var paths []string
+		for _, d := range diags {
+			paths = append(paths, d.Path)
+			if strings.Contains(d.String(), "c2VjcmV0") {
+				t.Errorf("%s: the encryption key is printed: %s", test.name, d)
+			}
+		}
+		if strings.Join(paths, " ") != strings.Join(test.expected, " ") {
+			t.Errorf("%s: expected diagnostics for %v, got %v", test.name, test.expected, diags)
+		}
+	}
+
+	// the bucket is required by the struct validation
+	gkeTF := parseYAML(t, configFile)
+	if err := SetApiDefaultValues(gkeTF); err != nil {
+		t.Fatalf("failed %v", err)
+	}
+	gkeTF.Spec.Backend = &BackendSpec{GCS: &GCSBackendSpec{}}
+	if err := ValidateYamlInput(gkeTF); err == nil {
+		t.Error("expected an error for a gcs backend without a bucket")
+	}
+}
@@ -0,0 +1,115 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Bool is a boolean that may be left unset, so that a default value can be
+// told apart from a value set to false.  The zero value is unset.
+//
+// In YAML a Bool can be written as true or false, as the strings "true" and
+// "false", or as yes, no, on and off.  In templates a Bool prints as true or
+// false, and the IsTrue and IsSet methods can be used in conditions:
+//
+//	{{ if .Spec.Private.IsTrue }}
+type Bool int8
+
+const (
+	// Unset is a Bool that is not set.
+	Unset Bool = iota
+	// False is a Bool that is set to false.
+	False
+	// True is a Bool that is set to true.
+	True
+)
+
+// NewBool returns a Bool that is set to b.
+func NewBool(b bool) Bool {
+	if b {
+		return True
+	}
+	return False
+}
+
+// ParseBool parses true, false, yes, no, on and off, in any case.  An empty
+// string is Unset.
+func ParseBool(s string) (Bool, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "":
+		return Unset, nil
+	case "true", "yes", "on":
+		return True, nil
+	case "false", "no", "off":
+		return False, nil
+	}
+	return Unset, fmt.Errorf("%q is not a boolean, use true or false", s)
+}
+
+// IsSet returns true if b is set to true or false.
+func (b Bool) IsSet() bool {
+	return b != Unset
+}
+
+// IsTrue returns true if b is set to true.
+func (b Bool) IsTrue() bool {
+	return b == True
+}
+
+// String returns "true" or "false", or an empty string if b is not set.
+func (b Bool) String() string {
+	switch b {
+	case True:
+		return "true"
+	case False:
+		return "false"
+	}
+	return ""
+}
+
+// UnmarshalYAML decodes a YAML boolean, or a string that ParseBool accepts.
+func (b *Bool) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var value interface{}
+	if err := unmarshal(&value); err != nil {
+		return err
+	}
+	switch v := value.(type) {
+	case nil:
+		*b = Unset
+	case bool:
+		*b = NewBool(v)
+	case string:
+		parsed, err := ParseBool(v)
+		if err != nil {
+			return err
+		}
+		*b = parsed
+	default:
+		return fmt.Errorf("%v is not a boolean, use true or false", value)
+	}
+	return nil
+}
+
+// MarshalYAML encodes b as a YAML boolean, or null if it is not set.
+func (b Bool) MarshalYAML() (interface{}, error) {
+	if !b.IsSet() {
+		return nil, nil
+	}
+	return b.IsTrue(), nil
+}
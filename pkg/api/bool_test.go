@@ -0,0 +1,94 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+type boolHolder struct {
+	Value Bool `yaml:"value,omitempty"`
+}
+
+func TestBoolUnmarshal(t *testing.T) {
+	tests := []struct {
+		source string
+		want   Bool
+	}{
+		{source: `value: true`, want: True},
+		{source: `value: false`, want: False},
+		{source: `value: "true"`, want: True},
+		{source: `value: "false"`, want: False},
+		{source: `value: yes`, want: True},
+		{source: `value: "no"`, want: False},
+		{source: `value: "On"`, want: True},
+		{source: `value: ""`, want: Unset},
+		{source: `value:`, want: Unset},
+		{source: `{}`, want: Unset},
+	}
+
+	for _, test := range tests {
+		holder := &boolHolder{}
+		if err := yaml.UnmarshalStrict([]byte(test.source), holder); err != nil {
+			t.Fatalf("%s: %v", test.source, err)
+		}
+		if holder.Value != test.want {
+			t.Errorf("%s: got %q, want %q", test.source, holder.Value, test.want)
+		}
+	}
+}
+
+func TestBoolUnmarshalInvalid(t *testing.T) {
+	for _, source := range []string{`value: maybe`, `value: 1`, `value: [true]`} {
+		holder := &boolHolder{}
+		if err := yaml.UnmarshalStrict([]byte(source), holder); err == nil {
+			t.Errorf("%s: expected an error", source)
+		}
+	}
+}
+
+func TestBoolMarshal(t *testing.T) {
+	tests := []struct {
+		value Bool
+		want  string
+	}{
+		{value: True, want: "value: true\n"},
+		{value: False, want: "value: false\n"},
+		{value: Unset, want: "{}\n"},
+	}
+
+	for _, test := range tests {
+		b, err := yaml.Marshal(&boolHolder{Value: test.value})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != test.want {
+			t.Errorf("%q: got %q, want %q", test.value, b, test.want)
+		}
+	}
+}
+
+func TestBoolString(t *testing.T) {
+	if True.String() != "true" || False.String() != "false" || Unset.String() != "" {
+		t.Fatalf("unexpected strings %q %q %q", True, False, Unset)
+	}
+	if !False.IsSet() || Unset.IsSet() || !True.IsTrue() || False.IsTrue() {
+		t.Fatal("unexpected IsSet or IsTrue")
+	}
+}
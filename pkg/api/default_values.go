@@ -17,94 +17,200 @@ limitations under the License.
 package api
 
 import (
-	"github.com/creasty/defaults"
-	"github.com/imdario/mergo"
-	"k8s.io/klog"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
 )
 
-// SetApiDefaultValues creates default ClusterSpec and its children and merges the default values into
-// the clusterSpec values parsed from the user provided YAML.
+// boolType is the type of the api Bool.
+var boolType = reflect.TypeOf(Unset)
+
+// SetApiDefaultValues sets the fields of gkeTF, its addons and its node pools that are not set
+// to the value of their default tag.  A field is not set when it holds its zero value, which for
+// a Bool is Unset, so a Bool that is set to false keeps its value.
 // This func allows for gen to provide default values as set in api.ClusterSpec definition.
-func SetApiDefaultValues(gkeTF *GkeTF, configFile string) error {
-
-	// The defaults library does not support bool pointers.
-	// So we have to make a copy and then copy the original value back.
-	original, err := UnmarshalGkeTF(configFile)
-	if err != nil {
-		klog.Errorf("error creating copy of gke api: %v", err)
-		return err
+func SetApiDefaultValues(gkeTF *GkeTF) error {
+	if gkeTF.Spec.Addons == nil {
+		gkeTF.Spec.Addons = &AddonsSpec{}
 	}
+	return setDefaults(reflect.ValueOf(gkeTF))
+}
 
-	defaultSpec := &GkeTF{
-		Spec: ClusterSpec{
-			Addons: &AddonsSpec{},
-		},
+// setDefaults walks v and sets every struct field that has a default tag and is not set.
+// Pointers to structs and slices are walked as well, so nested specs get their defaults.
+func setDefaults(v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if !v.IsNil() {
+			return setDefaults(v.Elem())
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			if err := setDefaults(v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Field(i)
+			if !field.CanSet() {
+				continue
+			}
+			if value, ok := t.Field(i).Tag.Lookup("default"); ok && isZero(field) {
+				if err := setDefault(field, value); err != nil {
+					return fmt.Errorf("error setting the default of %s.%s: %v", t.Name(), t.Field(i).Name, err)
+				}
+			}
+			if err := setDefaults(field); err != nil {
+				return err
+			}
+		}
 	}
+	return nil
+}
 
-	defaultNodePool := &GkeNodePool{
-		Spec: NodePoolSpec{},
+// setDefault parses value into field.  Slices, maps and structs are parsed as JSON.
+func setDefault(field reflect.Value, value string) error {
+	if field.Type() == boolType {
+		b, err := ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.Set(reflect.ValueOf(b))
+		return nil
 	}
 
-	if err := defaults.Set(defaultSpec); err != nil {
-		klog.Errorf("error setting defaults for defaultSepc: %v", err)
-		return err
-	}
-	if err := defaults.Set(&defaultNodePool.Spec); err != nil {
-		klog.Errorf("error setting defaults for defaultNodePool.Spec: %v", err)
-		return err
-	}
-	if err := defaults.Set(defaultSpec.Spec.Addons); err != nil {
-		klog.Errorf("error setting defaults for defaultSpec.Spec.Addons: %v", err)
-		return err
+	switch field.Kind() {
+	case reflect.Ptr:
+		ptr := reflect.New(field.Type().Elem())
+		if err := setDefault(ptr.Elem(), value); err != nil {
+			return err
+		}
+		field.Set(ptr)
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case reflect.Slice, reflect.Map, reflect.Struct:
+		return json.Unmarshal([]byte(value), field.Addr().Interface())
+	default:
+		return fmt.Errorf("unsupported type %s", field.Type())
 	}
+	return nil
+}
 
-	if gkeTF.Spec.Addons == nil {
-		gkeTF.Spec.Addons = &AddonsSpec{}
+// isZero returns true if v holds the zero value of its type.
+func isZero(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Map, reflect.Interface:
+		return v.IsNil()
+	case reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
 	}
+	return false
+}
 
-	if err := mergo.Merge(&gkeTF.Spec, &defaultSpec.Spec); err != nil {
-		klog.Errorf("error gkeTF: %v", err)
-		return err
-	}
+// SetFields returns the YAML paths of the fields of gkeTF that hold a value other than their
+// default, such as spec.nodePools[1].spec.gvisor.  Structs and lists of structs are walked, so
+// the paths are those of their fields, and a field that is set to its default is left out.
+func SetFields(gkeTF *GkeTF) ([]string, error) {
+	return setFields(reflect.ValueOf(gkeTF), "")
+}
 
-	originalNodePools := *original.Spec.NodePools
-	for i, nodePool := range *gkeTF.Spec.NodePools {
-		if err := mergo.Merge(&nodePool.Spec, &defaultNodePool.Spec); err != nil {
-			klog.Errorf("error merging nodePoolSpec: %v", err)
-			return err
-		}
-		originalNodePool := originalNodePools[i]
-		if originalNodePool.Spec.AutoRepair != nil {
-			nodePool.Spec.AutoRepair = originalNodePool.Spec.AutoRepair
+func setFields(v reflect.Value, path string) ([]string, error) {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil, nil
 		}
+		v = v.Elem()
+	}
 
-		if originalNodePool.Spec.AutoUpgrade != nil {
-			nodePool.Spec.AutoUpgrade = originalNodePool.Spec.AutoUpgrade
+	var paths []string
+	switch {
+	case v.Kind() == reflect.Struct:
+		t := v.Type()
+		for i := 0; i < v.NumField(); i++ {
+			field := t.Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			fieldPath := path
+			if name := yamlFieldName(field); name != "" {
+				if fieldPath != "" {
+					fieldPath += "."
+				}
+				fieldPath += name
+			} else if !strings.Contains(field.Tag.Get("yaml"), "inline") {
+				continue
+			}
+
+			if value, ok := field.Tag.Lookup("default"); ok {
+				set, err := differsFromDefault(v.Field(i), value)
+				if err != nil {
+					return nil, fmt.Errorf("error reading the default of %s.%s: %v", t.Name(), field.Name, err)
+				}
+				if !set {
+					continue
+				}
+			}
+			fieldPaths, err := setFields(v.Field(i), fieldPath)
+			if err != nil {
+				return nil, err
+			}
+			paths = append(paths, fieldPaths...)
 		}
-
+	case v.Kind() == reflect.Slice && isStruct(v.Type().Elem()):
+		for i := 0; i < v.Len(); i++ {
+			itemPaths, err := setFields(v.Index(i), fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return nil, err
+			}
+			paths = append(paths, itemPaths...)
+		}
+	case !isZero(v) && !isEmpty(v):
+		paths = append(paths, path)
 	}
+	return paths, nil
+}
 
-	// Go through and reset values overwritten by defaults
-	if original.Spec.RemoveDefaultNodePool != nil {
-		*gkeTF.Spec.RemoveDefaultNodePool = *original.Spec.RemoveDefaultNodePool
+// differsFromDefault returns true if field is set to a value other than its default.
+func differsFromDefault(field reflect.Value, value string) (bool, error) {
+	if isZero(field) {
+		return false, nil
 	}
-	if original.Spec.Addons != nil {
-		if original.Spec.Addons.VPA != nil {
-			*gkeTF.Spec.Addons.VPA = *original.Spec.Addons.VPA
-		}
-		if original.Spec.Addons.PodSecurityPolicy != nil {
-			*gkeTF.Spec.Addons.PodSecurityPolicy = *original.Spec.Addons.PodSecurityPolicy
-		}
-		if original.Spec.Addons.HTTPLoadBalancing != nil {
-			*gkeTF.Spec.Addons.HTTPLoadBalancing = *original.Spec.Addons.HTTPLoadBalancing
-		}
-		if original.Spec.Addons.BinaryAuth != nil {
-			*gkeTF.Spec.Addons.BinaryAuth = *original.Spec.Addons.BinaryAuth
-		}
-		if original.Spec.Addons.ClusterAutoscaling != nil {
-			*gkeTF.Spec.Addons.ClusterAutoscaling = *original.Spec.Addons.ClusterAutoscaling
-		}
+	defaultValue := reflect.New(field.Type()).Elem()
+	if err := setDefault(defaultValue, value); err != nil {
+		return false, err
 	}
+	return !reflect.DeepEqual(field.Interface(), defaultValue.Interface()), nil
+}
 
-	return nil
+// isStruct returns true if t is a struct or a pointer to one.
+func isStruct(t reflect.Type) bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct
+}
+
+// isEmpty returns true if v is an empty list or map.
+func isEmpty(v reflect.Value) bool {
+	return (v.Kind() == reflect.Slice || v.Kind() == reflect.Map) && v.Len() == 0
 }
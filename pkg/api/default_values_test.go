@@ -31,17 +31,17 @@ func TestDefaults(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	if err := SetApiDefaultValues(gkeTF, configFile); err != nil {
+	if err := SetApiDefaultValues(gkeTF); err != nil {
 		t.Fatalf("error merging defaults: %v", gkeTF)
 	}
 
-	if gkeTF.Spec.Private == "false" {
+	if !gkeTF.Spec.Private.IsTrue() {
 		t.Fatal("gkeTF.Spec.Private is not set to true and it should be")
 	}
 
-	t.Logf("*gkeTF.Spec.Addons.ClusterAutoscaling: %v", *gkeTF.Spec.Addons.ClusterAutoscaling)
-	if *gkeTF.Spec.Addons.ClusterAutoscaling != false {
-		t.Fatal("*gkeTF.Spec.Addons.ClusterAutoscaling is not false")
+	t.Logf("gkeTF.Spec.Addons.ClusterAutoscaling: %v", gkeTF.Spec.Addons.ClusterAutoscaling)
+	if gkeTF.Spec.Addons.ClusterAutoscaling != False {
+		t.Fatal("gkeTF.Spec.Addons.ClusterAutoscaling is not false")
 	}
 
 	if gkeTF.Spec.OauthScopes == nil {
@@ -59,7 +59,7 @@ func TestDefaultsSmall(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	if err := SetApiDefaultValues(gkeTF, configFile); err != nil {
+	if err := SetApiDefaultValues(gkeTF); err != nil {
 		t.Fatalf("error merging defaults: %v", gkeTF)
 	}
 
@@ -72,3 +72,78 @@ func TestDefaultsSmall(t *testing.T) {
 	}
 
 }
+
+func TestDefaultsKeepSetValues(t *testing.T) {
+
+	var configFile = "../../examples/example.yaml"
+	gkeTF, err := UnmarshalGkeTF(configFile)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gkeTF.Spec.ResourceUsageExportConfig = &ResourceUsageExportConfigSpec{}
+	(*gkeTF.Spec.NodePools)[0].Spec.AutoRepair = False
+
+	if err := SetApiDefaultValues(gkeTF); err != nil {
+		t.Fatalf("error merging defaults: %v", err)
+	}
+
+	if gkeTF.Spec.Regional != False {
+		t.Fatalf("gkeTF.Spec.Regional is %q, it should be false", gkeTF.Spec.Regional)
+	}
+	if gkeTF.Spec.RemoveDefaultNodePool != True {
+		t.Fatalf("gkeTF.Spec.RemoveDefaultNodePool is %q, it should default to true", gkeTF.Spec.RemoveDefaultNodePool)
+	}
+	if gkeTF.Spec.DeployUsingPrivateEndpoint.IsSet() {
+		t.Fatal("gkeTF.Spec.DeployUsingPrivateEndpoint has no default and should not be set")
+	}
+	if gkeTF.Spec.ResourceUsageExportConfig.EnableNetworkEgressMetering != False {
+		t.Fatal("nested defaults are not set")
+	}
+	if gkeTF.Spec.ServiceAccount == nil || *gkeTF.Spec.ServiceAccount != "create" {
+		t.Fatal("gkeTF.Spec.ServiceAccount should default to create")
+	}
+
+	nodePool := (*gkeTF.Spec.NodePools)[0].Spec
+	if nodePool.AutoRepair != False {
+		t.Fatal("the node pool autoRepair should stay false")
+	}
+	if nodePool.MachineType == "" || nodePool.DiskSizeGB == 0 || nodePool.OauthScopes == nil {
+		t.Fatalf("node pool defaults are not set: %+v", nodePool)
+	}
+}
+
+func TestSetFields(t *testing.T) {
+	gkeTF, err := UnmarshalGkeTF("../../examples/min-example.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gkeTF.Spec.Tpu = False
+	gkeTF.Spec.Alpha = True
+	(*gkeTF.Spec.NodePools)[0].Spec.Gvisor = True
+	if err := SetApiDefaultValues(gkeTF); err != nil {
+		t.Fatal(err)
+	}
+	gkeTF.Spec.Addons.Cloudrun = True
+
+	paths, err := SetFields(gkeTF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	set := map[string]bool{}
+	for _, path := range paths {
+		set[path] = true
+	}
+	for _, path := range []string{"kind", "metadata.name", "spec.alpha", "spec.addons.cloudrun", "spec.nodePools[0].spec.gvisor"} {
+		if !set[path] {
+			t.Errorf("%s is not in %v", path, paths)
+		}
+	}
+	// fields that hold their default are left out
+	for _, path := range []string{"spec.tpu", "spec.defaultMaxPodsPerNode", "spec.nodePools[0].spec.oauthScopes"} {
+		if set[path] {
+			t.Errorf("%s is set to its default, but it is in %v", path, paths)
+		}
+	}
+}
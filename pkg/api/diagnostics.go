@@ -0,0 +1,330 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gopkg.in/go-playground/validator.v9"
+	"gopkg.in/yaml.v3"
+)
+
+// Diagnostic describes a single problem found in a GkeTF document.
+type Diagnostic struct {
+	// Path is the YAML path of the offending field, for example
+	// spec.nodePools[1].spec.diskType.
+	Path string
+	// Line and Column locate the field in the YAML source. They are zero until
+	// Locate is called, and stay zero if no part of the path is in the source.
+	Line   int
+	Column int
+	// Value is the offending value.
+	Value interface{}
+	// Message is a human readable explanation of the rule that failed.
+	Message string
+}
+
+// String formats the diagnostic as "path: message (value: x)".
+func (d *Diagnostic) String() string {
+	s := fmt.Sprintf("%s: %s", d.Path, d.Message)
+	if v := formatValue(d.Value); v != "" {
+		s = fmt.Sprintf("%s (value: %s)", s, v)
+	}
+	return s
+}
+
+// Diagnostics is a list of problems found in a GkeTF document.  It implements
+// error so it can be returned from the validation funcs.
+type Diagnostics []*Diagnostic
+
+// Error joins all of the diagnostics, one per line.
+func (diags Diagnostics) Error() string {
+	lines := make([]string, len(diags))
+	for i, d := range diags {
+		lines[i] = d.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Locate sets the Line and Column of each diagnostic by finding its Path in
+// the YAML source.  If a field is missing from the source, for instance
+// because its value comes from a default, the closest parent that does exist
+// is used.
+func (diags Diagnostics) Locate(source []byte) error {
+	return diags.LocateDocument(source, 0)
+}
+
+// LocateDocument is Locate for the document at index in a YAML source that
+// holds several documents.  Lines are counted from the start of the source.
+func (diags Diagnostics) LocateDocument(source []byte, index int) error {
+	decoder := yaml.NewDecoder(bytes.NewReader(source))
+	var doc yaml.Node
+	for i := 0; i <= index; i++ {
+		doc = yaml.Node{}
+		if err := decoder.Decode(&doc); err == io.EOF {
+			// there is nothing to locate the diagnostics in
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+	if len(doc.Content) == 0 {
+		return nil
+	}
+	for _, d := range diags {
+		if n := findNode(doc.Content[0], d.Path); n != nil {
+			d.Line = n.Line
+			d.Column = n.Column
+		}
+	}
+	return nil
+}
+
+// findNode walks a YAML path like spec.nodePools[1].spec.diskType and returns
+// the deepest node that matches, or nil if nothing matches.
+func findNode(root *yaml.Node, path string) *yaml.Node {
+	var found *yaml.Node
+	current := root
+	for _, segment := range splitPath(path) {
+		next, position := childNode(current, segment)
+		if next == nil {
+			break
+		}
+		current = next
+		found = position
+	}
+	return found
+}
+
+// childNode returns the value of segment in node, along with the node that
+// best marks where segment is written in the source. For mapping keys this is
+// the key itself.
+func childNode(node *yaml.Node, segment string) (value *yaml.Node, position *yaml.Node) {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == segment {
+				return node.Content[i+1], node.Content[i]
+			}
+		}
+	case yaml.SequenceNode:
+		index, err := strconv.Atoi(segment)
+		if err == nil && index >= 0 && index < len(node.Content) {
+			return node.Content[index], node.Content[index]
+		}
+	}
+	return nil, nil
+}
+
+// splitPath turns spec.nodePools[1].spec into [spec nodePools 1 spec].
+func splitPath(path string) []string {
+	var segments []string
+	for _, part := range strings.Split(path, ".") {
+		for {
+			open := strings.Index(part, "[")
+			if open < 0 {
+				break
+			}
+			if open > 0 {
+				segments = append(segments, part[:open])
+			}
+			end := strings.Index(part, "]")
+			if end < open {
+				break
+			}
+			segments = append(segments, part[open+1:end])
+			part = part[end+1:]
+		}
+		if part != "" {
+			segments = append(segments, part)
+		}
+	}
+	return segments
+}
+
+// StringValues returns the text fields of gkeTF that are set, keyed by their YAML path, such as
+// spec.nodePools[0].spec.machineType.  Each entry of a map is a field, such as spec.labels.env.
+// The values are those that the templates print, so an error in the rendered terraform can be
+// traced back to the field that caused it.
+func StringValues(gkeTF *GkeTF) map[string]string {
+	values := map[string]string{}
+	stringValues(reflect.ValueOf(gkeTF), "", values)
+	return values
+}
+
+func stringValues(v reflect.Value, path string, values map[string]string) {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < v.NumField(); i++ {
+			field := t.Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			fieldPath := path
+			if name := yamlFieldName(field); name != "" {
+				if fieldPath != "" {
+					fieldPath += "."
+				}
+				fieldPath += name
+			} else if !strings.Contains(field.Tag.Get("yaml"), "inline") {
+				continue
+			}
+			stringValues(v.Field(i), fieldPath, values)
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			stringValues(v.Index(i), fmt.Sprintf("%s[%d]", path, i), values)
+		}
+	case reflect.Map:
+		for _, key := range v.MapKeys() {
+			if key.Kind() == reflect.String {
+				stringValues(v.MapIndex(key), path+"."+key.String(), values)
+			}
+		}
+	case reflect.String:
+		if v.String() != "" {
+			values[path] = v.String()
+		}
+	}
+}
+
+// yamlFieldName returns the name that a struct field has in YAML.
+func yamlFieldName(field reflect.StructField) string {
+	name := strings.SplitN(field.Tag.Get("yaml"), ",", 2)[0]
+	if name == "-" {
+		return ""
+	}
+	return name
+}
+
+// newDiagnostic converts a validator.FieldError into a Diagnostic. prefix
+// replaces the name of the struct that was validated.
+func newDiagnostic(prefix string, fe validator.FieldError) *Diagnostic {
+	path := fe.Namespace()
+	if i := strings.Index(path, "."); i >= 0 {
+		path = prefix + path[i:]
+	}
+	d := &Diagnostic{
+		Path:    path,
+		Message: explainRule(fe),
+	}
+	// a missing value is explanation enough for a required field
+	if fe.Tag() != "required" {
+		d.Value = fe.Value()
+	}
+	return d
+}
+
+// explainRule returns a human readable explanation of the validation rule
+// that failed.
+func explainRule(fe validator.FieldError) string {
+	tag := fe.Tag()
+	if strings.Contains(tag, "|") {
+		var allowed []string
+		for _, alt := range strings.Split(tag, "|") {
+			allowed = append(allowed, strings.TrimPrefix(alt, "eq="))
+		}
+		return "must be one of: " + strings.Join(allowed, ", ")
+	}
+
+	param := fe.Param()
+	isString := fe.Kind() == reflect.String
+	switch tag {
+	case "required":
+		return "is required"
+	case "eq":
+		return fmt.Sprintf("must be %s", param)
+	case "cidrv4":
+		return "must be an IPv4 CIDR block, for example 10.0.0.0/24"
+	case "ipv4":
+		return "must be an IPv4 address"
+	case "email":
+		return "must be an email address"
+	case "gt":
+		if isString {
+			return fmt.Sprintf("must be longer than %s characters", param)
+		}
+		return fmt.Sprintf("must be greater than %s", param)
+	case "gte":
+		if isString {
+			return fmt.Sprintf("must be at least %s characters long", param)
+		}
+		return fmt.Sprintf("must be greater than or equal to %s", param)
+	case "lt":
+		if isString {
+			return fmt.Sprintf("must be shorter than %s characters", param)
+		}
+		return fmt.Sprintf("must be less than %s", param)
+	case "lte":
+		if isString {
+			return fmt.Sprintf("must be at most %s characters long", param)
+		}
+		return fmt.Sprintf("must be less than or equal to %s", param)
+	case "gtefield":
+		return fmt.Sprintf("must be greater than or equal to %s", lowerFirst(param))
+	case "ltefield":
+		return fmt.Sprintf("must be less than or equal to %s", lowerFirst(param))
+	default:
+		return fmt.Sprintf("failed the %q rule", tag)
+	}
+}
+
+// lowerFirst turns a Go field name such as MaxCount into its YAML name.
+func lowerFirst(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToLower(s[:1]) + s[1:]
+}
+
+// formatValue renders a diagnostic value for display.  Empty values are
+// rendered as an empty string so that they are left out.
+func formatValue(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Slice, reflect.Map:
+		if v.IsNil() {
+			return ""
+		}
+	}
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if v.Kind() == reflect.String {
+		return strconv.Quote(v.String())
+	}
+	return fmt.Sprintf("%v", v.Interface())
+}
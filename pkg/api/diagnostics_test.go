@@ -0,0 +1,136 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiagnosticPaths(t *testing.T) {
+	gkeTF := parseYAML(t, configFile)
+
+	if err := SetApiDefaultValues(gkeTF); err != nil {
+		t.Fatalf("failed %v", err)
+	}
+
+	nodePools := *gkeTF.Spec.NodePools
+	nodePools[1].Spec.DiskType = "pd-foo"
+	gkeTF.Spec.Network.Spec.PodSubnetRange = "bad"
+
+	err := ValidateYamlInput(gkeTF)
+	diags, ok := err.(Diagnostics)
+	if !ok {
+		t.Fatalf("expected Diagnostics, got %T: %v", err, err)
+	}
+
+	paths := map[string]*Diagnostic{}
+	for _, d := range diags {
+		paths[d.Path] = d
+	}
+
+	d, ok := paths["spec.nodePools[1].spec.diskType"]
+	if !ok {
+		t.Fatalf("missing diskType diagnostic in %v", diags)
+	}
+	if d.Value != "pd-foo" {
+		t.Fatalf("unexpected value %v", d.Value)
+	}
+	if d.Message != "must be one of: pd-ssd, pd-standard" {
+		t.Fatalf("unexpected message %q", d.Message)
+	}
+
+	if _, ok := paths["spec.network.spec.podSubnetRange"]; !ok {
+		t.Fatalf("missing podSubnetRange diagnostic in %v", diags)
+	}
+}
+
+func TestDiagnosticsLocate(t *testing.T) {
+	source := []byte(`kind: gke-cluster
+spec:
+  region: us-west1
+  nodePools:
+    - metadata:
+        name: one
+    - metadata:
+        name: two
+      spec:
+        diskType: pd-foo
+`)
+
+	diags := Diagnostics{
+		{Path: "spec.nodePools[1].spec.diskType"},
+		// imageType is not in the source, so the closest parent is used
+		{Path: "spec.nodePools[0].metadata.imageType"},
+		{Path: "status.missing"},
+	}
+	if err := diags.Locate(source); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := [][]int{{10, 9}, {5, 7}, {0, 0}}
+	for i, d := range diags {
+		if got := []int{d.Line, d.Column}; !reflect.DeepEqual(got, expected[i]) {
+			t.Errorf("%s: expected line and column %v, got %v", d.Path, expected[i], got)
+		}
+	}
+}
+
+func TestDiagnosticsLocateDocument(t *testing.T) {
+	source := []byte(`kind: gke-cluster
+spec:
+  region: us-west1
+---
+kind: gke-cluster
+spec:
+  region: us-east1
+`)
+
+	diags := Diagnostics{{Path: "spec.region"}}
+	if err := diags.LocateDocument(source, 1); err != nil {
+		t.Fatal(err)
+	}
+	if diags[0].Line != 7 || diags[0].Column != 3 {
+		t.Fatalf("expected line 7 column 3, got %d %d", diags[0].Line, diags[0].Column)
+	}
+}
+
+func TestSplitPath(t *testing.T) {
+	got := splitPath("spec.nodePools[1].spec.taints[0].key")
+	expected := []string{"spec", "nodePools", "1", "spec", "taints", "0", "key"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestStringValues(t *testing.T) {
+	gkeTF := parseYAML(t, configFile)
+	gkeTF.Spec.Labels = &map[string]string{"env": "prod"}
+
+	values := StringValues(gkeTF)
+	for path, expected := range map[string]string{
+		"metadata.name":                      gkeTF.Name,
+		"spec.nodePools[1].metadata.name":    (*gkeTF.Spec.NodePools)[1].Name,
+		"spec.network.spec.subnetRange":      gkeTF.Spec.Network.Spec.SubnetRange,
+		"spec.labels.env":                    "prod",
+		"spec.nodePools[0].spec.machineType": (*gkeTF.Spec.NodePools)[0].Spec.MachineType,
+	} {
+		if values[path] != expected {
+			t.Errorf("%s: expected %q, got %q", path, expected, values[path])
+		}
+	}
+}
@@ -0,0 +1,170 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Document is a GkeTF read from one document of a YAML file.
+type Document struct {
+	// GkeTF is the cluster that the document describes.
+	GkeTF *GkeTF
+	// File is the name of the file that the document was read from.
+	File string
+	// Index is the position of the document in the file, starting at zero.
+	Index int
+}
+
+// String names the document by its file, and its index when the file holds
+// more than one document.
+func (d *Document) String() string {
+	if d.Index == 0 {
+		return d.File
+	}
+	return fmt.Sprintf("%s[%d]", d.File, d.Index)
+}
+
+// UnmarshalDocuments reads every GkeTF from path.  path is either a YAML file
+// that may hold several documents separated by ---, or a directory whose .yaml
+// and .yml files are read in name order.  Empty documents are skipped.
+//
+// Every file is read even if an earlier one fails.  The documents that could
+// be read are returned along with an error that lists each file that failed.
+func UnmarshalDocuments(path string) ([]*Document, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []string{path}
+	if info.IsDir() {
+		files, err = yamlFiles(path)
+		if err != nil {
+			return nil, err
+		}
+		if len(files) == 0 {
+			return nil, fmt.Errorf("no .yaml or .yml files found in %s", path)
+		}
+	}
+
+	var documents []*Document
+	var failures []string
+	for _, file := range files {
+		fileDocuments, err := unmarshalFile(file)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", file, err))
+		}
+		documents = append(documents, fileDocuments...)
+	}
+
+	if err := checkClusterNames(documents); err != nil {
+		failures = append(failures, err.Error())
+	}
+	if len(failures) > 0 {
+		return documents, fmt.Errorf("unable to read the configuration:\n%s", strings.Join(failures, "\n"))
+	}
+	return documents, nil
+}
+
+// unmarshalFile converts each document in file to the HubVersion and strictly decodes it.  The documents that
+// come before a document that fails to decode are returned with the error.
+func unmarshalFile(file string) ([]*Document, error) {
+	source, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	if source, err = upgradeDocuments(source); err != nil {
+		return nil, err
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(source))
+	decoder.SetStrict(true)
+
+	var documents []*Document
+	for index := 0; ; index++ {
+		gkeTF := &GkeTF{}
+		if err := decoder.Decode(gkeTF); err == io.EOF {
+			return documents, nil
+		} else if err != nil {
+			return documents, fmt.Errorf("document %d: %v", index, err)
+		}
+		// skip empty documents, such as the one after a trailing ---
+		if reflect.DeepEqual(gkeTF, &GkeTF{}) {
+			continue
+		}
+		if err := checkTypeMeta(&gkeTF.TypeMeta); err != nil {
+			return documents, fmt.Errorf("document %d: %v", index, err)
+		}
+		documents = append(documents, &Document{GkeTF: gkeTF, File: file, Index: index})
+	}
+}
+
+// yamlFiles lists the .yaml and .yml files in dir in name order.
+func yamlFiles(dir string) ([]string, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, info := range infos {
+		ext := filepath.Ext(info.Name())
+		if info.IsDir() || (ext != ".yaml" && ext != ".yml") {
+			continue
+		}
+		files = append(files, filepath.Join(dir, info.Name()))
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// checkClusterNames makes sure that every cluster has a unique metadata.name,
+// since the name is used for its output directory.
+func checkClusterNames(documents []*Document) error {
+	var problems []string
+	seen := map[string]*Document{}
+	for _, d := range documents {
+		name := d.GkeTF.Name
+		if name == "" {
+			problems = append(problems, fmt.Sprintf("%s: metadata.name is required", d))
+			continue
+		}
+		if name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+			problems = append(problems, fmt.Sprintf("%s: metadata.name %s can not be used as a directory name", d, name))
+			continue
+		}
+		if first, ok := seen[name]; ok {
+			problems = append(problems, fmt.Sprintf("%s: metadata.name %s is also used by %s", d, name, first))
+			continue
+		}
+		seen[name] = d
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%s", strings.Join(problems, "\n"))
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFile(t *testing.T, dir, name, content string) string {
+	file := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	return file
+}
+
+func TestUnmarshalDocuments(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gke-tf")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	example, err := ioutil.ReadFile(configFile)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	other := strings.Replace(string(example), "test-cluster", "other-cluster", 1)
+	file := writeFile(t, dir, "clusters.yaml", string(example)+"---\n---\n"+other+"---\n")
+
+	documents, err := UnmarshalDocuments(file)
+	if err != nil {
+		t.Fatalf("failed %v", err)
+	}
+	if len(documents) != 2 {
+		t.Fatalf("expected 2 documents, got %d", len(documents))
+	}
+	// the empty document is skipped but still counted
+	if documents[1].GkeTF.Name != "other-cluster" || documents[1].Index != 2 {
+		t.Fatalf("unexpected document %s %s", documents[1], documents[1].GkeTF.Name)
+	}
+
+	// a directory reads every yaml file, and cluster names must be unique
+	writeFile(t, dir, "another.yml", string(example))
+	writeFile(t, dir, "README.md", "not a cluster")
+	documents, err = UnmarshalDocuments(dir)
+	if err == nil || !strings.Contains(err.Error(), "metadata.name test-cluster is also used by") {
+		t.Fatalf("expected a duplicate name error, got %v", err)
+	}
+	if len(documents) != 3 {
+		t.Fatalf("expected 3 documents, got %d", len(documents))
+	}
+}
+
+func TestUnmarshalDocumentsStrict(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gke-tf")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeFile(t, dir, "a.yaml", "kind: gke-cluster\nmetadata:\n  name: a\nspec:\n  unknown: true\n")
+	writeFile(t, dir, "b.yaml", "kind: gke-cluster\nmetadata:\n  name: b\n")
+
+	// the second file is read even though the first one fails
+	documents, err := UnmarshalDocuments(dir)
+	if err == nil || !strings.Contains(err.Error(), "a.yaml: document 0") {
+		t.Fatalf("expected an error for a.yaml, got %v", err)
+	}
+	if len(documents) != 1 || documents[0].GkeTF.Name != "b" {
+		t.Fatalf("expected cluster b to be read, got %v", documents)
+	}
+}
@@ -0,0 +1,298 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+)
+
+const (
+	// masterCIDRPrefix is the only prefix length GKE accepts for the master range.
+	masterCIDRPrefix = 28
+	// reservedSubnetAddresses is the number of addresses GCP reserves in every subnet.
+	reservedSubnetAddresses = 4
+	// defaultRegionalZones is the number of zones GKE uses for a regional cluster
+	// when no zones are given.
+	defaultRegionalZones = 3
+	// fallbackMaxPodsPerNode is used when neither the node pool nor the cluster
+	// sets a maximum number of pods per node.
+	fallbackMaxPodsPerNode = 110
+)
+
+// NetworkCapacity describes how many nodes the ranges in a NetworkSpec can hold,
+// and how many the node pools in a ClusterSpec may need.
+type NetworkCapacity struct {
+	// SubnetNodes is the maximum number of nodes that fit in SubnetRange.
+	SubnetNodes int64
+	// PodNodes is the maximum number of nodes that fit in PodSubnetRange, keyed by
+	// the maximum number of pods per node.  GKE gives each node a slice of the pod
+	// range that is twice the size of its maximum number of pods, rounded up to a
+	// power of two.
+	PodNodes map[int]int64
+	// Services is the number of service IPs in ServiceSubnetRange.
+	Services int64
+	// MaxNodes is the number of nodes the node pools can scale up to.
+	MaxNodes int64
+	// PodAddresses is the number of pod range addresses needed when every node pool
+	// is scaled up to its maxCount.
+	PodAddresses int64
+	// PodRangeSize is the number of addresses in PodSubnetRange.
+	PodRangeSize int64
+}
+
+// String prints the capacity of each range, one per line.
+func (c *NetworkCapacity) String() string {
+	var lines []string
+	lines = append(lines, fmt.Sprintf("subnetRange supports a maximum of %d nodes", c.SubnetNodes))
+
+	var maxPods []int
+	for pods := range c.PodNodes {
+		maxPods = append(maxPods, pods)
+	}
+	sort.Ints(maxPods)
+	for _, pods := range maxPods {
+		lines = append(lines, fmt.Sprintf("podSubnetRange supports a maximum of %d nodes with %d pods per node", c.PodNodes[pods], pods))
+	}
+
+	lines = append(lines, fmt.Sprintf("serviceSubnetRange supports a maximum of %d services", c.Services))
+	lines = append(lines, fmt.Sprintf("node pools scale up to %d nodes that need %d of %d pod addresses", c.MaxNodes, c.PodAddresses, c.PodRangeSize))
+	return strings.Join(lines, "\n")
+}
+
+// CalculateNetworkCapacity works out how many nodes each range in the cluster
+// network supports. Ranges that are empty or not valid CIDRs are left at zero.
+func CalculateNetworkCapacity(spec *ClusterSpec) *NetworkCapacity {
+	c := &NetworkCapacity{
+		PodNodes: map[int]int64{},
+	}
+	if spec.Network == nil {
+		return c
+	}
+	network := spec.Network.Spec
+
+	if subnet := parseCIDR(network.SubnetRange); subnet != nil {
+		c.SubnetNodes = cidrSize(subnet) - reservedSubnetAddresses
+		if c.SubnetNodes < 0 {
+			c.SubnetNodes = 0
+		}
+	}
+	if services := parseCIDR(network.ServiceSubnetRange); services != nil {
+		c.Services = cidrSize(services)
+	}
+	if pods := parseCIDR(network.PodSubnetRange); pods != nil {
+		c.PodRangeSize = cidrSize(pods)
+	}
+
+	zones := zoneCount(spec)
+	if spec.NodePools != nil {
+		for _, nodePool := range *spec.NodePools {
+			if nodePool == nil {
+				continue
+			}
+			maxPods := maxPodsPerNode(spec, &nodePool.Spec)
+			nodes := int64(nodePool.Spec.MaxCount) * zones
+			c.MaxNodes += nodes
+			c.PodAddresses += nodes * PodSliceSize(maxPods)
+			c.PodNodes[maxPods] = c.PodRangeSize / PodSliceSize(maxPods)
+		}
+	}
+	if len(c.PodNodes) == 0 {
+		maxPods := maxPodsPerNode(spec, nil)
+		c.PodNodes[maxPods] = c.PodRangeSize / PodSliceSize(maxPods)
+	}
+
+	return c
+}
+
+// validateNetwork checks the ranges of the cluster network against each other
+// and against the size of the node pools.  Ranges that are not valid CIDRs are
+// reported by the struct validation and are skipped here.
+//
+// The subnet, pod and service ranges are required for a network that gke-tf
+// creates, and must not be set for an existing network.
+func validateNetwork(spec *ClusterSpec) Diagnostics {
+	if spec.Network == nil {
+		return nil
+	}
+	network := spec.Network.Spec
+
+	var diags Diagnostics
+	if network.Existing != nil {
+		diags = append(diags, validateExistingNetwork(spec.Network)...)
+	} else {
+		for _, r := range []struct{ name, value string }{
+			{name: "subnetRange", value: network.SubnetRange},
+			{name: "podSubnetRange", value: network.PodSubnetRange},
+			{name: "serviceSubnetRange", value: network.ServiceSubnetRange},
+		} {
+			if r.value == "" {
+				diags = append(diags, &Diagnostic{
+					Path:    "spec.network.spec." + r.name,
+					Message: "is required unless existing is set",
+				})
+			}
+		}
+	}
+
+	type namedRange struct {
+		name  string
+		value string
+		ipNet *net.IPNet
+	}
+	var ranges []namedRange
+	for _, r := range []namedRange{
+		{name: "subnetRange", value: network.SubnetRange},
+		{name: "podSubnetRange", value: network.PodSubnetRange},
+		{name: "serviceSubnetRange", value: network.ServiceSubnetRange},
+		{name: "masterIPV4CIDRBlock", value: network.MasterIPV4CIDRBlock},
+	} {
+		if r.ipNet = parseCIDR(r.value); r.ipNet != nil {
+			ranges = append(ranges, r)
+		}
+	}
+
+	for i, a := range ranges {
+		for _, b := range ranges[i+1:] {
+			if a.ipNet.Contains(b.ipNet.IP) || b.ipNet.Contains(a.ipNet.IP) {
+				diags = append(diags, &Diagnostic{
+					Path:    "spec.network.spec." + b.name,
+					Value:   b.value,
+					Message: fmt.Sprintf("overlaps with %s %s", a.name, a.value),
+				})
+			}
+		}
+	}
+
+	if master := parseCIDR(network.MasterIPV4CIDRBlock); master != nil {
+		if ones, _ := master.Mask.Size(); ones != masterCIDRPrefix {
+			diags = append(diags, &Diagnostic{
+				Path:    "spec.network.spec.masterIPV4CIDRBlock",
+				Value:   network.MasterIPV4CIDRBlock,
+				Message: fmt.Sprintf("must be a /%d range", masterCIDRPrefix),
+			})
+		}
+	}
+
+	capacity := CalculateNetworkCapacity(spec)
+	if parseCIDR(network.SubnetRange) != nil && capacity.MaxNodes > capacity.SubnetNodes {
+		diags = append(diags, &Diagnostic{
+			Path:  "spec.network.spec.subnetRange",
+			Value: network.SubnetRange,
+			Message: fmt.Sprintf("supports a maximum of %d nodes but the node pools scale up to %d nodes",
+				capacity.SubnetNodes, capacity.MaxNodes),
+		})
+	}
+	if parseCIDR(network.PodSubnetRange) != nil && capacity.PodAddresses > capacity.PodRangeSize {
+		diags = append(diags, &Diagnostic{
+			Path:  "spec.network.spec.podSubnetRange",
+			Value: network.PodSubnetRange,
+			Message: fmt.Sprintf("has %d addresses but the node pools need %d pod addresses when scaled up to %d nodes",
+				capacity.PodRangeSize, capacity.PodAddresses, capacity.MaxNodes),
+		})
+	}
+
+	return diags
+}
+
+// validateExistingNetwork rejects the fields that can not apply to a network
+// that is managed outside of gke-tf.  Its ranges are looked up by name.
+func validateExistingNetwork(network *GkeNetwork) Diagnostics {
+	var diags Diagnostics
+	if network.Name == "" {
+		diags = append(diags, &Diagnostic{
+			Path:    "spec.network.metadata.name",
+			Message: "is required when existing is set, it names the existing network",
+		})
+	}
+
+	for _, f := range []struct {
+		name  string
+		value interface{}
+		set   bool
+	}{
+		{name: "subnetRange", value: network.Spec.SubnetRange, set: network.Spec.SubnetRange != ""},
+		{name: "podSubnetRange", value: network.Spec.PodSubnetRange, set: network.Spec.PodSubnetRange != ""},
+		{name: "serviceSubnetRange", value: network.Spec.ServiceSubnetRange, set: network.Spec.ServiceSubnetRange != ""},
+		{name: "supernet", value: network.Spec.Supernet, set: network.Spec.Supernet != ""},
+		{name: "usedRanges", value: network.Spec.UsedRanges, set: len(network.Spec.UsedRanges) > 0},
+	} {
+		if f.set {
+			diags = append(diags, &Diagnostic{
+				Path:    "spec.network.spec." + f.name,
+				Value:   f.value,
+				Message: "must not be set when existing is set, the ranges of an existing network are referenced by name",
+			})
+		}
+	}
+	return diags
+}
+
+// zoneCount returns the number of zones each node pool is created in.  Node
+// pool counts apply to each zone.
+func zoneCount(spec *ClusterSpec) int64 {
+	if spec.Zones != nil && len(*spec.Zones) > 0 {
+		return int64(len(*spec.Zones))
+	}
+	if spec.Regional.IsTrue() {
+		return defaultRegionalZones
+	}
+	return 1
+}
+
+// maxPodsPerNode returns the maximum number of pods per node for a node pool,
+// falling back to the cluster DefaultMaxPodsPerNode.
+func maxPodsPerNode(spec *ClusterSpec, nodePool *NodePoolSpec) int {
+	if nodePool != nil && nodePool.MaxPodsPerNode > 0 {
+		return int(nodePool.MaxPodsPerNode)
+	}
+	if spec.DefaultMaxPodsPerNode > 0 {
+		return int(spec.DefaultMaxPodsPerNode)
+	}
+	return fallbackMaxPodsPerNode
+}
+
+// PodSliceSize is the number of pod range addresses GKE gives each node: twice
+// the maximum number of pods, rounded up to a power of two.  See
+// https://cloud.google.com/kubernetes-engine/docs/how-to/flexible-pod-cidr
+func PodSliceSize(maxPods int) int64 {
+	size := int64(1)
+	for size < int64(2*maxPods) {
+		size <<= 1
+	}
+	return size
+}
+
+// parseCIDR returns the network of an IPv4 CIDR, or nil if it is not one.
+func parseCIDR(cidr string) *net.IPNet {
+	if cidr == "" {
+		return nil
+	}
+	_, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil || ipNet.IP.To4() == nil {
+		return nil
+	}
+	return ipNet
+}
+
+// cidrSize is the number of addresses in a network.
+func cidrSize(ipNet *net.IPNet) int64 {
+	ones, bits := ipNet.Mask.Size()
+	return int64(1) << uint(bits-ones)
+}
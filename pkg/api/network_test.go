@@ -0,0 +1,132 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNetworkOverlap(t *testing.T) {
+	gkeTF := parseYAML(t, configFile)
+	if err := SetApiDefaultValues(gkeTF); err != nil {
+		t.Fatalf("failed %v", err)
+	}
+
+	gkeTF.Spec.Network.Spec.MasterIPV4CIDRBlock = "10.0.0.0/28"
+
+	diags := validateNetwork(&gkeTF.Spec)
+	if len(diags) != 1 {
+		t.Fatalf("expected a single diagnostic, got %v", diags)
+	}
+	if diags[0].Path != "spec.network.spec.masterIPV4CIDRBlock" {
+		t.Fatalf("unexpected path %s", diags[0].Path)
+	}
+	if !strings.Contains(diags[0].Message, "subnetRange 10.0.0.0/24") {
+		t.Fatalf("unexpected message %s", diags[0].Message)
+	}
+
+	if err := ValidateYamlInput(gkeTF); err == nil {
+		t.Fatal("this should have failed, the master range overlaps the subnet")
+	}
+}
+
+func TestNetworkMasterPrefix(t *testing.T) {
+	gkeTF := parseYAML(t, configFile)
+	if err := SetApiDefaultValues(gkeTF); err != nil {
+		t.Fatalf("failed %v", err)
+	}
+
+	gkeTF.Spec.Network.Spec.MasterIPV4CIDRBlock = "172.16.0.0/24"
+
+	diags := validateNetwork(&gkeTF.Spec)
+	if len(diags) != 1 || diags[0].Message != "must be a /28 range" {
+		t.Fatalf("expected a /28 diagnostic, got %v", diags)
+	}
+}
+
+func TestNetworkCapacity(t *testing.T) {
+	gkeTF := parseYAML(t, configFile)
+	if err := SetApiDefaultValues(gkeTF); err != nil {
+		t.Fatalf("failed %v", err)
+	}
+
+	capacity := CalculateNetworkCapacity(&gkeTF.Spec)
+
+	// a /24 less the 4 addresses reserved by GCP
+	if capacity.SubnetNodes != 252 {
+		t.Fatalf("expected 252 subnet nodes, got %d", capacity.SubnetNodes)
+	}
+	// a /16 split into /25 slices for 64 pods and /24 slices for 110 pods
+	if capacity.PodNodes[64] != 512 || capacity.PodNodes[110] != 256 {
+		t.Fatalf("unexpected pod nodes %v", capacity.PodNodes)
+	}
+	if capacity.Services != 4096 {
+		t.Fatalf("expected 4096 services, got %d", capacity.Services)
+	}
+	// two zones, with 10 and 1 nodes per zone
+	if capacity.MaxNodes != 22 {
+		t.Fatalf("expected 22 nodes, got %d", capacity.MaxNodes)
+	}
+	if capacity.PodAddresses != 20*128+2*256 {
+		t.Fatalf("unexpected pod addresses %d", capacity.PodAddresses)
+	}
+
+	// the pod range can not hold 20 * 128 + 2 * 256 addresses
+	gkeTF.Spec.Network.Spec.PodSubnetRange = "10.1.0.0/21"
+	diags := validateNetwork(&gkeTF.Spec)
+	if len(diags) != 1 || diags[0].Path != "spec.network.spec.podSubnetRange" {
+		t.Fatalf("expected a pod range diagnostic, got %v", diags)
+	}
+}
+
+func TestPodSliceSize(t *testing.T) {
+	for maxPods, expected := range map[int]int64{8: 16, 16: 32, 32: 64, 64: 128, 65: 256, 110: 256} {
+		if got := PodSliceSize(maxPods); got != expected {
+			t.Errorf("%d pods: expected %d, got %d", maxPods, expected, got)
+		}
+	}
+}
+
+func TestNetworkExisting(t *testing.T) {
+	configFile := "../../examples/shared-vpc-example.yaml"
+	gkeTF := parseYAML(t, configFile)
+	if err := SetApiDefaultValues(gkeTF); err != nil {
+		t.Fatalf("failed %v", err)
+	}
+	gkeTF.Spec.ProjectId = "my-service-project"
+
+	if err := ValidateYamlInput(gkeTF); err != nil {
+		t.Fatalf("failed %v", err)
+	}
+
+	// ranges can not be set for an existing network
+	gkeTF.Spec.Network.Spec.PodSubnetRange = "10.1.0.0/16"
+	gkeTF.Spec.Network.Spec.Supernet = "10.0.0.0/14"
+	diags := validateNetwork(&gkeTF.Spec)
+	if len(diags) != 2 || diags[0].Path != "spec.network.spec.podSubnetRange" || diags[1].Path != "spec.network.spec.supernet" {
+		t.Fatalf("expected podSubnetRange and supernet diagnostics, got %v", diags)
+	}
+
+	// and are required for a network that is created
+	gkeTF.Spec.Network.Spec.Existing = nil
+	gkeTF.Spec.Network.Spec.Supernet = ""
+	diags = validateNetwork(&gkeTF.Spec)
+	if len(diags) != 2 || diags[0].Path != "spec.network.spec.subnetRange" || diags[1].Path != "spec.network.spec.serviceSubnetRange" {
+		t.Fatalf("expected subnetRange and serviceSubnetRange diagnostics, got %v", diags)
+	}
+}
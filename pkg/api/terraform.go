@@ -0,0 +1,306 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// TerraformSyntax is a version of the terraform language that the terraform of a cluster is
+// written in.
+type TerraformSyntax int
+
+const (
+	// Terraform011 is the syntax of terraform 0.11, whose expressions are interpolated in
+	// strings, "${var.region}", and whose providers are pinned by their blocks.
+	Terraform011 TerraformSyntax = iota
+	// Terraform012 is the syntax of terraform 0.12, whose expressions are first class and whose
+	// required_providers are version constraints.
+	Terraform012
+	// Terraform013 is the syntax of terraform 0.13, whose required_providers also have a source.
+	Terraform013
+)
+
+// String returns the version of terraform of the syntax, such as 0.12.
+func (syntax TerraformSyntax) String() string {
+	switch syntax {
+	case Terraform011:
+		return "0.11"
+	case Terraform012:
+		return "0.12"
+	}
+	return "0.13"
+}
+
+var (
+	terraform012 = version{0, 12, 0}
+	terraform013 = version{0, 13, 0}
+	// googleProviders012 is the first version of the google providers that supports terraform
+	// 0.12.
+	googleProviders012 = version{2, 5, 0}
+	// googleProviders3 is the first version of the google providers that requires terraform 0.12.
+	googleProviders3 = version{3, 0, 0}
+	// googleBeta4 is the first version of the google-beta provider without the identity_namespace
+	// of workload identity and the node_metadata of node pools.
+	googleBeta4 = version{4, 0, 0}
+)
+
+// WithDefaults returns the constraints of spec, with those of defaults for the ones that spec does
+// not set.  spec may be nil.
+func (spec *TerraformSpec) WithDefaults(defaults TerraformSpec) *TerraformSpec {
+	merged := defaults
+	if spec == nil {
+		return &merged
+	}
+	if spec.RequiredVersion != "" {
+		merged.RequiredVersion = spec.RequiredVersion
+	}
+	if spec.GoogleProvider != "" {
+		merged.GoogleProvider = spec.GoogleProvider
+	}
+	if spec.GoogleBetaProvider != "" {
+		merged.GoogleBetaProvider = spec.GoogleBetaProvider
+	}
+	return &merged
+}
+
+// Syntax returns the syntax of the oldest version of terraform that RequiredVersion allows, or
+// an error if it is not a valid version constraint.
+func (spec *TerraformSpec) Syntax() (TerraformSyntax, error) {
+	c, err := parseConstraint(spec.RequiredVersion)
+	if err != nil {
+		return 0, fmt.Errorf("terraform version %q: %v", spec.RequiredVersion, err)
+	}
+	if c.allowsBelow(terraform012) {
+		return Terraform011, nil
+	}
+	if c.allowsBelow(terraform013) {
+		return Terraform012, nil
+	}
+	return Terraform013, nil
+}
+
+// validateTerraform checks the version constraints of spec.terraform, and rejects the versions
+// of terraform and of the providers that do not work together, or with the fields of the
+// cluster.  Only the constraints that are set are checked, the defaults of the terraform types
+// work with each other.
+func validateTerraform(spec *ClusterSpec) Diagnostics {
+	if spec.Terraform == nil {
+		return nil
+	}
+
+	var diags Diagnostics
+	parse := func(name, value string) *versionConstraint {
+		if value == "" {
+			return nil
+		}
+		c, err := parseConstraint(value)
+		if err != nil {
+			diags = append(diags, &Diagnostic{
+				Path:    "spec.terraform." + name,
+				Value:   value,
+				Message: err.Error(),
+			})
+			return nil
+		}
+		return c
+	}
+	terraform := parse("requiredVersion", spec.Terraform.RequiredVersion)
+	providers := []struct {
+		name       string
+		provider   string
+		value      string
+		constraint *versionConstraint
+	}{
+		{"googleProvider", "google", spec.Terraform.GoogleProvider, parse("googleProvider", spec.Terraform.GoogleProvider)},
+		{"googleBetaProvider", "google-beta", spec.Terraform.GoogleBetaProvider, parse("googleBetaProvider", spec.Terraform.GoogleBetaProvider)},
+	}
+
+	for _, p := range providers {
+		if terraform == nil || p.constraint == nil {
+			continue
+		}
+		if !terraform.allowsBelow(terraform012) && !p.constraint.allowsFrom(googleProviders012) {
+			diags = append(diags, &Diagnostic{
+				Path:  "spec.terraform." + p.name,
+				Value: p.value,
+				Message: fmt.Sprintf("only allows %s providers before %s, which do not support the terraform 0.12 or later that requiredVersion %q allows",
+					p.provider, googleProviders012, spec.Terraform.RequiredVersion),
+			})
+		}
+		if !terraform.allowsFrom(terraform012) && !p.constraint.allowsBelow(googleProviders3) {
+			diags = append(diags, &Diagnostic{
+				Path:  "spec.terraform." + p.name,
+				Value: p.value,
+				Message: fmt.Sprintf("only allows %s providers from %s, which require terraform 0.12, but requiredVersion %q only allows terraform 0.11",
+					p.provider, googleProviders3, spec.Terraform.RequiredVersion),
+			})
+		}
+	}
+
+	if beta := providers[1].constraint; beta != nil && !beta.allowsBelow(googleBeta4) {
+		message := fmt.Sprintf("is not supported by google-beta %s or later, which spec.terraform.googleBetaProvider %q requires",
+			googleBeta4, spec.Terraform.GoogleBetaProvider)
+		if spec.WorkloadIdentityConfig != nil {
+			diags = append(diags, &Diagnostic{
+				Path:    "spec.workloadIdentityConfig.identityNamespace",
+				Value:   spec.WorkloadIdentityConfig.IdentityNamespace,
+				Message: message,
+			})
+		}
+		if spec.NodePools != nil {
+			for i, nodePool := range *spec.NodePools {
+				if nodePool == nil || nodePool.Spec.WorkloadMetadataConfig == nil {
+					continue
+				}
+				diags = append(diags, &Diagnostic{
+					Path:    fmt.Sprintf("spec.nodePools[%d].spec.workloadMetadataConfig.nodeMetadata", i),
+					Value:   nodePool.Spec.WorkloadMetadataConfig.NodeMetadata,
+					Message: message,
+				})
+			}
+		}
+	}
+	return diags
+}
+
+// version is the major, minor and patch numbers of a version of terraform or of a provider.
+type version [3]int
+
+// parseVersion parses a version such as 0.12.26 or 2.13, and returns it with the number of
+// its parts.  The parts that are missing are zero.
+func parseVersion(s string) (version, int, error) {
+	var v version
+	parts := strings.Split(strings.TrimPrefix(s, "v"), ".")
+	if len(parts) > len(v) {
+		return v, 0, fmt.Errorf("%q is not a version, it has more than %d parts", s, len(v))
+	}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return v, 0, fmt.Errorf("%q is not a version, such as 0.12.26", s)
+		}
+		v[i] = n
+	}
+	return v, len(parts), nil
+}
+
+// less returns true if v is before w.
+func (v version) less(w version) bool {
+	for i := range v {
+		if v[i] != w[i] {
+			return v[i] < w[i]
+		}
+	}
+	return false
+}
+
+// String returns the version as major.minor.patch.
+func (v version) String() string {
+	return fmt.Sprintf("%d.%d.%d", v[0], v[1], v[2])
+}
+
+// versionConstraint is the range of versions that a version constraint of terraform allows,
+// such as ">= 0.12, < 0.14".  The versions that != excludes are not tracked, since they do not
+// change the oldest or the newest version that a constraint allows.
+type versionConstraint struct {
+	min          version
+	minInclusive bool
+	// max is nil if there is no newest version.
+	max          *version
+	maxInclusive bool
+}
+
+// parseConstraint parses a version constraint, whose comma separated parts each have an
+// operator, =, !=, >, >=, <, <= or ~>, and a version.  A part without an operator is =.
+func parseConstraint(s string) (*versionConstraint, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, fmt.Errorf("is not a version constraint, such as \">= 0.12\"")
+	}
+	c := &versionConstraint{minInclusive: true}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		operator := ""
+		for _, op := range []string{">=", "<=", "~>", "!=", ">", "<", "="} {
+			if strings.HasPrefix(part, op) {
+				operator = op
+				part = strings.TrimSpace(strings.TrimPrefix(part, op))
+				break
+			}
+		}
+		v, n, err := parseVersion(part)
+		if err != nil {
+			return nil, err
+		}
+		switch operator {
+		case "", "=":
+			c.atLeast(v, true)
+			c.atMost(v, true)
+		case ">=":
+			c.atLeast(v, true)
+		case ">":
+			c.atLeast(v, false)
+		case "<=":
+			c.atMost(v, true)
+		case "<":
+			c.atMost(v, false)
+		case "~>":
+			// only the last part that is given may increase: ~> 0.12 allows 0.12 to 1.0, and
+			// ~> 2.13.0 allows 2.13.0 to 2.14
+			upper := version{v[0] + 1}
+			if n > 1 {
+				upper = v
+				upper[n-2]++
+				for i := n - 1; i < len(upper); i++ {
+					upper[i] = 0
+				}
+			}
+			c.atLeast(v, true)
+			c.atMost(upper, false)
+		}
+	}
+	if c.max != nil && (c.max.less(c.min) || *c.max == c.min && !(c.minInclusive && c.maxInclusive)) {
+		return nil, fmt.Errorf("allows no version")
+	}
+	return c, nil
+}
+
+// atLeast raises the oldest version that c allows to v.
+func (c *versionConstraint) atLeast(v version, inclusive bool) {
+	if c.min.less(v) || v == c.min && !inclusive {
+		c.min, c.minInclusive = v, inclusive
+	}
+}
+
+// atMost lowers the newest version that c allows to v.
+func (c *versionConstraint) atMost(v version, inclusive bool) {
+	if c.max == nil || v.less(*c.max) || v == *c.max && !inclusive {
+		c.max, c.maxInclusive = &v, inclusive
+	}
+}
+
+// allowsBelow returns true if c allows a version before v.
+func (c *versionConstraint) allowsBelow(v version) bool {
+	return c.min.less(v)
+}
+
+// allowsFrom returns true if c allows v or a later version.
+func (c *versionConstraint) allowsFrom(v version) bool {
+	return c.max == nil || v.less(*c.max) || v == *c.max && c.maxInclusive
+}
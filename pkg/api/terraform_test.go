@@ -0,0 +1,163 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTerraformSyntax(t *testing.T) {
+	for _, test := range []struct {
+		constraint string
+		expected   TerraformSyntax
+	}{
+		{"0.11.14", Terraform011},
+		{"~> 0.11", Terraform011},
+		{">= 0.11, < 0.13", Terraform011},
+		{">= 0.12", Terraform012},
+		{"> 0.11.14", Terraform011},
+		{"~> 0.12.29", Terraform012},
+		{"= 0.12.0", Terraform012},
+		{">= 0.12, != 0.12.1", Terraform012},
+		{">= 0.13", Terraform013},
+		{"v1.0.0", Terraform013},
+		{"< 2.0, >= 1.3", Terraform013},
+	} {
+		spec := &TerraformSpec{RequiredVersion: test.constraint}
+		syntax, err := spec.Syntax()
+		if err != nil {
+			t.Fatalf("%s: %v", test.constraint, err)
+		}
+		if syntax != test.expected {
+			t.Errorf("%s: expected the %s syntax, got %s", test.constraint, test.expected, syntax)
+		}
+	}
+
+	for _, constraint := range []string{"", "latest", ">= 0.12.x", "1.2.3.4", "> 0.12, < 0.12", "~> 0.12, < 0.12.0"} {
+		spec := &TerraformSpec{RequiredVersion: constraint}
+		if _, err := spec.Syntax(); err == nil {
+			t.Errorf("%q: expected an error", constraint)
+		}
+	}
+}
+
+func TestVersionConstraint(t *testing.T) {
+	for _, test := range []struct {
+		constraint string
+		below      bool
+		from       bool
+	}{
+		{">= 2.0", true, true},
+		{"2.13.0", false, true},
+		{"~> 2.4", true, true},
+		{"~> 2.4.0", true, false},
+		{"< 2.5.0", true, false},
+		{"<= 2.5.0", true, true},
+		{"> 2.4.9", true, true},
+		{"~> 3.0", false, true},
+	} {
+		c, err := parseConstraint(test.constraint)
+		if err != nil {
+			t.Fatalf("%s: %v", test.constraint, err)
+		}
+		if below := c.allowsBelow(googleProviders012); below != test.below {
+			t.Errorf("%s: expected allowsBelow(%s) to be %v", test.constraint, googleProviders012, test.below)
+		}
+		if from := c.allowsFrom(googleProviders012); from != test.from {
+			t.Errorf("%s: expected allowsFrom(%s) to be %v", test.constraint, googleProviders012, test.from)
+		}
+	}
+}
+
+func TestTerraformWithDefaults(t *testing.T) {
+	defaults := TerraformSpec{RequiredVersion: ">= 0.12", GoogleProvider: "2.13.0", GoogleBetaProvider: "2.13.0"}
+	var spec *TerraformSpec
+	if merged := spec.WithDefaults(defaults); *merged != defaults {
+		t.Errorf("expected the defaults, got %+v", merged)
+	}
+	spec = &TerraformSpec{GoogleBetaProvider: "~> 3.0"}
+	merged := spec.WithDefaults(defaults)
+	if merged.RequiredVersion != ">= 0.12" || merged.GoogleProvider != "2.13.0" || merged.GoogleBetaProvider != "~> 3.0" {
+		t.Errorf("expected the google-beta provider of the spec, got %+v", merged)
+	}
+}
+
+func TestValidateTerraform(t *testing.T) {
+	identityNamespace := "my-project.svc.id.goog"
+	for _, test := range []struct {
+		name      string
+		terraform TerraformSpec
+		identity  bool
+		expected  []string
+	}{
+		{
+			name:      "compatible",
+			terraform: TerraformSpec{RequiredVersion: ">= 0.12", GoogleProvider: "~> 3.0", GoogleBetaProvider: "~> 3.0"},
+			identity:  true,
+		},
+		{
+			name:      "not a constraint",
+			terraform: TerraformSpec{RequiredVersion: "0.12+", GoogleProvider: "latest"},
+			expected:  []string{"spec.terraform.requiredVersion", "spec.terraform.googleProvider"},
+		},
+		{
+			name:      "providers before terraform 0.12",
+			terraform: TerraformSpec{RequiredVersion: ">= 0.12", GoogleProvider: "~> 2.4.0"},
+			expected:  []string{"spec.terraform.googleProvider"},
+		},
+		{
+			name:      "providers after terraform 0.11",
+			terraform: TerraformSpec{RequiredVersion: "~> 0.11.14", GoogleProvider: "2.7.0", GoogleBetaProvider: ">= 3.0"},
+			expected:  []string{"spec.terraform.googleBetaProvider"},
+		},
+		{
+			name:      "workload identity with google-beta 4",
+			terraform: TerraformSpec{GoogleBetaProvider: "~> 4.0"},
+			identity:  true,
+			expected: []string{
+				"spec.workloadIdentityConfig.identityNamespace",
+				"spec.nodePools[0].spec.workloadMetadataConfig.nodeMetadata",
+				"spec.nodePools[1].spec.workloadMetadataConfig.nodeMetadata",
+			},
+		},
+		{
+			name:      "workload identity before google-beta 4",
+			terraform: TerraformSpec{GoogleBetaProvider: ">= 3.0"},
+			identity:  true,
+		},
+	} {
+		gkeTF := parseYAML(t, configFile)
+		if err := SetApiDefaultValues(gkeTF); err != nil {
+			t.Fatalf("failed %v", err)
+		}
+		terraform := test.terraform
+		gkeTF.Spec.Terraform = &terraform
+		if test.identity {
+			gkeTF.Spec.WorkloadIdentityConfig = &WorkloadIdentityConfigSpec{IdentityNamespace: &identityNamespace}
+		}
+
+		diags := validateTerraform(&gkeTF.Spec)
+		var paths []string
+		for _, d := range diags {
+			paths = append(paths, d.Path)
+		}
+		if strings.Join(paths, " ") != strings.Join(test.expected, " ") {
+			t.Errorf("%s: expected diagnostics for %v, got %v", test.name, test.expected, diags)
+		}
+	}
+}
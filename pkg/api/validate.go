@@ -18,22 +18,39 @@ package api
 
 import (
 	"gopkg.in/go-playground/validator.v9"
-	"k8s.io/klog"
 )
 
 // ValidateYamlInput checks the values that the user passes in via the yaml file.
+// When validation fails the error is a Diagnostics that holds one Diagnostic
+// per problem, keyed by the YAML path of the field.
+//
+// The fields are validated one by one first, and then the network ranges are
+// checked against each other and against the size of the node pools, and the
+// versions of terraform and of the providers against each other and against
+// the fields that they support, and the backend of the terraform state.
 func ValidateYamlInput(gkeTF *GkeTF) error {
 
 	validate := validator.New()
+	// report field names as they are written in the YAML
+	validate.RegisterTagNameFunc(yamlFieldName)
 
+	var diags Diagnostics
 	if err := validate.Struct(gkeTF.Spec); err != nil {
 		validationErrors, ok := err.(validator.ValidationErrors)
 		if !ok || validationErrors == nil {
 			return err
 		}
-		klog.Errorf("error validating gke tf struct: %v", validationErrors)
-		return validationErrors
+		for _, fe := range validationErrors {
+			diags = append(diags, newDiagnostic("spec", fe))
+		}
 	}
 
+	diags = append(diags, validateNetwork(&gkeTF.Spec)...)
+	diags = append(diags, validateTerraform(&gkeTF.Spec)...)
+	diags = append(diags, validateBackend(&gkeTF.Spec)...)
+
+	if len(diags) > 0 {
+		return diags
+	}
 	return nil
 }
@@ -27,7 +27,7 @@ func TestValidate(t *testing.T) {
 
 	gkeTF := parseYAML(t, configFile)
 
-	if err := SetApiDefaultValues(gkeTF, configFile); err != nil {
+	if err := SetApiDefaultValues(gkeTF); err != nil {
 		t.Fatalf("failed %v", err)
 	}
 
@@ -44,7 +44,7 @@ func TestCIDR(t *testing.T) {
 	gkeTF.Spec.Network.Spec.ServiceSubnetRange = "bad"
 	gkeTF.Spec.Network.Spec.MasterIPV4CIDRBlock = "bad"
 
-	if err := SetApiDefaultValues(gkeTF, configFile); err != nil {
+	if err := SetApiDefaultValues(gkeTF); err != nil {
 		t.Fatalf("failed %v", err)
 	}
 
@@ -56,7 +56,7 @@ func TestCIDR(t *testing.T) {
 
 func TestValidation(t *testing.T) {
 	gkeTF := parseYAML(t, "../../examples/test-data.yaml")
-	if err := SetApiDefaultValues(gkeTF, configFile); err != nil {
+	if err := SetApiDefaultValues(gkeTF); err != nil {
 		t.Fatalf("failed %v", err)
 	}
 
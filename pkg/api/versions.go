@@ -0,0 +1,388 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// Group is the API group of gke-tf documents.
+	Group = "gke-tf.dev"
+	// V1alpha1 is the first version of the API.  Documents without an apiVersion are read as V1alpha1.
+	V1alpha1 = Group + "/v1alpha1"
+	// V1beta1 renames the Description and IssueClientCertificate keys to description and
+	// issueClientCertificate.
+	V1beta1 = Group + "/v1beta1"
+	// HubVersion is the version that GkeTF models.  Documents of every other version are converted
+	// to it when they are read.
+	HubVersion = V1beta1
+
+	// ClusterKind is the kind of a GkeTF document.
+	ClusterKind = "gke-cluster"
+)
+
+// conversion upgrades a document from one API version to the next.  A conversion only renames
+// keys, so it can be reversed, and it keeps the comments, formatting and line numbers of the
+// document.
+type conversion struct {
+	from string
+	to   string
+	// renamedKeys maps the path of a key in from, such as spec.Description, to its name in to.
+	// A * in the path matches every item of a list.
+	renamedKeys map[string]string
+}
+
+// conversions are ordered from the oldest version to the newest.
+var conversions = []*conversion{
+	{
+		from: V1alpha1,
+		to:   V1beta1,
+		renamedKeys: map[string]string{
+			"spec.Description":            "description",
+			"spec.IssueClientCertificate": "issueClientCertificate",
+		},
+	},
+}
+
+// Versions returns the supported API versions, from the oldest to the newest.
+func Versions() []string {
+	versions := []string{conversions[0].from}
+	for _, c := range conversions {
+		versions = append(versions, c.to)
+	}
+	return versions
+}
+
+// ParseVersion returns the API version that s names.  s is either a full API version, such as
+// gke-tf.dev/v1beta1, or only its version, such as v1beta1.
+func ParseVersion(s string) (string, error) {
+	for _, version := range Versions() {
+		if s == version || Group+"/"+s == version {
+			return version, nil
+		}
+	}
+	return "", fmt.Errorf("apiVersion %q is not supported, use one of %s", s, strings.Join(Versions(), ", "))
+}
+
+// documentVersion returns the API version of a document, which is V1alpha1 if the document
+// has no apiVersion.
+func documentVersion(apiVersion string) (string, error) {
+	if apiVersion == "" {
+		return V1alpha1, nil
+	}
+	for _, version := range Versions() {
+		if apiVersion == version {
+			return version, nil
+		}
+	}
+	return "", fmt.Errorf("apiVersion %q is not supported, use one of %s", apiVersion, strings.Join(Versions(), ", "))
+}
+
+// checkTypeMeta rejects a document whose kind or apiVersion is not supported.  Since the
+// document has been converted to the HubVersion when it was read, its apiVersion is set to
+// HubVersion.
+func checkTypeMeta(typeMeta *TypeMeta) error {
+	if typeMeta.Kind != ClusterKind {
+		return fmt.Errorf("kind %q is not supported, use %s", typeMeta.Kind, ClusterKind)
+	}
+	if _, err := documentVersion(typeMeta.APIVersion); err != nil {
+		return err
+	}
+	typeMeta.APIVersion = HubVersion
+	return nil
+}
+
+// ConvertDocuments rewrites every document in source to the API version, and sets its
+// apiVersion.  Only the keys that differ between the versions are changed, so comments and
+// formatting are kept.
+func ConvertDocuments(source []byte, version string) ([]byte, error) {
+	return convertDocuments(source, version, true)
+}
+
+// upgradeDocuments renames the keys of documents of older versions to those of the HubVersion.
+// The apiVersion is left alone so that line numbers do not change, and documents with an
+// unsupported kind or apiVersion are left as they are for checkTypeMeta to reject.
+func upgradeDocuments(source []byte) ([]byte, error) {
+	return convertDocuments(source, HubVersion, false)
+}
+
+// edit replaces length bytes of the source at offset with text.
+type edit struct {
+	offset int
+	length int
+	text   string
+}
+
+func convertDocuments(source []byte, version string, strict bool) ([]byte, error) {
+	lines := lineOffsets(source)
+
+	var edits []edit
+	decoder := yaml.NewDecoder(bytes.NewReader(source))
+	for index := 0; ; index++ {
+		var doc yaml.Node
+		if err := decoder.Decode(&doc); err == io.EOF {
+			break
+		} else if err != nil {
+			if !strict {
+				// leave the error to the decoder of the documents
+				break
+			}
+			return nil, fmt.Errorf("document %d: %v", index, err)
+		}
+
+		docEdits, err := convertDocument(source, lines, &doc, version, strict)
+		if err != nil {
+			if strict {
+				return nil, fmt.Errorf("document %d: %v", index, err)
+			}
+			continue
+		}
+		edits = append(edits, docEdits...)
+	}
+
+	// apply the edits from the end of the source, so that the offsets stay valid
+	sort.Slice(edits, func(i, j int) bool { return edits[i].offset > edits[j].offset })
+	converted := append([]byte(nil), source...)
+	for _, e := range edits {
+		converted = append(converted[:e.offset], append([]byte(e.text), converted[e.offset+e.length:]...)...)
+	}
+	return converted, nil
+}
+
+// convertDocument returns the edits that convert a document to version.  When setVersion is
+// true the apiVersion of the document is set as well.
+func convertDocument(source []byte, lines []int, doc *yaml.Node, version string, setVersion bool) ([]edit, error) {
+	if len(doc.Content) == 0 {
+		return nil, nil
+	}
+	root := doc.Content[0]
+	if root.Kind == yaml.ScalarNode && root.Tag == "!!null" {
+		// an empty document
+		return nil, nil
+	}
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("a document must be a mapping")
+	}
+
+	kind := scalarValue(root, "kind")
+	if kind != ClusterKind {
+		return nil, fmt.Errorf("kind %q is not supported, use %s", kind, ClusterKind)
+	}
+	from, err := documentVersion(scalarValue(root, "apiVersion"))
+	if err != nil {
+		return nil, err
+	}
+
+	var edits []edit
+	for _, rename := range renamesBetween(from, version) {
+		for _, mapping := range findMappings(root, strings.Split(rename.path, ".")) {
+			key := mappingKey(mapping, rename.key)
+			if key == nil {
+				continue
+			}
+			if mappingKey(mapping, rename.to) != nil {
+				return nil, fmt.Errorf("line %d: unable to rename %s to %s, %s is already set", key.Line, key.Value, rename.to, rename.to)
+			}
+			e, err := replaceScalar(source, lines, key, rename.to)
+			if err != nil {
+				return nil, err
+			}
+			edits = append(edits, e)
+		}
+	}
+
+	if !setVersion || scalarValue(root, "apiVersion") == version {
+		return edits, nil
+	}
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == "apiVersion" {
+			e, err := replaceScalar(source, lines, root.Content[i+1], version)
+			if err != nil {
+				return nil, err
+			}
+			return append(edits, e), nil
+		}
+	}
+	if root.Style&yaml.FlowStyle != 0 || len(root.Content) == 0 {
+		return nil, fmt.Errorf("unable to add apiVersion to a flow mapping")
+	}
+	// add the apiVersion on its own line before the first key
+	first := root.Content[0]
+	offset := lines[first.Line-1]
+	text := fmt.Sprintf("%sapiVersion: %s\n", strings.Repeat(" ", first.Column-1), version)
+	return append(edits, edit{offset: offset, text: text}), nil
+}
+
+// rename renames a key of the mappings at path.
+type rename struct {
+	path string
+	key  string
+	to   string
+}
+
+// renamesBetween returns the renames that convert a document from one version to another,
+// which may be older.
+func renamesBetween(from, to string) []rename {
+	versions := Versions()
+	fromIndex, toIndex := indexOf(versions, from), indexOf(versions, to)
+
+	var renames []rename
+	for i := fromIndex; i < toIndex; i++ {
+		for path, name := range conversions[i].renamedKeys {
+			parent, key := splitKeyPath(path)
+			renames = append(renames, rename{path: parent, key: key, to: name})
+		}
+	}
+	for i := fromIndex - 1; i >= toIndex; i-- {
+		for path, name := range conversions[i].renamedKeys {
+			parent, key := splitKeyPath(path)
+			renames = append(renames, rename{path: parent, key: name, to: key})
+		}
+	}
+	return renames
+}
+
+func indexOf(values []string, value string) int {
+	for i, v := range values {
+		if v == value {
+			return i
+		}
+	}
+	return -1
+}
+
+// splitKeyPath splits the path of a key into the path of its mapping and the key.
+func splitKeyPath(path string) (string, string) {
+	i := strings.LastIndex(path, ".")
+	if i < 0 {
+		return "", path
+	}
+	return path[:i], path[i+1:]
+}
+
+// findMappings returns the mapping nodes at path, which is empty for node itself.  A * matches
+// every item of a list.
+func findMappings(node *yaml.Node, path []string) []*yaml.Node {
+	if len(path) == 0 || path[0] == "" {
+		if node.Kind == yaml.MappingNode {
+			return []*yaml.Node{node}
+		}
+		return nil
+	}
+	if node.Kind == yaml.SequenceNode && path[0] == "*" {
+		var mappings []*yaml.Node
+		for _, item := range node.Content {
+			mappings = append(mappings, findMappings(item, path[1:])...)
+		}
+		return mappings
+	}
+	if key := mappingKey(node, path[0]); key != nil {
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i] == key {
+				return findMappings(node.Content[i+1], path[1:])
+			}
+		}
+	}
+	return nil
+}
+
+// mappingKey returns the key node of key in a mapping node, or nil.
+func mappingKey(node *yaml.Node, key string) *yaml.Node {
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i]
+		}
+	}
+	return nil
+}
+
+// scalarValue returns the value of key in a mapping node, or an empty string.
+func scalarValue(node *yaml.Node, key string) string {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key && node.Content[i+1].Kind == yaml.ScalarNode {
+			return node.Content[i+1].Value
+		}
+	}
+	return ""
+}
+
+// replaceScalar returns an edit that replaces the text of a plain or quoted scalar, which
+// keeps its quotes.
+func replaceScalar(source []byte, lines []int, node *yaml.Node, text string) (edit, error) {
+	if node.Kind != yaml.ScalarNode || node.Line < 1 || node.Line > len(lines) {
+		return edit{}, fmt.Errorf("unable to replace %q", node.Value)
+	}
+
+	// yaml columns count characters, not bytes
+	offset := lines[node.Line-1]
+	for column := 1; column < node.Column && offset < len(source); column++ {
+		_, size := utf8.DecodeRune(source[offset:])
+		offset += size
+	}
+
+	switch node.Style {
+	case 0:
+		if !bytes.HasPrefix(source[offset:], []byte(node.Value)) {
+			return edit{}, fmt.Errorf("unable to find %q at line %d", node.Value, node.Line)
+		}
+		return edit{offset: offset, length: len(node.Value), text: text}, nil
+	case yaml.SingleQuotedStyle, yaml.DoubleQuotedStyle:
+		quote := source[offset]
+		end := offset + 1
+		for end < len(source) {
+			if quote == '"' && source[end] == '\\' {
+				end += 2
+				continue
+			}
+			if source[end] == quote {
+				// a single quote is escaped by doubling it
+				if quote != '\'' || end+1 >= len(source) || source[end+1] != '\'' {
+					break
+				}
+				end++
+			}
+			end++
+		}
+		if end >= len(source) {
+			return edit{}, fmt.Errorf("unable to find the end of %q at line %d", node.Value, node.Line)
+		}
+		return edit{offset: offset, length: end + 1 - offset, text: string(quote) + text + string(quote)}, nil
+	}
+	return edit{}, fmt.Errorf("unable to replace %q at line %d, use a plain or quoted string", node.Value, node.Line)
+}
+
+// lineOffsets returns the offset of the start of each line in source.
+func lineOffsets(source []byte) []int {
+	lines := []int{0}
+	for i, b := range source {
+		if b == '\n' {
+			lines = append(lines, i+1)
+		}
+	}
+	return lines
+}
@@ -0,0 +1,129 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+const v1alpha1Document = `# a cluster written before apiVersion was read
+kind: gke-cluster
+metadata:
+  name: legacy
+spec:
+  # the description of the cluster
+  Description: "my cluster"
+
+  'IssueClientCertificate': true
+`
+
+func TestUnmarshalV1alpha1(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gke-tf")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := writeFile(t, dir, "legacy.yaml", v1alpha1Document)
+	gkeTF, err := UnmarshalGkeTF(file)
+	if err != nil {
+		t.Fatalf("failed %v", err)
+	}
+	if gkeTF.APIVersion != HubVersion {
+		t.Fatalf("expected apiVersion %s, got %s", HubVersion, gkeTF.APIVersion)
+	}
+	if gkeTF.Spec.Description == nil || *gkeTF.Spec.Description != "my cluster" {
+		t.Fatal("spec.Description was not converted")
+	}
+	if !gkeTF.Spec.IssueClientCertificate.IsTrue() {
+		t.Fatal("spec.IssueClientCertificate was not converted")
+	}
+}
+
+func TestUnmarshalUnsupportedTypeMeta(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gke-tf")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	for source, message := range map[string]string{
+		"kind: gke-network\nmetadata:\n  name: a\n":                            `kind "gke-network" is not supported`,
+		"metadata:\n  name: a\n":                                               `kind "" is not supported`,
+		"apiVersion: gke-tf.dev/v2\nkind: gke-cluster\nmetadata:\n  name: a\n": `apiVersion "gke-tf.dev/v2" is not supported`,
+	} {
+		file := writeFile(t, dir, "cluster.yaml", source)
+		if _, err := UnmarshalGkeTF(file); err == nil || !strings.Contains(err.Error(), message) {
+			t.Errorf("expected %s, got %v", message, err)
+		}
+		if _, err := UnmarshalDocuments(file); err == nil || !strings.Contains(err.Error(), message) {
+			t.Errorf("expected %s, got %v", message, err)
+		}
+	}
+}
+
+func TestConvertDocuments(t *testing.T) {
+	converted, err := ConvertDocuments([]byte(v1alpha1Document+"---\n"+v1alpha1Document), V1beta1)
+	if err != nil {
+		t.Fatalf("failed %v", err)
+	}
+
+	// only the keys and the apiVersion change
+	document := strings.Replace(v1alpha1Document, "Description:", "description:", 1)
+	document = strings.Replace(document, "'IssueClientCertificate'", "'issueClientCertificate'", 1)
+	document = strings.Replace(document, "kind:", "apiVersion: gke-tf.dev/v1beta1\nkind:", 1)
+	if string(converted) != document+"---\n"+document {
+		t.Fatalf("unexpected conversion:\n%s", converted)
+	}
+
+	// converting back restores the keys
+	reverted, err := ConvertDocuments(converted, V1alpha1)
+	if err != nil {
+		t.Fatalf("failed %v", err)
+	}
+	expected := strings.Replace(v1alpha1Document, "kind:", "apiVersion: gke-tf.dev/v1alpha1\nkind:", 1)
+	if string(reverted) != expected+"---\n"+expected {
+		t.Fatalf("unexpected conversion:\n%s", reverted)
+	}
+}
+
+func TestConvertDocumentsFailures(t *testing.T) {
+	for _, source := range []string{
+		// both the old and the new key are set
+		"kind: gke-cluster\nspec:\n  Description: a\n  description: b\n",
+		"kind: gke-network\n",
+		"- kind: gke-cluster\n",
+	} {
+		if _, err := ConvertDocuments([]byte(source), V1beta1); err == nil {
+			t.Errorf("this should have failed: %s", source)
+		}
+	}
+}
+
+func TestParseVersion(t *testing.T) {
+	for _, s := range []string{"v1beta1", "gke-tf.dev/v1beta1"} {
+		if version, err := ParseVersion(s); err != nil || version != V1beta1 {
+			t.Errorf("%s: got %s %v", s, version, err)
+		}
+	}
+	if _, err := ParseVersion("v1"); err == nil {
+		t.Error("v1 should not be supported")
+	}
+}
@@ -0,0 +1,198 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package backend writes the backend that keeps the terraform state of a cluster, as its
+// spec.backend configures it.
+//
+// The backend is the same for every terraform type, so the templates and the builder both add
+// the files of Files to theirs: the backend.tf of the cluster and, for a gcs backend with
+// bootstrap, a root module in BootstrapDir that creates the bucket of the state.
+package backend
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+
+	"github.com/GoogleCloudPlatform/gke-terraform-generator/pkg/api"
+)
+
+const (
+	// FileName is the name of the file that configures the backend.
+	FileName = "backend.tf"
+	// ConfigFileName is the name of the partial configuration of the backend with its secrets,
+	// which is passed to terraform init -backend-config=backend.hcl.
+	ConfigFileName = "backend.hcl"
+	// BootstrapDir is the directory of the root module that creates the bucket of a gcs backend.
+	// It has its own state, in the directory, since the bucket does not exist yet.
+	BootstrapDir = "bootstrap"
+	// bootstrapGoogleProvider is the version constraint of the google provider of the bootstrap
+	// module, whose buckets have uniform_bucket_level_access.
+	bootstrapGoogleProvider = ">= 3.30"
+)
+
+// license is the comment at the start of every file.
+const license = `/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+`
+
+// Files returns the files of the backend of a cluster, keyed by file name, or nil if its
+// spec.backend is not set.  The encryption key of a gcs backend is written to ConfigFileName.  The cluster should have been validated, so that a single backend is
+// set.  The configuration of a custom backend is written as it is, but it must be valid HCL.
+func Files(cluster *api.GkeTF) (map[string][]byte, error) {
+	backend := cluster.Spec.Backend
+	if backend == nil {
+		return nil, nil
+	}
+
+	var b bytes.Buffer
+	b.WriteString(license)
+	b.WriteString("\n// The backend that keeps the terraform state of the cluster\n\n")
+	b.WriteString("terraform {\n")
+	switch {
+	case backend.GCS != nil:
+		gcs := backend.GCS
+		prefix := gcs.Prefix
+		if prefix == "" {
+			prefix = cluster.Name
+		}
+		b.WriteString("  backend \"gcs\" {\n")
+		fmt.Fprintf(&b, "    bucket = %s\n", quote(gcs.Bucket))
+		fmt.Fprintf(&b, "    prefix = %s\n", quote(prefix))
+		if gcs.EncryptionKey != "" {
+			fmt.Fprintf(&b, "    // encryption_key is set by terraform init -backend-config=%s\n", ConfigFileName)
+		}
+		b.WriteString("  }\n")
+	case backend.Local != nil:
+		b.WriteString("  backend \"local\" {\n")
+		if backend.Local.Path != "" {
+			fmt.Fprintf(&b, "    path = %s\n", quote(backend.Local.Path))
+		}
+		b.WriteString("  }\n")
+	case backend.Custom != nil:
+		config, diags := hclwrite.ParseConfig([]byte(backend.Custom.Config), "spec.backend.custom.config", hcl.Pos{Line: 1, Column: 1})
+		if diags.HasErrors() {
+			return nil, diags
+		}
+		fmt.Fprintf(&b, "  backend %s {\n", quote(backend.Custom.Type))
+		b.Write(bytes.TrimSpace(config.Bytes()))
+		b.WriteString("\n  }\n")
+	default:
+		return nil, fmt.Errorf("spec.backend must set one of gcs, local and custom")
+	}
+	b.WriteString("}\n")
+
+	files := map[string][]byte{FileName: hclwrite.Format(b.Bytes())}
+	if backend.GCS != nil && backend.GCS.EncryptionKey != "" {
+		files[ConfigFileName] = configFile(backend.GCS)
+	}
+	if backend.GCS != nil && backend.GCS.Bootstrap.IsTrue() {
+		files[path.Join(BootstrapDir, "main.tf")] = bootstrapFile(cluster)
+	}
+	return files, nil
+}
+
+// configFile returns the partial configuration of a gcs backend with its encryption key, which is
+// kept out of backend.tf so that the terraform can be committed without the key.
+func configFile(gcs *api.GCSBackendSpec) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, `// The secrets of the backend, for terraform init -backend-config=%s.  Do not commit
+// this file.
+
+encryption_key = %s
+`, ConfigFileName, quote(gcs.EncryptionKey))
+	return b.Bytes()
+}
+
+// bootstrapFile returns the main.tf of the root module that creates the bucket of the gcs
+// backend of a cluster.  Every version of the state is kept, access to it is granted by IAM
+// only, and terraform refuses to destroy it.
+func bootstrapFile(cluster *api.GkeTF) []byte {
+	gcs := cluster.Spec.Backend.GCS
+	location := gcs.Location
+	if location == "" {
+		location = cluster.Spec.Region
+	}
+
+	var b bytes.Buffer
+	b.WriteString(license)
+	fmt.Fprintf(&b, `
+// Creates the bucket that keeps the terraform state of the cluster %s.  Apply it once,
+// before the terraform of the cluster.  Its own state is kept in this directory.
+
+terraform {
+  required_version = ">= 0.12"
+
+  required_providers {
+    google = %s
+  }
+}
+
+variable "project_id" {
+  description = "GCP Project ID of the bucket."
+  default     = %s
+}
+
+provider "google" {
+  project = var.project_id
+}
+
+resource "google_storage_bucket" "state" {
+  name     = %s
+  location = %s
+
+  // keep every version of the state, so that a bad apply can be recovered from
+  versioning {
+    enabled = true
+  }
+
+  // grant access to the state with IAM on the bucket only, never with object ACLs
+  uniform_bucket_level_access = true
+
+  lifecycle {
+    prevent_destroy = true
+  }
+}
+
+output "bucket" {
+  description = "The bucket of the terraform state"
+  value       = google_storage_bucket.state.name
+}
+`, cluster.Name, quote(bootstrapGoogleProvider), quote(cluster.Spec.ProjectId), quote(gcs.Bucket), quote(location))
+	return hclwrite.Format(b.Bytes())
+}
+
+// quote returns s as a quoted HCL string, escaping the ${ and %{ sequences.
+func quote(s string) string {
+	return string(hclwrite.TokensForValue(cty.StringVal(s)).Bytes())
+}
@@ -0,0 +1,142 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package backend
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+
+	"github.com/GoogleCloudPlatform/gke-terraform-generator/pkg/api"
+)
+
+func newCluster(backend *api.BackendSpec) *api.GkeTF {
+	cluster := &api.GkeTF{}
+	cluster.Name = "my-cluster"
+	cluster.Spec.ProjectId = "my-project"
+	cluster.Spec.Region = "us-central1"
+	cluster.Spec.Backend = backend
+	return cluster
+}
+
+func TestFiles(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		backend   *api.BackendSpec
+		expected  []string
+		config    []string
+		bootstrap []string
+	}{
+		{
+			name:     "gcs",
+			backend:  &api.BackendSpec{GCS: &api.GCSBackendSpec{Bucket: "my-state"}},
+			expected: []string{`backend "gcs" {`, `bucket = "my-state"`, `prefix = "my-cluster"`},
+		},
+		{
+			name: "gcs with bootstrap",
+			backend: &api.BackendSpec{GCS: &api.GCSBackendSpec{
+				Bucket:        "my-state",
+				Prefix:        "clusters/${env}",
+				EncryptionKey: "MTIzNDU2Nzg5MDEyMzQ1Njc4OTAxMjM0NTY3ODkwMTI=",
+				Bootstrap:     api.NewBool(true),
+			}},
+			expected: []string{`prefix = "clusters/$${env}"`, "// encryption_key is set by terraform init -backend-config=backend.hcl"},
+			config:   []string{`encryption_key = "MTIzNDU2Nzg5MDEyMzQ1Njc4OTAxMjM0NTY3ODkwMTI="`},
+			bootstrap: []string{
+				`name     = "my-state"`,
+				`location = "us-central1"`,
+				"versioning {\n    enabled = true\n  }",
+				"uniform_bucket_level_access = true",
+				"prevent_destroy = true",
+				`default     = "my-project"`,
+			},
+		},
+		{
+			name:     "local",
+			backend:  &api.BackendSpec{Local: &api.LocalBackendSpec{Path: "state/terraform.tfstate"}},
+			expected: []string{`backend "local" {`, `path = "state/terraform.tfstate"`},
+		},
+		{
+			name: "custom",
+			backend: &api.BackendSpec{Custom: &api.CustomBackendSpec{
+				Type:   "remote",
+				Config: "organization = \"acme\"\nworkspaces {\n  name = \"gke\"\n}\n",
+			}},
+			expected: []string{`backend "remote" {`, `organization = "acme"`, "workspaces {\n      name = \"gke\"\n    }"},
+		},
+	} {
+		files, err := Files(newCluster(test.backend))
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		expectedFiles := 1
+		if test.config != nil {
+			expectedFiles++
+		}
+		if test.bootstrap != nil {
+			expectedFiles++
+		}
+		if len(files) != expectedFiles {
+			t.Errorf("%s: expected %d files, got %d", test.name, expectedFiles, len(files))
+		}
+
+		for name, b := range files {
+			if _, diags := hclsyntax.ParseConfig(b, name, hcl.Pos{Line: 1, Column: 1}); diags.HasErrors() {
+				t.Errorf("%s: %s is not valid HCL: %v\n%s", test.name, name, diags, b)
+			}
+		}
+		for _, s := range test.expected {
+			if !strings.Contains(string(files[FileName]), s) {
+				t.Errorf("%s: expected %s to contain %q, got\n%s", test.name, FileName, s, files[FileName])
+			}
+		}
+		// the encryption key is only written to the partial configuration
+		if strings.Contains(string(files[FileName]), "MTIz") {
+			t.Errorf("%s: expected no encryption key in %s, got\n%s", test.name, FileName, files[FileName])
+		}
+		if test.config == nil && strings.Contains(string(files[FileName]), "encryption_key") {
+			t.Errorf("%s: expected no encryption_key in %s without a key, got\n%s", test.name, FileName, files[FileName])
+		}
+		for _, s := range test.config {
+			if !strings.Contains(string(files[ConfigFileName]), s) {
+				t.Errorf("%s: expected %s to contain %q, got\n%s", test.name, ConfigFileName, s, files[ConfigFileName])
+			}
+		}
+		bootstrap := files[BootstrapDir+"/main.tf"]
+		for _, s := range test.bootstrap {
+			if !strings.Contains(string(bootstrap), s) {
+				t.Errorf("%s: expected the bootstrap to contain %q, got\n%s", test.name, s, bootstrap)
+			}
+		}
+	}
+}
+
+func TestFilesWithoutBackend(t *testing.T) {
+	files, err := Files(newCluster(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if files != nil {
+		t.Errorf("expected no files, got %v", files)
+	}
+
+	if _, err := Files(newCluster(&api.BackendSpec{Custom: &api.CustomBackendSpec{Type: "remote", Config: "organization = "}})); err == nil {
+		t.Error("expected an error for a custom configuration that is not valid HCL")
+	}
+}
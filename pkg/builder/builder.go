@@ -0,0 +1,243 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package builder builds the terraform of a GKE cluster in Go, as an HCL syntax tree, instead of
+// rendering text templates.
+//
+// The terraform is the same as that of the Vanilla templates, but every value of the cluster is
+// written as a typed literal: strings are quoted and escaped, including the ${ sequences that
+// terraform would interpolate, map keys that are not identifiers are quoted, and optional blocks
+// are only added when they are set.  The files can be written in the native syntax of
+// terraform, as main.tf, or in its JSON syntax, as main.tf.json.
+package builder
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+
+	"github.com/GoogleCloudPlatform/gke-terraform-generator/pkg/api"
+	"github.com/GoogleCloudPlatform/gke-terraform-generator/pkg/backend"
+	"github.com/GoogleCloudPlatform/gke-terraform-generator/pkg/params"
+)
+
+// license is the comment at the start of every file in the native syntax.
+const license = `/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+`
+
+// JSONSuffix is added to the name of a file in the JSON syntax, such as main.tf.json.
+const JSONSuffix = ".json"
+
+// DefaultTerraform holds the versions of terraform and of the providers that the terraform
+// targets, as those of the Vanilla templates, which the spec.terraform of a cluster overrides.
+// The builder writes the syntax of terraform 0.12 or later, with a source for the providers from
+// 0.13, so a cluster whose spec.terraform allows terraform 0.11 is an error.
+var DefaultTerraform = api.TerraformSpec{
+	RequiredVersion:    ">= 0.12",
+	GoogleProvider:     "2.13.0",
+	GoogleBetaProvider: "2.13.0",
+}
+
+// Options configures the terraform that Build returns.
+type Options struct {
+	// JSON writes the files in the JSON syntax of terraform, with the JSONSuffix.  Otherwise
+	// they are written in the native syntax, formatted as terraform fmt formats them.
+	JSON bool
+	// Parameterize writes the fields of the cluster as references to variables, which are
+	// declared by the params.VariablesFileName file and set by the params.TFVarsFileName file,
+	// as the Var function of the templates does.
+	Parameterize bool
+}
+
+// Build returns the terraform files of a cluster, keyed by file name, such as main.tf.  The
+// cluster is built as it is, so its defaults should have been set and its network planned.  The
+// files of its spec.backend are added if it is set.
+func Build(cluster *api.GkeTF, opts Options) (map[string][]byte, error) {
+	terraform := cluster.Spec.Terraform.WithDefaults(DefaultTerraform)
+	syntax, err := terraform.Syntax()
+	if err != nil {
+		return nil, err
+	}
+	if syntax == api.Terraform011 {
+		return nil, fmt.Errorf("spec.terraform.requiredVersion %q allows terraform %s, but the builder writes the syntax of terraform %s or later",
+			terraform.RequiredVersion, syntax, api.Terraform012)
+	}
+
+	p := &parameters{}
+	if opts.Parameterize {
+		parameters, err := params.New()
+		if err != nil {
+			return nil, err
+		}
+		p.Parameters = parameters
+	}
+
+	files := map[string][]byte{}
+	fs := []*file{
+		mainFile(cluster, p),
+		networkFile(cluster, p),
+		outputsFile(cluster),
+		variablesFile(cluster, p),
+		versionsFile(terraform, syntax),
+	}
+	if p.err != nil {
+		return nil, p.err
+	}
+	for _, f := range fs {
+		if !opts.JSON {
+			files[f.name] = f.hcl()
+			continue
+		}
+		b, err := f.json()
+		if err != nil {
+			return nil, err
+		}
+		files[f.name+JSONSuffix] = b
+	}
+
+	extra, err := backend.Files(cluster)
+	if err != nil {
+		return nil, err
+	}
+	if extra == nil {
+		extra = map[string][]byte{}
+	}
+	if p.Parameters != nil {
+		extra[params.VariablesFileName] = p.VariablesFile()
+		extra[params.TFVarsFileName] = p.TFVarsFile()
+	}
+	for name, b := range extra {
+		if !opts.JSON {
+			files[name] = b
+			continue
+		}
+		j, err := ConvertJSON(name, b)
+		if err != nil {
+			return nil, err
+		}
+		files[name+JSONSuffix] = j
+	}
+	return files, nil
+}
+
+// parameters are the variables of a cluster that is parameterized.  Its Parameters are nil when
+// the cluster is not, and err is the first error of value or tfvar, which Build returns.
+type parameters struct {
+	*params.Parameters
+	err error
+}
+
+// value returns the value of a field, or a reference to its variable if the cluster is
+// parameterized.  path and scope are those of params.Parameters.Var.
+func (p *parameters) value(v value, path string, field interface{}, scope ...string) value {
+	if p.Parameters == nil || p.err != nil {
+		return v
+	}
+	ref, err := p.Var(path, field, scope...)
+	if err != nil {
+		p.err = err
+		return v
+	}
+	return expression(ref)
+}
+
+// tfvar returns the default of a variable of variables.tf, and adds it to the tfvars if the
+// cluster is parameterized.
+func (p *parameters) tfvar(v value, name string, field interface{}) value {
+	if p.Parameters == nil || p.err != nil {
+		return v
+	}
+	if _, err := p.TFVar(name, field); err != nil {
+		p.err = err
+	}
+	return v
+}
+
+// not returns the negation of a bool value, or of a reference to a bool variable.
+func not(v value) value {
+	if b, ok := v.(boolValue); ok {
+		return !b
+	}
+	return expression("!" + string(v.(expression)))
+}
+
+// file is a terraform file.
+type file struct {
+	name string
+	// comments describe the file, after the license.
+	comments []string
+	body
+}
+
+// newFile returns an empty file.
+func newFile(name string, comment ...string) *file {
+	return &file{name: name, comments: comment}
+}
+
+// hcl returns the file in the native syntax.
+func (f *file) hcl() []byte {
+	out := hclwrite.NewEmptyFile()
+	out.Body().AppendUnstructuredTokens(hclwrite.Tokens{
+		{Type: hclsyntax.TokenComment, Bytes: []byte(license)},
+		newline(),
+	})
+	if len(f.comments) > 0 {
+		out.Body().AppendUnstructuredTokens(commentTokens(f.comments))
+		out.Body().AppendNewline()
+	}
+	f.body.writeTo(out.Body())
+	return hclwrite.Format(out.Bytes())
+}
+
+// json returns the file in the JSON syntax, with its comment as the // property of the root
+// object, since JSON has no comments.
+func (f *file) json() ([]byte, error) {
+	compact, err := marshalJSON(f.body.json(f.comments))
+	if err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	if err := json.Indent(&b, compact, "", "  "); err != nil {
+		return nil, err
+	}
+	b.WriteByte('\n')
+	return b.Bytes(), nil
+}
+
+// deref returns the value of an optional string, or an empty string.
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -0,0 +1,562 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package builder
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	hcljson "github.com/hashicorp/hcl/v2/json"
+	"github.com/zclconf/go-cty/cty"
+
+	"github.com/GoogleCloudPlatform/gke-terraform-generator/pkg/api"
+	"github.com/GoogleCloudPlatform/gke-terraform-generator/pkg/ipam"
+	"github.com/GoogleCloudPlatform/gke-terraform-generator/pkg/templates"
+)
+
+// update rewrites the golden files with the files that are built: go test ./pkg/builder -update
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+// goldenExamples are the examples whose files are compared with the golden files in testdata.
+var goldenExamples = []string{
+	"example",
+	"public-example",
+	"shared-vpc-example",
+}
+
+// evalContext evaluates expressions without variables.  The JSON syntax only evaluates the
+// templates of its strings with a context.
+var evalContext = &hcl.EvalContext{}
+
+// prepare reads an example and sets its defaults and network ranges.
+func prepare(t *testing.T, configFile string) *api.GkeTF {
+	gkeTF, err := api.UnmarshalGkeTF(configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := api.SetApiDefaultValues(gkeTF); err != nil {
+		t.Fatal(err)
+	}
+	if err := ipam.FillNetworkSpec(&gkeTF.Spec); err != nil {
+		t.Fatal(err)
+	}
+	return gkeTF
+}
+
+func TestGolden(t *testing.T) {
+	for _, example := range goldenExamples {
+		gkeTF := prepare(t, filepath.Join("../../examples", example+".yaml"))
+		for _, opts := range []Options{{}, {JSON: true}} {
+			files, err := Build(gkeTF, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for name, b := range files {
+				golden := filepath.Join("testdata", example, name)
+				if *update {
+					if err := os.MkdirAll(filepath.Dir(golden), 0755); err != nil {
+						t.Fatal(err)
+					}
+					if err := ioutil.WriteFile(golden, b, 0644); err != nil {
+						t.Fatal(err)
+					}
+					continue
+				}
+				expected, err := ioutil.ReadFile(golden)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(b, expected) {
+					t.Errorf("%s differs from the golden file, run go test with -update if the change is expected:\n%s", golden, b)
+				}
+			}
+		}
+	}
+}
+
+// TestVanilla checks that every example builds the same terraform as the Vanilla templates
+// render, in both syntaxes, and with the fields parameterized or not.  The parameterized ones
+// target terraform 0.13, whose providers have a source.  Comments, layout and the order of
+// attributes are ignored.
+func TestVanilla(t *testing.T) {
+	configFiles, err := filepath.Glob("../../examples/*.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	terraform013 := &api.TerraformSpec{RequiredVersion: ">= 0.13", GoogleBetaProvider: "~> 3.0"}
+	for _, configFile := range configFiles {
+		for _, parameterize := range []bool{false, true} {
+			gkeTF := prepare(t, configFile)
+			if parameterize {
+				gkeTF.Spec.Terraform = terraform013
+			}
+			gkeTemplates, err := templates.NewGKETemplates(templates.VANILLA)
+			if err != nil {
+				t.Fatal(err)
+			}
+			gkeTemplates.Parameterize = parameterize
+			vanilla, err := gkeTemplates.Render(gkeTF)
+			if err != nil {
+				t.Fatal(err)
+			}
+			native, err := Build(gkeTF, Options{Parameterize: parameterize})
+			if err != nil {
+				t.Fatal(err)
+			}
+			jsonFiles, err := Build(gkeTF, Options{JSON: true, Parameterize: parameterize})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(native) != len(vanilla) || len(jsonFiles) != len(vanilla) {
+				t.Errorf("%s: expected the %d files of Vanilla, got %d and %d", configFile, len(vanilla), len(native), len(jsonFiles))
+			}
+
+			for name, b := range vanilla {
+				vanillaFile := parse(t, name, b)
+				nativeFile := parse(t, name, native[name])
+				expected := normalize(t, vanillaFile, vanillaFile)
+				if actual := normalize(t, nativeFile, nativeFile); actual != expected {
+					t.Errorf("%s %s differs from Vanilla:\n%s", configFile, name, lineDiff(expected, actual))
+				}
+				if actual := normalize(t, parse(t, name+JSONSuffix, jsonFiles[name+JSONSuffix]), nativeFile); actual != expected {
+					t.Errorf("%s %s differs from Vanilla:\n%s", configFile, name+JSONSuffix, lineDiff(expected, actual))
+				}
+			}
+		}
+	}
+}
+
+func TestTerraform011(t *testing.T) {
+	gkeTF := prepare(t, "../../examples/example.yaml")
+	gkeTF.Spec.Terraform = &api.TerraformSpec{RequiredVersion: "~> 0.11.14"}
+	if _, err := Build(gkeTF, Options{}); err == nil {
+		t.Error("expected an error for terraform 0.11")
+	}
+}
+
+// TestConvertJSON checks that every example rendered by the Vanilla and CFT templates and
+// converted to the JSON syntax is the same terraform as the one in the native syntax.
+func TestConvertJSON(t *testing.T) {
+	configFiles, err := filepath.Glob("../../examples/*.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, configFile := range configFiles {
+		gkeTF := prepare(t, configFile)
+		for _, tfType := range []templates.TFType{templates.VANILLA, templates.CFT} {
+			gkeTemplates, err := templates.NewGKETemplates(tfType)
+			if err != nil {
+				t.Fatal(err)
+			}
+			files, err := gkeTemplates.Render(gkeTF)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for name, b := range files {
+				converted, err := ConvertJSON(name, b)
+				if err != nil {
+					t.Fatalf("%s %s %s: %v", configFile, tfType, name, err)
+				}
+				nativeFile := parse(t, name, b)
+				expected := normalize(t, nativeFile, nativeFile)
+				if actual := normalize(t, parse(t, name+JSONSuffix, converted), nativeFile); actual != expected {
+					t.Errorf("%s %s %s differs from the native syntax:\n%s", configFile, tfType, name+JSONSuffix, lineDiff(expected, actual))
+				}
+			}
+		}
+	}
+}
+
+// TestEscaping checks that labels, taints and names that are not valid in HCL strings or
+// identifiers keep their values in both syntaxes.
+func TestEscaping(t *testing.T) {
+	gkeTF := prepare(t, "../../examples/public-example.yaml")
+	labels := map[string]string{
+		"cost center": `a "quoted" \ value`,
+		"template":    "${var.project_id} and %{ if true }",
+		"multi-line":  "first\nsecond\n",
+	}
+	gkeTF.Spec.Labels = &labels
+	taint := `${file("/etc/passwd")}`
+	gkeTF.Spec.Taints = &[]api.TaintSpec{{Key: "dedicated", Value: taint, Effect: "NO_SCHEDULE"}}
+
+	for _, opts := range []Options{{}, {JSON: true}} {
+		files, err := Build(gkeTF, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		name := "main.tf"
+		if opts.JSON {
+			name += JSONSuffix
+		}
+		f := parse(t, name, files[name])
+
+		resources, _, diags := f.Body.PartialContent(&hcl.BodySchema{Blocks: []hcl.BlockHeaderSchema{
+			{Type: "resource", LabelNames: []string{"type", "name"}},
+		}})
+		if diags.HasErrors() {
+			t.Fatal(diags)
+		}
+		var pool *hcl.Block
+		for _, resource := range resources.Blocks {
+			if resource.Labels[0] == "google_container_node_pool" {
+				pool = resource
+			}
+		}
+		if pool == nil {
+			t.Fatalf("%s: no node pool", name)
+		}
+		config := nestedBlock(t, pool.Body, "node_config")
+		attrs, _, diags := config.PartialContent(&hcl.BodySchema{
+			Attributes: []hcl.AttributeSchema{{Name: "labels"}},
+			Blocks:     []hcl.BlockHeaderSchema{{Type: "taint"}},
+		})
+		if diags.HasErrors() {
+			t.Fatal(diags)
+		}
+
+		value, diags := attrs.Attributes["labels"].Expr.Value(evalContext)
+		if diags.HasErrors() {
+			t.Fatalf("%s: %v", name, diags)
+		}
+		for key, expected := range labels {
+			if actual := value.GetAttr(key).AsString(); actual != expected {
+				t.Errorf("%s: label %q is %q, expected %q", name, key, actual, expected)
+			}
+		}
+
+		if len(attrs.Blocks) != 1 {
+			t.Fatalf("%s: expected one taint, got %d", name, len(attrs.Blocks))
+		}
+		taintAttrs, diags := attrs.Blocks[0].Body.JustAttributes()
+		if diags.HasErrors() {
+			t.Fatal(diags)
+		}
+		value, diags = taintAttrs["value"].Expr.Value(evalContext)
+		if diags.HasErrors() {
+			t.Fatalf("%s: %v", name, diags)
+		}
+		if value.AsString() != taint {
+			t.Errorf("%s: taint value is %q, expected %q", name, value.AsString(), taint)
+		}
+	}
+}
+
+// nestedBlock returns the body of the only block of a type in body.
+func nestedBlock(t *testing.T, body hcl.Body, typeName string) hcl.Body {
+	content, _, diags := body.PartialContent(&hcl.BodySchema{Blocks: []hcl.BlockHeaderSchema{{Type: typeName}}})
+	if diags.HasErrors() {
+		t.Fatal(diags)
+	}
+	if len(content.Blocks) != 1 {
+		t.Fatalf("expected one %s block, got %d", typeName, len(content.Blocks))
+	}
+	return content.Blocks[0].Body
+}
+
+// parse parses a file in the native or the JSON syntax.
+func parse(t *testing.T, name string, b []byte) *hcl.File {
+	var f *hcl.File
+	var diags hcl.Diagnostics
+	if strings.HasSuffix(name, JSONSuffix) {
+		f, diags = hcljson.Parse(b, name)
+	} else {
+		f, diags = hclsyntax.ParseConfig(b, name, hcl.Pos{Line: 1, Column: 1})
+	}
+	if diags.HasErrors() {
+		t.Fatalf("%s: %v", name, diags)
+	}
+	return f
+}
+
+// normalize returns the blocks and attributes of a file, one per line, in a form that does not
+// depend on the syntax.  Attributes and blocks are sorted, and the values of those that have no references
+// are evaluated and converted to strings, as terraform converts them.  The JSON syntax can only
+// tell blocks from attributes with a schema, so the blocks of schema, a file in the native syntax,
+// are used as the schema of f.
+func normalize(t *testing.T, f, schema *hcl.File) string {
+	var lines []string
+	normalizeBody(t, f, f.Body, schema.Body.(*hclsyntax.Body), "", &lines)
+	return strings.Join(lines, "\n")
+}
+
+// normalizeBody adds the lines of a body to lines, with the path of the body as a prefix.
+func normalizeBody(t *testing.T, f *hcl.File, body hcl.Body, schema *hclsyntax.Body, prefix string, lines *[]string) {
+	bodySchema := &hcl.BodySchema{}
+	seen := map[string]bool{}
+	for _, b := range schema.Blocks {
+		if !seen[b.Type] {
+			seen[b.Type] = true
+			labels := make([]string, len(b.Labels))
+			for i := range labels {
+				labels[i] = fmt.Sprintf("label%d", i)
+			}
+			bodySchema.Blocks = append(bodySchema.Blocks, hcl.BlockHeaderSchema{Type: b.Type, LabelNames: labels})
+		}
+	}
+
+	content, rest, diags := body.PartialContent(bodySchema)
+	if diags.HasErrors() {
+		t.Fatal(diags)
+	}
+	// the native syntax does not let JustAttributes skip the blocks of a schema
+	attrs := hcl.Attributes{}
+	if native, ok := body.(*hclsyntax.Body); ok {
+		for name, attr := range native.Attributes {
+			attrs[name] = attr.AsHCLAttribute()
+		}
+	} else if attrs, diags = rest.JustAttributes(); diags.HasErrors() {
+		t.Fatal(diags)
+	}
+	var attrLines []string
+	for name, attr := range attrs {
+		if name == "//" {
+			continue
+		}
+		attrLines = append(attrLines, fmt.Sprintf("%s%s = %s", prefix, name, normalizeExpr(t, f, name, attr.Expr)))
+	}
+	sort.Strings(attrLines)
+	*lines = append(*lines, attrLines...)
+
+	// the JSON syntax groups blocks by type, so blocks are sorted by path, keeping the order of
+	// the blocks with the same path
+	type blockLines struct {
+		path  string
+		lines []string
+	}
+	var blocks []blockLines
+	occurrences := map[string]int{}
+	for _, b := range content.Blocks {
+		path := prefix + b.Type
+		for _, label := range b.Labels {
+			path += fmt.Sprintf("[%q]", label)
+		}
+		nested := []string{path + " {"}
+		normalizeBody(t, f, b.Body, schemaBlock(schema, b, occurrences[path]), path+".", &nested)
+		occurrences[path]++
+		blocks = append(blocks, blockLines{path: path, lines: nested})
+	}
+	sort.SliceStable(blocks, func(i, j int) bool { return blocks[i].path < blocks[j].path })
+	for _, b := range blocks {
+		*lines = append(*lines, b.lines...)
+	}
+}
+
+// schemaBlock returns the body of the nth block of schema with the type and labels of b, or an
+// empty body if there is none.
+func schemaBlock(schema *hclsyntax.Body, b *hcl.Block, n int) *hclsyntax.Body {
+	for _, candidate := range schema.Blocks {
+		if candidate.Type == b.Type && strings.Join(candidate.Labels, "\x00") == strings.Join(b.Labels, "\x00") {
+			if n == 0 {
+				return candidate.Body
+			}
+			n--
+		}
+	}
+	return &hclsyntax.Body{}
+}
+
+// normalizeExpr returns a form of the expression of an attribute that does not depend on the
+// syntax.
+func normalizeExpr(t *testing.T, f *hcl.File, name string, expr hcl.Expression) string {
+	src := string(expr.Range().SliceBytes(f.Bytes))
+	switch name {
+	case "provider":
+		// terraform 0.11 quotes the provider
+		if v, diags := expr.Value(nil); !diags.HasErrors() && v.Type() == cty.String {
+			return v.AsString()
+		}
+		return src
+	case "depends_on", "ignore_changes":
+		// terraform 0.11 quotes the references
+		refs, diags := hcl.ExprList(expr)
+		if diags.HasErrors() {
+			t.Fatal(diags)
+		}
+		var names []string
+		for _, ref := range refs {
+			if v, diags := ref.Value(nil); !diags.HasErrors() {
+				names = append(names, v.AsString())
+			} else {
+				names = append(names, string(ref.Range().SliceBytes(f.Bytes)))
+			}
+		}
+		return "[" + strings.Join(names, ", ") + "]"
+	case "type":
+		// terraform 0.11 uses the legacy type of a list variable
+		if v, diags := expr.Value(nil); !diags.HasErrors() && v.Type() == cty.String {
+			src = v.AsString()
+		}
+		if src == "list" {
+			src = "list(string)"
+		}
+		return src
+	}
+
+	if len(expr.Variables()) == 0 {
+		v, diags := expr.Value(evalContext)
+		if diags.HasErrors() {
+			t.Fatal(diags)
+		}
+		return ctyString(v)
+	}
+	// an expression with references is compared as the string that holds it in the JSON syntax
+	if strings.HasSuffix(f.Body.MissingItemRange().Filename, JSONSuffix) {
+		var value interface{}
+		if err := json.Unmarshal([]byte(src), &value); err != nil {
+			t.Fatal(err)
+		}
+		return jsonString(value)
+	}
+	switch expr := expr.(type) {
+	case *hclsyntax.TupleConsExpr:
+		var values []string
+		for _, element := range expr.Exprs {
+			values = append(values, normalizeExpr(t, f, "", element))
+		}
+		return "[" + strings.Join(values, ", ") + "]"
+	case *hclsyntax.ObjectConsExpr:
+		var values []string
+		for _, item := range expr.Items {
+			key := hcl.ExprAsKeyword(item.KeyExpr)
+			if key == "" {
+				k, diags := item.KeyExpr.Value(nil)
+				if diags.HasErrors() {
+					t.Fatal(diags)
+				}
+				key = k.AsString()
+			}
+			values = append(values, key+" = "+normalizeExpr(t, f, "", item.ValueExpr))
+		}
+		sort.Strings(values)
+		return "{" + strings.Join(values, ", ") + "}"
+	case *hclsyntax.TemplateExpr:
+		text := ""
+		for _, part := range expr.Parts {
+			if literal, ok := part.(*hclsyntax.LiteralValueExpr); ok && literal.Val.Type() == cty.String {
+				text += escapeTemplate(literal.Val.AsString())
+			} else {
+				text += "${" + string(part.Range().SliceBytes(f.Bytes)) + "}"
+			}
+		}
+		return templateString(text)
+	case *hclsyntax.TemplateWrapExpr:
+		return templateString("${" + string(expr.Wrapped.Range().SliceBytes(f.Bytes)) + "}")
+	}
+	return templateString("${" + src + "}")
+}
+
+// jsonString returns a JSON value of an expression with references in the form of normalizeExpr.
+func jsonString(value interface{}) string {
+	switch value := value.(type) {
+	case string:
+		return templateString(value)
+	case bool:
+		return fmt.Sprintf("%q", fmt.Sprint(value))
+	case float64:
+		return fmt.Sprintf("%q", strconv.FormatFloat(value, 'f', -1, 64))
+	case []interface{}:
+		var values []string
+		for _, element := range value {
+			values = append(values, jsonString(element))
+		}
+		return "[" + strings.Join(values, ", ") + "]"
+	case map[string]interface{}:
+		var values []string
+		for key, element := range value {
+			values = append(values, key+" = "+jsonString(element))
+		}
+		sort.Strings(values)
+		return "{" + strings.Join(values, ", ") + "}"
+	}
+	return "null"
+}
+
+// templateString returns a string template, as the JSON syntax writes it, without spaces.  A
+// template that is a single interpolation is the interpolated expression, and one without any is
+// a quoted literal.
+func templateString(s string) string {
+	if !strings.Contains(s, "${") {
+		return fmt.Sprintf("%q", s)
+	}
+	if strings.HasPrefix(s, "${") && strings.HasSuffix(s, "}") && strings.Count(s, "${") == 1 {
+		s = s[2 : len(s)-1]
+	}
+	return strings.Join(strings.Fields(s), "")
+}
+
+// ctyString returns a value as a string, converting bools and numbers as terraform converts them.
+func ctyString(v cty.Value) string {
+	switch {
+	case v.IsNull():
+		return "null"
+	case v.Type() == cty.String:
+		return fmt.Sprintf("%q", v.AsString())
+	case v.Type() == cty.Bool:
+		return fmt.Sprintf("%q", fmt.Sprint(v.True()))
+	case v.Type() == cty.Number:
+		return fmt.Sprintf("%q", v.AsBigFloat().Text('f', -1))
+	case v.Type().IsTupleType() || v.Type().IsListType():
+		var values []string
+		for it := v.ElementIterator(); it.Next(); {
+			_, element := it.Element()
+			values = append(values, ctyString(element))
+		}
+		return "[" + strings.Join(values, ", ") + "]"
+	case v.Type().IsObjectType() || v.Type().IsMapType():
+		var values []string
+		for it := v.ElementIterator(); it.Next(); {
+			key, element := it.Element()
+			values = append(values, key.AsString()+" = "+ctyString(element))
+		}
+		sort.Strings(values)
+		return "{" + strings.Join(values, ", ") + "}"
+	}
+	return v.GoString()
+}
+
+// lineDiff returns the lines of expected and actual that the other one does not have.
+func lineDiff(expected, actual string) string {
+	count := map[string]int{}
+	for _, line := range strings.Split(expected, "\n") {
+		count[line]++
+	}
+	for _, line := range strings.Split(actual, "\n") {
+		count[line]--
+	}
+	var diff []string
+	for line, n := range count {
+		if n > 0 {
+			diff = append(diff, "- "+line)
+		} else if n < 0 {
+			diff = append(diff, "+ "+line)
+		}
+	}
+	sort.Strings(diff)
+	return strings.Join(diff, "\n")
+}
@@ -0,0 +1,395 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package builder
+
+import (
+	"sort"
+
+	"github.com/GoogleCloudPlatform/gke-terraform-generator/pkg/api"
+)
+
+// defaultMasterCIDRBlock is the range of the control plane of a private cluster whose network
+// does not set one.
+const defaultMasterCIDRBlock = "192.168.254.0/28"
+
+// mainFile returns the main.tf of a cluster, with the providers, the cluster and its node pools.
+func mainFile(cluster *api.GkeTF, p *parameters) *file {
+	f := newFile("main.tf", "Builder based terraform")
+	for _, name := range []string{"google", "google-beta"} {
+		provider := f.block("provider", name)
+		provider.set("project", expression("var.project_id"))
+		provider.set("region", expression("var.region"))
+	}
+
+	addCluster(&f.body, &cluster.Spec, p)
+	if cluster.Spec.NodePools != nil {
+		for _, pool := range *cluster.Spec.NodePools {
+			addNodePool(&f.body, &cluster.Spec, pool, p)
+		}
+	}
+	return f
+}
+
+// addCluster adds the google_container_cluster resource.
+func addCluster(b *body, spec *api.ClusterSpec, p *parameters) {
+	r := b.block("resource", "google_container_cluster", "cluster")
+	r.set("provider", reference("google-beta"))
+	r.set("name", expression("var.cluster_name"))
+	r.set("project", expression("var.project_id"))
+
+	if spec.Regional.IsTrue() {
+		r.comment("Regional Cluster")
+		r.set("location", expression("var.region"))
+		if hasZones(spec) {
+			r.set("node_locations", expression("var.zones"))
+		}
+	} else {
+		r.comment("Zonal Cluster")
+		r.set("location", expression("var.zones[0]"))
+		if hasZones(spec) {
+			r.comment("Remove the first zone and list just the remaining zones")
+			r.set("node_locations", expression("slice(var.zones, 1, length(var.zones))"))
+		}
+	}
+
+	network := "google_compute_network.network"
+	subnetwork := "google_compute_subnetwork.subnetwork"
+	if spec.Network.Spec.Existing != nil {
+		network = "data." + network
+		subnetwork = "data." + subnetwork
+	}
+	r.set("network", expression(network+".self_link"))
+	r.set("subnetwork", expression(subnetwork+".self_link"))
+
+	r.set("min_master_version", p.value(stringValue(spec.Version), "spec.version", spec.Version))
+	r.set("logging_service", p.value(stringValue(deref(spec.Addons.Logging)), "spec.addons.logging", spec.Addons.Logging))
+	r.set("monitoring_service", p.value(stringValue(deref(spec.Addons.Monitoring)), "spec.addons.monitoring", spec.Addons.Monitoring))
+	r.set("remove_default_node_pool", p.value(boolValue(spec.RemoveDefaultNodePool.IsTrue()), "spec.removeDefaultNodePool", spec.RemoveDefaultNodePool))
+	r.set("initial_node_count", numberValue(1))
+
+	r.comment("Disable legacy ABAC. The default is false, but explicitly ensuring it's off")
+	r.set("enable_legacy_abac", boolValue(false))
+	r.comment("Enable Binary Authorization")
+	r.set("enable_binary_authorization", p.value(boolValue(spec.Addons.BinaryAuth.IsTrue()), "spec.addons.binaryAuth", spec.Addons.BinaryAuth))
+	r.comment("Default Maximum Pods Per Node for all Node Pools",
+		"NodePool max_pods_per_node overrides for that node pool")
+	r.set("default_max_pods_per_node", p.value(numberValue(spec.DefaultMaxPodsPerNode), "spec.defaultMaxPodsPerNode", spec.DefaultMaxPodsPerNode))
+
+	if spec.DatabaseEncryption != nil {
+		r.comment("Application layer secrets encryption")
+		encryption := r.block("database_encryption")
+		encryption.set("key_name", p.value(stringValue(deref(spec.DatabaseEncryption.KeyName)), "spec.databaseEncryption.keyName", spec.DatabaseEncryption.KeyName))
+		encryption.set("state", p.value(stringValue(deref(spec.DatabaseEncryption.State)), "spec.databaseEncryption.state", spec.DatabaseEncryption.State))
+	}
+
+	if spec.ResourceUsageExportConfig != nil {
+		r.comment("Export usage to BigQuery")
+		export := r.block("resource_usage_export_config")
+		export.set("enable_network_egress_metering", p.value(boolValue(spec.ResourceUsageExportConfig.EnableNetworkEgressMetering.IsTrue()),
+			"spec.resourceUsageExportConfig.enableNetworkEgressMetering", spec.ResourceUsageExportConfig.EnableNetworkEgressMetering))
+		export.block("bigquery_destination").set("dataset_id", p.value(stringValue(deref(spec.ResourceUsageExportConfig.DatasetId)),
+			"spec.resourceUsageExportConfig.datasetId", spec.ResourceUsageExportConfig.DatasetId))
+	}
+
+	addAddons(&r.body, spec.Addons, p)
+
+	if spec.Tpu.IsSet() {
+		r.comment("Enable TPU support for the cluster")
+		r.set("enable_tpu", p.value(boolValue(spec.Tpu.IsTrue()), "spec.tpu", spec.Tpu))
+	}
+	if spec.IntraNodeVisibility.IsSet() {
+		r.comment("Enable intranode visibility",
+			"Requires enabling VPC Flow Logging on the subnet first")
+		r.set("enable_intranode_visibility", p.value(boolValue(spec.IntraNodeVisibility.IsTrue()), "spec.intraNodeVisibility", spec.IntraNodeVisibility))
+	}
+	if spec.Alpha.IsSet() {
+		r.comment("Enable Kubernetes Alpha support",
+			"NOTE: This cluster will only live for 30 days")
+		r.set("enable_kubernetes_alpha", p.value(boolValue(spec.Alpha.IsTrue()), "spec.alpha", spec.Alpha))
+	}
+
+	r.block("pod_security_policy_config").set("enabled", p.value(boolValue(spec.Addons.PodSecurityPolicy.IsTrue()), "spec.addons.podSecurityPolicy", spec.Addons.PodSecurityPolicy))
+	r.block("vertical_pod_autoscaling").set("enabled", p.value(boolValue(spec.Addons.VPA.IsTrue()), "spec.addons.vpa", spec.Addons.VPA))
+
+	if spec.WorkloadIdentityConfig != nil {
+		r.comment("Enable workload identity")
+		r.block("workload_identity_config").set("identity_namespace", p.value(stringValue(deref(spec.WorkloadIdentityConfig.IdentityNamespace)),
+			"spec.workloadIdentityConfig.identityNamespace", spec.WorkloadIdentityConfig.IdentityNamespace))
+	}
+
+	r.comment("Disable basic authentication and cert-based authentication.",
+		"Empty fields for username and password are how to \"disable\" the",
+		"credentials from being generated.")
+	auth := r.block("master_auth")
+	auth.set("username", stringValue(""))
+	auth.set("password", stringValue(""))
+	auth.block("client_certificate_config").set("issue_client_certificate", p.value(boolValue(spec.IssueClientCertificate.IsTrue()),
+		"spec.issueClientCertificate", spec.IssueClientCertificate))
+
+	r.comment("Enable network policy configurations (like Calico) - for some reason this",
+		"has to be in here twice.")
+	r.block("network_policy").set("enabled", p.value(boolValue(spec.Addons.NetworkPolicy.IsTrue()), "spec.addons.networkPolicy", spec.Addons.NetworkPolicy))
+
+	if spec.MaintenanceStartTime != nil {
+		r.comment("Set the maintenance window.")
+		r.block("maintenance_policy").block("daily_maintenance_window").set("start_time", p.value(stringValue(*spec.MaintenanceStartTime),
+			"spec.maintenanceStartTime", spec.MaintenanceStartTime))
+	}
+
+	r.comment("Allocate IPs in our subnetwork")
+	ipAllocation := r.block("ip_allocation_policy")
+	ipAllocation.set("use_ip_aliases", boolValue(true))
+	if existing := spec.Network.Spec.Existing; existing != nil {
+		ipAllocation.set("cluster_secondary_range_name", p.value(stringValue(existing.PodRangeName), "spec.network.spec.existing.podRangeName", existing.PodRangeName))
+		ipAllocation.set("services_secondary_range_name", p.value(stringValue(existing.ServiceRangeName), "spec.network.spec.existing.serviceRangeName", existing.ServiceRangeName))
+	} else {
+		ipAllocation.set("cluster_secondary_range_name", expression("google_compute_subnetwork.subnetwork.secondary_ip_range.0.range_name"))
+		ipAllocation.set("services_secondary_range_name", expression("google_compute_subnetwork.subnetwork.secondary_ip_range.1.range_name"))
+	}
+
+	if spec.MasterAuthorizedNetworksConfig != nil && len(*spec.MasterAuthorizedNetworksConfig) > 0 {
+		r.comment("Specify the list of CIDRs which can access the master's API")
+		networks := r.block("master_authorized_networks_config")
+		for _, network := range *spec.MasterAuthorizedNetworksConfig {
+			cidr := networks.block("cidr_blocks")
+			cidr.set("cidr_block", stringValue(deref(network.CidrBlock)))
+			cidr.set("display_name", stringValue(deref(network.DisplayName)))
+		}
+	}
+
+	if spec.Private.IsTrue() {
+		var masterCIDRBlock value = stringValue(defaultMasterCIDRBlock)
+		if spec.Network.Spec.MasterIPV4CIDRBlock != "" {
+			masterCIDRBlock = p.value(stringValue(spec.Network.Spec.MasterIPV4CIDRBlock), "spec.network.spec.masterIPV4CIDRBlock", spec.Network.Spec.MasterIPV4CIDRBlock)
+		}
+		r.comment("Configure the cluster to have private nodes and private control plane access only")
+		private := r.block("private_cluster_config")
+		private.set("enable_private_endpoint", boolValue(true))
+		private.set("enable_private_nodes", boolValue(true))
+		private.set("master_ipv4_cidr_block", masterCIDRBlock)
+	}
+
+	r.block("lifecycle").set("ignore_changes", listValue{reference("initial_node_count")})
+
+	timeouts := r.block("timeouts")
+	for _, operation := range []string{"create", "update", "delete"} {
+		timeouts.set(operation, stringValue("30m"))
+	}
+
+	dependencies := []string{
+		"google_project_service.service",
+		"google_project_iam_member.service-account",
+		"google_project_iam_member.service-account-custom",
+	}
+	if existing := spec.Network.Spec.Existing; existing != nil {
+		if existing.HostProjectId != "" {
+			dependencies = append(dependencies,
+				"google_compute_subnetwork_iam_member.gke-network-user",
+				"google_compute_subnetwork_iam_member.cloudservices-network-user",
+				"google_project_iam_member.host-service-agent-user")
+		}
+	} else if spec.Private.IsTrue() {
+		dependencies = append(dependencies, "google_compute_router_nat.nat")
+	}
+	r.set("depends_on", referenceList(dependencies...))
+}
+
+// addAddons adds the addons_config block of the cluster.
+func addAddons(b *body, addons *api.AddonsSpec, p *parameters) {
+	b.comment("Configure various addons")
+	config := b.block("addons_config")
+
+	config.comment("Disable the Kubernetes dashboard, which is often an attack vector. The",
+		"cluster can still be managed via the GKE UI.")
+	config.block("kubernetes_dashboard").set("disabled", boolValue(true))
+
+	config.comment("Enable network policy (Calico)")
+	config.block("network_policy_config").set("disabled", not(p.value(boolValue(addons.NetworkPolicy.IsTrue()), "spec.addons.networkPolicy", addons.NetworkPolicy)))
+
+	config.comment("Provide the ability to scale pod replicas based on real-time metrics")
+	config.block("horizontal_pod_autoscaling").set("disabled", not(p.value(boolValue(addons.HPA.IsTrue()), "spec.addons.hpa", addons.HPA)))
+
+	istio := config.block("istio_config")
+	istio.comment("AUTH_MUTUAL_TLS ensures strict mTLS",
+		"AUTH_NONE is required for cloud run")
+	istio.set("disabled", not(p.value(boolValue(addons.Istio.IsTrue()), "spec.addons.istio", addons.Istio)))
+	istio.set("auth", stringValue("AUTH_MUTUAL_TLS"))
+
+	config.block("cloudrun_config").set("disabled", not(p.value(boolValue(addons.Cloudrun.IsTrue()), "spec.addons.cloudrun", addons.Cloudrun)))
+}
+
+// addNodePool adds the google_container_node_pool resource of a node pool.  The taints, labels
+// and tags of the cluster are added to those of the node pool.
+func addNodePool(b *body, spec *api.ClusterSpec, pool *api.GkeNodePool, p *parameters) {
+	r := b.block("resource", "google_container_node_pool", pool.Name+"-np")
+	r.set("provider", reference("google-beta"))
+	r.set("name", stringValue(pool.Name))
+	if spec.Regional.IsTrue() {
+		r.set("location", expression("var.region"))
+	} else {
+		r.set("location", expression("var.zones[0]"))
+	}
+	r.set("cluster", expression("google_container_cluster.cluster.name"))
+	r.set("node_count", p.value(numberValue(pool.Spec.InitialNodeCount), "spec.nodePools.spec.initialNodeCount", pool.Spec.InitialNodeCount, pool.Name))
+	r.set("max_pods_per_node", p.value(numberValue(pool.Spec.MaxPodsPerNode), "spec.nodePools.spec.maxPodsPerNode", pool.Spec.MaxPodsPerNode, pool.Name))
+	if pool.Spec.Version != nil {
+		r.set("version", p.value(stringValue(*pool.Spec.Version), "spec.nodePools.spec.version", pool.Spec.Version, pool.Name))
+	}
+
+	autoscaling := r.block("autoscaling")
+	autoscaling.set("min_node_count", p.value(numberValue(pool.Spec.MinCount), "spec.nodePools.spec.minCount", pool.Spec.MinCount, pool.Name))
+	autoscaling.set("max_node_count", p.value(numberValue(pool.Spec.MaxCount), "spec.nodePools.spec.maxCount", pool.Spec.MaxCount, pool.Name))
+
+	management := r.block("management")
+	management.set("auto_repair", p.value(boolValue(pool.Spec.AutoRepair.IsTrue()), "spec.nodePools.spec.autoRepair", pool.Spec.AutoRepair, pool.Name))
+	management.set("auto_upgrade", p.value(boolValue(pool.Spec.AutoUpgrade.IsTrue()), "spec.nodePools.spec.autoUpgrade", pool.Spec.AutoUpgrade, pool.Name))
+
+	config := r.block("node_config")
+	config.set("machine_type", p.value(stringValue(pool.Spec.MachineType), "spec.nodePools.spec.machineType", pool.Spec.MachineType, pool.Name))
+	config.set("disk_type", p.value(stringValue(pool.Spec.DiskType), "spec.nodePools.spec.diskType", pool.Spec.DiskType, pool.Name))
+	config.set("disk_size_gb", p.value(numberValue(pool.Spec.DiskSizeGB), "spec.nodePools.spec.diskSizeGB", pool.Spec.DiskSizeGB, pool.Name))
+	config.set("image_type", p.value(stringValue(pool.Spec.ImageType), "spec.nodePools.spec.imageType", pool.Spec.ImageType, pool.Name))
+	config.set("preemptible", p.value(boolValue(pool.Spec.Preemptible.IsTrue()), "spec.nodePools.spec.preemptible", pool.Spec.Preemptible, pool.Name))
+	config.set("local_ssd_count", p.value(numberValue(pool.Spec.LocalSSDCount), "spec.nodePools.spec.localSSDCount", pool.Spec.LocalSSDCount, pool.Name))
+
+	if pool.Spec.ServiceAccount != nil {
+		config.comment("Use a custom service account for this node pool")
+		config.set("service_account", p.value(stringValue(*pool.Spec.ServiceAccount), "spec.nodePools.spec.serviceAccount", pool.Spec.ServiceAccount, pool.Name))
+	} else {
+		config.comment("Use the cluster created service account for this node pool")
+		config.set("service_account", expression("google_service_account.gke-sa.email"))
+	}
+	if pool.Spec.MinCpuPlatform != "" {
+		config.set("min_cpu_platform", p.value(stringValue(pool.Spec.MinCpuPlatform), "spec.nodePools.spec.minCpuPlatform", pool.Spec.MinCpuPlatform, pool.Name))
+	}
+
+	if pool.Spec.AcceleratorType != nil {
+		accelerator := config.block("guest_accelerator")
+		accelerator.set("type", p.value(stringValue(*pool.Spec.AcceleratorType), "spec.nodePools.spec.acceleratorType", pool.Spec.AcceleratorType, pool.Name))
+		accelerator.set("count", p.value(numberValue(pool.Spec.AcceleratorCount), "spec.nodePools.spec.acceleratorCount", pool.Spec.AcceleratorCount, pool.Name))
+	}
+
+	config.set("oauth_scopes", p.value(stringList(optionalList(pool.Spec.OauthScopes)...), "spec.nodePools.spec.oauthScopes", pool.Spec.OauthScopes, pool.Name))
+
+	if pool.Spec.Gvisor.IsTrue() {
+		config.comment("Enable GKE Sandbox (Gvisor) on this node pool")
+		config.block("sandbox_config").set("sandbox_type", stringValue("gvisor"))
+	}
+
+	for _, taints := range []*[]api.TaintSpec{spec.Taints, pool.Spec.Taints} {
+		if taints == nil {
+			continue
+		}
+		for _, taint := range *taints {
+			t := config.block("taint")
+			t.set("key", stringValue(taint.Key))
+			if taint.Value != "" {
+				t.set("value", stringValue(taint.Value))
+			}
+			t.set("effect", stringValue(taint.Effect))
+		}
+	}
+
+	if labels := mergeLabels(spec.Labels, pool.Spec.Labels); len(labels) > 0 {
+		config.set("labels", p.value(stringObject(labels), "spec.nodePools.spec.labels", labels, pool.Name))
+	}
+	if tags := append(optionalList(spec.Tags), optionalList(pool.Spec.Tags)...); len(tags) > 0 {
+		config.set("tags", p.value(stringList(tags...), "spec.nodePools.spec.tags", tags, pool.Name))
+	}
+
+	if pool.Spec.WorkloadMetadataConfig != nil {
+		config.comment("Protect node metadata")
+		config.block("workload_metadata_config").set("node_metadata", p.value(stringValue(deref(pool.Spec.WorkloadMetadataConfig.NodeMetadata)),
+			"spec.nodePools.spec.workloadMetadataConfig.nodeMetadata", pool.Spec.WorkloadMetadataConfig.NodeMetadata, pool.Name))
+	}
+
+	config.set("metadata", objectValue{
+		{
+			name:     "google-compute-enable-virtio-rng",
+			value:    stringValue("true"),
+			comments: []string{"Set metadata on the VM to supply more entropy"},
+		},
+		{
+			name:     "disable-legacy-endpoints",
+			value:    stringValue("true"),
+			comments: []string{"Explicitly remove GCE legacy metadata API endpoint"},
+		},
+	})
+
+	r.set("depends_on", referenceList("google_container_cluster.cluster"))
+}
+
+// mergeLabels returns the labels of the cluster and those of a node pool.  The label of the node
+// pool wins when both set a key.
+func mergeLabels(clusterLabels, poolLabels *map[string]string) map[string]string {
+	merged := map[string]string{}
+	for _, labels := range []*map[string]string{clusterLabels, poolLabels} {
+		if labels == nil {
+			continue
+		}
+		for key, value := range *labels {
+			merged[key] = value
+		}
+	}
+	return merged
+}
+
+// stringObject returns a map of strings as an object, sorted by key.
+func stringObject(m map[string]string) objectValue {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var object objectValue
+	for _, key := range keys {
+		object = append(object, &attribute{name: key, value: stringValue(m[key])})
+	}
+	return object
+}
+
+// hasZones returns true if the cluster lists its zones.
+func hasZones(spec *api.ClusterSpec) bool {
+	return spec.Zones != nil && len(*spec.Zones) > 0
+}
+
+// optionalList returns the values of an optional list.
+func optionalList(values *[]string) []string {
+	if values == nil {
+		return nil
+	}
+	return *values
+}
+
+// stringList returns a list of string literals.
+func stringList(values ...string) listValue {
+	list := listValue{}
+	for _, v := range values {
+		list = append(list, stringValue(v))
+	}
+	return list
+}
+
+// referenceList returns a list of references, as depends_on holds.
+func referenceList(values ...string) listValue {
+	list := listValue{}
+	for _, v := range values {
+		list = append(list, reference(v))
+	}
+	return list
+}
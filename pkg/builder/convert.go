@@ -0,0 +1,224 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package builder
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// ConvertJSON converts a terraform file in the native syntax, such as one rendered by the
+// templates, to the JSON syntax.  Values without references are written as JSON literals,
+// and the others as the strings that terraform interpolates, except for providers and the
+// resources of depends_on, which are references.  Comments are dropped.
+func ConvertJSON(name string, src []byte) ([]byte, error) {
+	f, diags := hclsyntax.ParseConfig(src, name, hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	c := &converter{src: src}
+	out := newFile(name)
+	if err := c.body(&out.body, f.Body.(*hclsyntax.Body), ""); err != nil {
+		return nil, err
+	}
+	return out.json()
+}
+
+// converter converts the syntax tree of a file in the native syntax to a body.
+type converter struct {
+	// src is the source of the file, whose ranges are the source of the expressions.
+	src []byte
+}
+
+// body adds the attributes and blocks of in to out, in the order of the source.  blockType is the
+// type of the block of in, or empty for a file.
+func (c *converter) body(out *body, in *hclsyntax.Body, blockType string) error {
+	var items []hclsyntax.Node
+	for _, attr := range in.Attributes {
+		items = append(items, attr)
+	}
+	for _, b := range in.Blocks {
+		items = append(items, b)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Range().Start.Byte < items[j].Range().Start.Byte
+	})
+
+	for _, item := range items {
+		switch item := item.(type) {
+		case *hclsyntax.Attribute:
+			if blockType == "variable" && item.Name == "type" && len(item.Expr.Variables()) > 0 {
+				// a type constraint, such as list(string), is not interpolated
+				out.set(item.Name, reference(c.source(item.Expr)))
+				continue
+			}
+			if item.Name == "provider" || item.Name == "depends_on" {
+				// a provider or a resource in depends_on is a reference, which is not interpolated
+				if v, ok := c.references(item.Expr); ok {
+					out.set(item.Name, v)
+					continue
+				}
+			}
+			v, err := c.value(item.Expr)
+			if err != nil {
+				return fmt.Errorf("%s: %v", item.NameRange, err)
+			}
+			out.set(item.Name, v)
+		case *hclsyntax.Block:
+			if err := c.body(&out.block(item.Type, item.Labels...).body, item.Body, item.Type); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// value returns the value of an expression.  Lists and objects are converted element by
+// element, so that objects keep the order of their keys.
+func (c *converter) value(expr hclsyntax.Expression) (value, error) {
+	switch expr.(type) {
+	case *hclsyntax.TupleConsExpr, *hclsyntax.ObjectConsExpr:
+	default:
+		if len(expr.Variables()) == 0 {
+			v, diags := expr.Value(nil)
+			if diags.HasErrors() {
+				return nil, diags
+			}
+			return literal(v)
+		}
+	}
+
+	switch expr := expr.(type) {
+	case *hclsyntax.TupleConsExpr:
+		list := listValue{}
+		for _, element := range expr.Exprs {
+			v, err := c.value(element)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		return list, nil
+	case *hclsyntax.ObjectConsExpr:
+		object := objectValue{}
+		for _, item := range expr.Items {
+			key := hcl.ExprAsKeyword(item.KeyExpr)
+			if key == "" {
+				k, diags := item.KeyExpr.Value(nil)
+				if diags.HasErrors() {
+					return nil, diags
+				}
+				if k.Type() != cty.String {
+					return nil, fmt.Errorf("the key of an object is a %s", k.Type().FriendlyName())
+				}
+				key = k.AsString()
+			}
+			v, err := c.value(item.ValueExpr)
+			if err != nil {
+				return nil, err
+			}
+			object = append(object, &attribute{name: key, value: v})
+		}
+		return object, nil
+	case *hclsyntax.TemplateWrapExpr:
+		return expression(c.source(expr.Wrapped)), nil
+	case *hclsyntax.TemplateExpr:
+		// the literal parts are escaped, and the others interpolated
+		text := ""
+		for _, part := range expr.Parts {
+			if literal, ok := part.(*hclsyntax.LiteralValueExpr); ok && literal.Val.Type() == cty.String {
+				text += escapeTemplate(literal.Val.AsString())
+				continue
+			}
+			text += "${" + c.source(part) + "}"
+		}
+		return template(text), nil
+	}
+	return expression(c.source(expr)), nil
+}
+
+// references returns the value of a reference, such as google-beta, or of a list of references,
+// and false for any other expression, such as a quoted reference of terraform 0.11.
+func (c *converter) references(expr hclsyntax.Expression) (value, bool) {
+	switch expr := expr.(type) {
+	case *hclsyntax.ScopeTraversalExpr:
+		return reference(c.source(expr)), true
+	case *hclsyntax.TupleConsExpr:
+		list := listValue{}
+		for _, element := range expr.Exprs {
+			traversal, ok := element.(*hclsyntax.ScopeTraversalExpr)
+			if !ok {
+				return nil, false
+			}
+			list = append(list, reference(c.source(traversal)))
+		}
+		return list, true
+	}
+	return nil, false
+}
+
+// source returns the source of an expression.
+func (c *converter) source(expr hclsyntax.Expression) string {
+	return string(expr.Range().SliceBytes(c.src))
+}
+
+// literal returns the value of an expression without references.
+func literal(v cty.Value) (value, error) {
+	if v.IsNull() {
+		return expression("null"), nil
+	}
+	t := v.Type()
+	switch {
+	case t == cty.String:
+		return stringValue(v.AsString()), nil
+	case t == cty.Bool:
+		return boolValue(v.True()), nil
+	case t == cty.Number:
+		n, accuracy := v.AsBigFloat().Int64()
+		if accuracy != 0 {
+			return nil, fmt.Errorf("%s is not an integer", v.AsBigFloat())
+		}
+		return numberValue(n), nil
+	case t.IsListType() || t.IsTupleType() || t.IsSetType():
+		list := listValue{}
+		for it := v.ElementIterator(); it.Next(); {
+			_, element := it.Element()
+			e, err := literal(element)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, e)
+		}
+		return list, nil
+	case t.IsMapType() || t.IsObjectType():
+		object := objectValue{}
+		for it := v.ElementIterator(); it.Next(); {
+			key, element := it.Element()
+			e, err := literal(element)
+			if err != nil {
+				return nil, err
+			}
+			object = append(object, &attribute{name: key.AsString(), value: e})
+		}
+		return object, nil
+	}
+	return nil, fmt.Errorf("unsupported value of type %s", t.FriendlyName())
+}
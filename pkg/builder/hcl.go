@@ -0,0 +1,365 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package builder
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+)
+
+const (
+	// heredocMarker delimits the heredocs of multi-line strings.
+	heredocMarker = "EOF"
+	// maxListWidth is the width of the values of the longest list that is written on one line.
+	maxListWidth = 60
+)
+
+// value is the value of an attribute, which can be written in the native syntax as tokens, or in
+// the JSON syntax as a value that encoding/json marshals.
+type value interface {
+	tokens() hclwrite.Tokens
+	json() interface{}
+}
+
+// stringValue is a string literal.  Its characters are escaped, including the ${ and %{ that
+// would otherwise start a template sequence.
+type stringValue string
+
+func (s stringValue) tokens() hclwrite.Tokens {
+	text := string(s)
+	if isMultiline(text) {
+		return heredoc(escapeTemplate(text))
+	}
+	return hclwrite.TokensForValue(cty.StringVal(text))
+}
+
+func (s stringValue) json() interface{} {
+	return escapeTemplate(string(s))
+}
+
+// boolValue is a bool literal.
+type boolValue bool
+
+func (b boolValue) tokens() hclwrite.Tokens {
+	return hclwrite.TokensForValue(cty.BoolVal(bool(b)))
+}
+
+func (b boolValue) json() interface{} {
+	return bool(b)
+}
+
+// numberValue is an integer literal.
+type numberValue int64
+
+func (n numberValue) tokens() hclwrite.Tokens {
+	return hclwrite.TokensForValue(cty.NumberIntVal(int64(n)))
+}
+
+func (n numberValue) json() interface{} {
+	return int64(n)
+}
+
+// expression is an HCL expression, such as var.project_id or a function call.  Expressions are
+// written by the builder and never hold input, which is always a literal.
+type expression string
+
+func (e expression) tokens() hclwrite.Tokens {
+	return lex(string(e))
+}
+
+func (e expression) json() interface{} {
+	return "${" + string(e) + "}"
+}
+
+// reference is an expression that the JSON syntax writes as a string without ${, such as the
+// references of depends_on or the type of a variable.
+type reference string
+
+func (r reference) tokens() hclwrite.Tokens {
+	return lex(string(r))
+}
+
+func (r reference) json() interface{} {
+	return string(r)
+}
+
+// template is a multi-line string template, whose ${ sequences are interpolated by terraform.
+// Like an expression it is written by the builder and never holds input.
+type template string
+
+func (t template) tokens() hclwrite.Tokens {
+	return heredoc(string(t))
+}
+
+func (t template) json() interface{} {
+	return string(t)
+}
+
+// listValue is a list.  Lists of more than two values, or that would make a long line, are
+// written one value per line.
+type listValue []value
+
+func (l listValue) tokens() hclwrite.Tokens {
+	width := 0
+	for _, v := range l {
+		width += len(v.tokens().Bytes())
+	}
+	multiline := len(l) > 2 || width > maxListWidth
+	tokens := hclwrite.Tokens{{Type: hclsyntax.TokenOBrack, Bytes: []byte("[")}}
+	for i, v := range l {
+		if multiline {
+			tokens = append(tokens, newline())
+		} else if i > 0 {
+			tokens = append(tokens, &hclwrite.Token{Type: hclsyntax.TokenComma, Bytes: []byte(",")})
+		}
+		tokens = append(tokens, v.tokens()...)
+		if multiline {
+			tokens = append(tokens, &hclwrite.Token{Type: hclsyntax.TokenComma, Bytes: []byte(",")})
+		}
+	}
+	if multiline {
+		tokens = append(tokens, newline())
+	}
+	return append(tokens, &hclwrite.Token{Type: hclsyntax.TokenCBrack, Bytes: []byte("]")})
+}
+
+func (l listValue) json() interface{} {
+	values := make([]interface{}, 0, len(l))
+	for _, v := range l {
+		values = append(values, v.json())
+	}
+	return values
+}
+
+// objectValue is an object, such as a map of labels.  Keys that are not identifiers are quoted.
+type objectValue []*attribute
+
+func (o objectValue) tokens() hclwrite.Tokens {
+	tokens := hclwrite.Tokens{{Type: hclsyntax.TokenOBrace, Bytes: []byte("{")}}
+	for _, attr := range o {
+		tokens = append(tokens, newline())
+		tokens = append(tokens, commentTokens(attr.comments)...)
+		if hclsyntax.ValidIdentifier(attr.name) {
+			tokens = append(tokens, &hclwrite.Token{Type: hclsyntax.TokenIdent, Bytes: []byte(attr.name)})
+		} else {
+			tokens = append(tokens, hclwrite.TokensForValue(cty.StringVal(attr.name))...)
+		}
+		tokens = append(tokens, &hclwrite.Token{Type: hclsyntax.TokenEqual, Bytes: []byte("=")})
+		tokens = append(tokens, attr.value.tokens()...)
+	}
+	if len(o) > 0 {
+		tokens = append(tokens, newline())
+	}
+	return append(tokens, &hclwrite.Token{Type: hclsyntax.TokenCBrace, Bytes: []byte("}")})
+}
+
+func (o objectValue) json() interface{} {
+	object := &jsonObject{}
+	for _, attr := range o {
+		object.set(attr.name, attr.value.json())
+	}
+	return object
+}
+
+// attribute is an attribute of a body, or an entry of an object.
+type attribute struct {
+	name     string
+	value    value
+	comments []string
+}
+
+// block is a block, such as a resource, with its labels.
+type block struct {
+	typeName string
+	labels   []string
+	comments []string
+	body
+}
+
+// body is the content of a file or a block, attributes and nested blocks in order.
+type body struct {
+	items []interface{}
+	// next is the comment of the next item.
+	next []string
+}
+
+// comment sets the comment that is written before the next attribute or block, one line per
+// element.
+func (b *body) comment(lines ...string) {
+	b.next = lines
+}
+
+// set adds an attribute.
+func (b *body) set(name string, v value) {
+	b.items = append(b.items, &attribute{name: name, value: v, comments: b.next})
+	b.next = nil
+}
+
+// block adds a nested block and returns it.
+func (b *body) block(typeName string, labels ...string) *block {
+	nested := &block{typeName: typeName, labels: labels, comments: b.next}
+	b.next = nil
+	b.items = append(b.items, nested)
+	return nested
+}
+
+// writeTo appends the items of the body to an hclwrite body.  Blocks, and the attributes that
+// have a comment, are separated from the other items by a blank line.
+func (b *body) writeTo(out *hclwrite.Body) {
+	var previous interface{}
+	for _, item := range b.items {
+		switch item := item.(type) {
+		case *attribute:
+			separate := len(item.comments) > 0
+			switch previous := previous.(type) {
+			case nil:
+				separate = false
+			case *block:
+				separate = true
+			case *attribute:
+				separate = separate || len(previous.comments) > 0
+			}
+			if separate {
+				out.AppendNewline()
+			}
+			out.AppendUnstructuredTokens(commentTokens(item.comments))
+			out.SetAttributeRaw(item.name, item.value.tokens())
+		case *block:
+			if previous != nil {
+				out.AppendNewline()
+			}
+			out.AppendUnstructuredTokens(commentTokens(item.comments))
+			nested := out.AppendNewBlock(item.typeName, item.labels)
+			item.body.writeTo(nested.Body())
+		}
+		previous = item
+	}
+}
+
+// json returns the body in the JSON syntax.  A block is a property named after its type, whose
+// value nests its body in an object per label.  Blocks with the same type and labels are an
+// array of bodies.
+func (b *body) json(comment []string) *jsonObject {
+	object := &jsonObject{}
+	if len(comment) > 0 {
+		// terraform ignores the // property of a block
+		object.set("//", strings.Join(comment, "\n"))
+	}
+	for _, item := range b.items {
+		switch item := item.(type) {
+		case *attribute:
+			object.set(item.name, item.value.json())
+		case *block:
+			parent := object
+			keys := append([]string{item.typeName}, item.labels...)
+			for _, key := range keys[:len(keys)-1] {
+				nested, ok := parent.get(key).(*jsonObject)
+				if !ok {
+					nested = &jsonObject{}
+					parent.set(key, nested)
+				}
+				parent = nested
+			}
+			key := keys[len(keys)-1]
+			nested := item.body.json(item.comments)
+			switch existing := parent.get(key).(type) {
+			case nil:
+				parent.set(key, nested)
+			case *jsonObject:
+				parent.set(key, []interface{}{existing, nested})
+			case []interface{}:
+				parent.set(key, append(existing, nested))
+			}
+		}
+	}
+	return object
+}
+
+// lex returns the tokens of an expression written by the builder.  It panics if the expression is
+// not valid, which is a bug of the builder.
+func lex(src string) hclwrite.Tokens {
+	native, diags := hclsyntax.LexExpression([]byte(src), "", hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		panic(fmt.Sprintf("builder: invalid expression %q: %v", src, diags))
+	}
+	var tokens hclwrite.Tokens
+	end := 0
+	for _, t := range native {
+		if t.Type == hclsyntax.TokenEOF {
+			break
+		}
+		tokens = append(tokens, &hclwrite.Token{
+			Type:         t.Type,
+			Bytes:        t.Bytes,
+			SpacesBefore: t.Range.Start.Byte - end,
+		})
+		end = t.Range.End.Byte
+	}
+	// the newline after the end of a heredoc is added by the attribute
+	for len(tokens) > 0 && tokens[len(tokens)-1].Type == hclsyntax.TokenNewline {
+		tokens = tokens[:len(tokens)-1]
+	}
+	return tokens
+}
+
+// heredoc returns the tokens of a heredoc that holds text, which ends with a newline.
+func heredoc(text string) hclwrite.Tokens {
+	return lex("<<" + heredocMarker + "\n" + text + heredocMarker + "\n")
+}
+
+// isMultiline returns true if s is a string of several lines that can be written as a heredoc.
+func isMultiline(s string) bool {
+	if !strings.HasSuffix(s, "\n") || strings.Count(s, "\n") < 2 {
+		return false
+	}
+	for _, line := range strings.Split(s, "\n") {
+		if strings.TrimSpace(line) == heredocMarker || strings.ContainsAny(line, "\r") {
+			return false
+		}
+	}
+	return true
+}
+
+// escapeTemplate escapes the ${ and %{ sequences of a string, so that terraform does not
+// interpolate them.
+func escapeTemplate(s string) string {
+	s = strings.Replace(s, "${", "$${", -1)
+	return strings.Replace(s, "%{", "%%{", -1)
+}
+
+// commentTokens returns the tokens of a comment, one // line per element.
+func commentTokens(lines []string) hclwrite.Tokens {
+	var tokens hclwrite.Tokens
+	for _, line := range lines {
+		text := "//"
+		if line != "" {
+			text += " " + line
+		}
+		tokens = append(tokens, &hclwrite.Token{Type: hclsyntax.TokenComment, Bytes: []byte(text + "\n")})
+	}
+	return tokens
+}
+
+// newline returns a newline token.
+func newline() *hclwrite.Token {
+	return &hclwrite.Token{Type: hclsyntax.TokenNewline, Bytes: []byte("\n")}
+}
@@ -0,0 +1,273 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package builder
+
+import (
+	"github.com/GoogleCloudPlatform/gke-terraform-generator/pkg/api"
+)
+
+// bastionReadyCommand blocks until the bastion host accepts ssh connections.
+const bastionReadyCommand = `        READY=""
+        for i in $(seq 1 20); do
+          if gcloud compute ssh ${local.hostname} --project ${var.project_id} --zone ${local.bastion_zone} --command uptime; then
+            READY="yes"
+            break;
+          fi
+          echo "Waiting for ${local.hostname} to initialize..."
+          sleep 10;
+        done
+        if [[ -z $READY ]]; then
+          echo "${local.hostname} failed to start in time."
+          echo "Please verify that the instance starts and then re-run ` + "`terraform apply`" + `"
+          exit 1
+        fi
+`
+
+// networkFile returns the network.tf of a cluster, with its service account, the project
+// services, and its network, which is either looked up or created with a NAT and a bastion host.
+func networkFile(cluster *api.GkeTF, p *parameters) *file {
+	spec := &cluster.Spec
+	f := newFile("network.tf", "GCP Services and Networking")
+
+	f.comment("Create the GKE service account")
+	sa := f.block("resource", "google_service_account", "gke-sa")
+	sa.set("account_id", expression(`format("%s-node-sa", var.cluster_name)`))
+	sa.set("display_name", stringValue("GKE Security Service Account"))
+	sa.set("project", expression("var.project_id"))
+
+	f.comment("Add the service account to the project")
+	addServiceAccountRoles(&f.body, "service-account", "var.service_account_iam_roles")
+	f.comment("Add user-specified roles")
+	addServiceAccountRoles(&f.body, "service-account-custom", "var.service_account_custom_iam_roles")
+
+	f.comment("Enable required services on the project")
+	services := f.block("resource", "google_project_service", "service")
+	services.set("count", expression("length(var.project_services)"))
+	services.set("project", expression("var.project_id"))
+	services.set("service", expression("element(var.project_services, count.index)"))
+	services.comment("Do not disable the service on destroy. On destroy, we are going to",
+		"destroy the project, but we need the APIs available to destroy the",
+		"underlying resources.")
+	services.set("disable_on_destroy", boolValue(false))
+
+	if existing := spec.Network.Spec.Existing; existing != nil {
+		addExistingNetwork(&f.body, spec, existing, p)
+		return f
+	}
+	addNetwork(&f.body, spec, p)
+	if spec.Private.IsTrue() {
+		addNAT(&f.body)
+		addBastion(&f.body, spec, p)
+	}
+	return f
+}
+
+// addServiceAccountRoles adds the google_project_iam_member resource that grants the roles of a
+// list variable to the service account of the nodes.
+func addServiceAccountRoles(b *body, name, roles string) {
+	r := b.block("resource", "google_project_iam_member", name)
+	r.set("count", expression("length("+roles+")"))
+	r.set("project", expression("var.project_id"))
+	r.set("role", expression("element("+roles+", count.index)"))
+	r.set("member", expression(`format("serviceAccount:%s", google_service_account.gke-sa.email)`))
+}
+
+// addExistingNetwork adds the data sources of an existing network and, for a Shared VPC, the
+// permissions that the service project needs on the host project.
+func addExistingNetwork(b *body, spec *api.ClusterSpec, existing *api.ExistingNetworkSpec, p *parameters) {
+	b.comment("Look up the existing network, which may be in a Shared VPC host project")
+	network := b.block("data", "google_compute_network", "network")
+	network.set("name", p.value(stringValue(spec.Network.Name), "spec.network.metadata.name", spec.Network.Name))
+	network.set("project", expression("var.network_project_id"))
+
+	b.comment("Look up the existing subnet and its secondary ranges")
+	subnetwork := b.block("data", "google_compute_subnetwork", "subnetwork")
+	subnetwork.set("name", p.value(stringValue(spec.Network.Spec.SubnetName), "spec.network.spec.subnetName", spec.Network.Spec.SubnetName))
+	subnetwork.set("project", expression("var.network_project_id"))
+	subnetwork.set("region", expression("var.region"))
+
+	if existing.HostProjectId == "" {
+		return
+	}
+
+	b.comment("The service project whose GKE service agent uses the Shared VPC")
+	b.block("data", "google_project", "project").set("project_id", expression("var.project_id"))
+
+	locals := b.block("locals")
+	locals.set("gke_service_agent", expression(`format("serviceAccount:service-%s@container-engine-robot.iam.gserviceaccount.com", data.google_project.project.number)`))
+	locals.set("cloud_services_member", expression(`format("serviceAccount:%s@cloudservices.gserviceaccount.com", data.google_project.project.number)`))
+
+	b.comment("Allow the GKE service agent of the service project to use the subnet")
+	gkeUser := addNetworkUser(b, "gke-network-user", "local.gke_service_agent")
+	gkeUser.set("depends_on", referenceList("google_project_service.service"))
+
+	b.comment("Allow the Google APIs service account of the service project to use the subnet")
+	addNetworkUser(b, "cloudservices-network-user", "local.cloud_services_member")
+
+	b.comment("Allow the GKE service agent of the service project to manage the firewall",
+		"rules of the cluster in the host project")
+	agent := b.block("resource", "google_project_iam_member", "host-service-agent-user")
+	agent.set("project", expression("var.network_project_id"))
+	agent.set("role", stringValue("roles/container.hostServiceAgentUser"))
+	agent.set("member", expression("local.gke_service_agent"))
+	agent.set("depends_on", referenceList("google_project_service.service"))
+}
+
+// addNetworkUser adds a google_compute_subnetwork_iam_member resource that allows a member to use
+// the existing subnet.
+func addNetworkUser(b *body, name, member string) *block {
+	r := b.block("resource", "google_compute_subnetwork_iam_member", name)
+	r.set("provider", reference("google-beta"))
+	r.set("project", expression("var.network_project_id"))
+	r.set("region", expression("var.region"))
+	r.set("subnetwork", expression("data.google_compute_subnetwork.subnetwork.name"))
+	r.set("role", stringValue("roles/compute.networkUser"))
+	r.set("member", expression(member))
+	return r
+}
+
+// addNetwork adds the network of the cluster and its subnet, with the secondary ranges of the
+// pods and the services.
+func addNetwork(b *body, spec *api.ClusterSpec, p *parameters) {
+	b.comment("Create a network for GKE")
+	network := b.block("resource", "google_compute_network", "network")
+	network.set("name", expression(`format("%s-network", var.cluster_name)`))
+	network.set("project", expression("var.project_id"))
+	network.set("auto_create_subnetworks", boolValue(false))
+	network.set("depends_on", referenceList("google_project_service.service"))
+
+	b.comment("Create subnets")
+	subnetwork := b.block("resource", "google_compute_subnetwork", "subnetwork")
+	subnetwork.set("name", p.value(stringValue(spec.Network.Spec.SubnetName), "spec.network.spec.subnetName", spec.Network.Spec.SubnetName))
+	subnetwork.set("project", expression("var.project_id"))
+	subnetwork.set("network", expression("google_compute_network.network.self_link"))
+	subnetwork.set("region", expression("var.region"))
+	subnetwork.set("ip_cidr_range", p.value(stringValue(spec.Network.Spec.SubnetRange), "spec.network.spec.subnetRange", spec.Network.Spec.SubnetRange))
+	subnetwork.set("private_ip_google_access", boolValue(true))
+
+	pods := subnetwork.block("secondary_ip_range")
+	pods.set("range_name", expression(`format("%s-pod-range", var.cluster_name)`))
+	pods.set("ip_cidr_range", p.value(stringValue(spec.Network.Spec.PodSubnetRange), "spec.network.spec.podSubnetRange", spec.Network.Spec.PodSubnetRange))
+
+	services := subnetwork.block("secondary_ip_range")
+	services.set("range_name", expression(`format("%s-svc-range", var.cluster_name)`))
+	services.set("ip_cidr_range", p.value(stringValue(spec.Network.Spec.ServiceSubnetRange), "spec.network.spec.serviceSubnetRange", spec.Network.Spec.ServiceSubnetRange))
+}
+
+// addNAT adds the Cloud NAT that the private nodes reach the internet through.
+func addNAT(b *body) {
+	b.comment("Create an external NAT IP")
+	address := b.block("resource", "google_compute_address", "nat")
+	address.set("name", expression(`format("%s-nat-ip", var.cluster_name)`))
+	address.set("project", expression("var.project_id"))
+	address.set("region", expression("var.region"))
+	address.set("depends_on", referenceList("google_project_service.service"))
+
+	b.comment("Create a cloud router for use by the Cloud NAT")
+	router := b.block("resource", "google_compute_router", "router")
+	router.set("name", expression(`format("%s-cloud-router", var.cluster_name)`))
+	router.set("project", expression("var.project_id"))
+	router.set("region", expression("var.region"))
+	router.set("network", expression("google_compute_network.network.self_link"))
+	router.block("bgp").set("asn", numberValue(64514))
+
+	b.comment("Create a NAT router so the nodes can reach DockerHub, etc")
+	nat := b.block("resource", "google_compute_router_nat", "nat")
+	nat.set("name", expression(`format("%s-cloud-nat", var.cluster_name)`))
+	nat.set("project", expression("var.project_id"))
+	nat.set("router", expression("google_compute_router.router.name"))
+	nat.set("region", expression("var.region"))
+	nat.set("nat_ip_allocate_option", stringValue("MANUAL_ONLY"))
+	nat.set("nat_ips", listValue{expression("google_compute_address.nat.self_link")})
+	nat.set("source_subnetwork_ip_ranges_to_nat", stringValue("LIST_OF_SUBNETWORKS"))
+
+	subnetwork := nat.block("subnetwork")
+	subnetwork.set("name", expression("google_compute_subnetwork.subnetwork.self_link"))
+	subnetwork.set("source_ip_ranges_to_nat", stringList("PRIMARY_IP_RANGE", "LIST_OF_SECONDARY_IP_RANGES"))
+	subnetwork.set("secondary_ip_range_names", listValue{
+		expression("google_compute_subnetwork.subnetwork.secondary_ip_range.0.range_name"),
+		expression("google_compute_subnetwork.subnetwork.secondary_ip_range.1.range_name"),
+	})
+}
+
+// addBastion adds the bastion host that the private control plane is reached through.
+func addBastion(b *body, spec *api.ClusterSpec, p *parameters) {
+	b.comment("Bastion Host")
+	locals := b.block("locals")
+	locals.set("hostname", expression(`format("%s-bastion", var.cluster_name)`))
+	if spec.Bastion != nil {
+		locals.set("bastion_zone", p.value(stringValue(spec.Bastion.Spec.Zone), "spec.bastion.spec.zone", spec.Bastion.Spec.Zone))
+	} else {
+		locals.comment("If zone a does not exist in a region please create a yaml spec for the bastion.")
+		locals.set("bastion_zone", expression(`format("%s-a", var.region)`))
+	}
+
+	b.comment("Dedicated service account for the Bastion instance")
+	sa := b.block("resource", "google_service_account", "bastion")
+	sa.set("account_id", expression(`format("%s-bastion-sa", var.cluster_name)`))
+	sa.set("display_name", stringValue("GKE Bastion SA"))
+
+	b.comment("Allow access to the Bastion Host via SSH")
+	firewall := b.block("resource", "google_compute_firewall", "bastion-ssh")
+	firewall.set("name", expression(`format("%s-bastion-ssh", var.cluster_name)`))
+	firewall.set("network", expression("google_compute_network.network.name"))
+	firewall.set("direction", stringValue("INGRESS"))
+	firewall.set("project", expression("var.project_id"))
+	firewall.set("source_ranges", stringList("0.0.0.0/0"))
+	allow := firewall.block("allow")
+	allow.set("protocol", stringValue("tcp"))
+	allow.set("ports", stringList("22"))
+	firewall.set("target_tags", stringList("bastion"))
+
+	b.comment("The user-data script on Bastion instance provisioning")
+	b.block("data", "template_file", "startup_script").set("template",
+		stringValue("sudo apt-get update -y\nsudo apt-get install -y tinyproxy\n"))
+
+	b.comment("The Bastion Host")
+	instance := b.block("resource", "google_compute_instance", "instance")
+	instance.set("name", expression("local.hostname"))
+	instance.set("machine_type", stringValue("g1-small"))
+	instance.set("zone", expression("local.bastion_zone"))
+	instance.set("project", expression("var.project_id"))
+	instance.set("tags", stringList("bastion"))
+
+	instance.comment("Specify the Operating System Family and version.")
+	instance.block("boot_disk").block("initialize_params").set("image", stringValue("debian-cloud/debian-9"))
+
+	instance.comment("Ensure that when the bastion host is booted, it will have tinyproxy")
+	instance.set("metadata_startup_script", expression("data.template_file.startup_script.rendered"))
+
+	instance.comment("Define a network interface in the correct subnet.")
+	networkInterface := instance.block("network_interface")
+	networkInterface.set("subnetwork", expression("google_compute_subnetwork.subnetwork.name"))
+	networkInterface.comment("Add an ephemeral external IP.")
+	networkInterface.block("access_config")
+
+	instance.comment("Allow the instance to be stopped by terraform when updating configuration")
+	instance.set("allow_stopping_for_update", boolValue(true))
+
+	serviceAccount := instance.block("service_account")
+	serviceAccount.set("email", expression("google_service_account.bastion.email"))
+	serviceAccount.set("scopes", stringList("cloud-platform"))
+
+	instance.comment("local-exec providers may run before the host has fully initialized. However, they",
+		"are run sequentially in the order they were defined.",
+		"",
+		"This provider is used to block the subsequent providers until the instance",
+		"is available.")
+	instance.block("provisioner", "local-exec").set("command", template(bastionReadyCommand))
+}
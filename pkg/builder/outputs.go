@@ -0,0 +1,156 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package builder
+
+import (
+	"github.com/GoogleCloudPlatform/gke-terraform-generator/pkg/api"
+)
+
+// outputsFile returns the outputs.tf of a cluster.
+func outputsFile(cluster *api.GkeTF) *file {
+	spec := &cluster.Spec
+	f := newFile("outputs.tf")
+
+	addOutput(&f.body, "cluster_name", "Cluster name", expression("var.cluster_name"))
+	addOutput(&f.body, "cluster_location", "Cluster location", expression("var.region"))
+	addOutput(&f.body, "cluster_endpoint", "Cluster endpoint", expression("google_container_cluster.cluster.endpoint"))
+
+	certificate := f.block("output", "cluster_ca_certificate")
+	certificate.set("sensitive", boolValue(true))
+	certificate.set("description", stringValue("Cluster ca certificate (base64 encoded)"))
+	certificate.set("value", expression("google_container_cluster.cluster.master_auth[0].cluster_ca_certificate"))
+
+	addOutput(&f.body, "cluster_id", "Cluster id", expression("google_container_cluster.cluster.id"))
+	addOutput(&f.body, "master_version", "Current master kubernetes version", expression("google_container_cluster.cluster.master_version"))
+	addOutput(&f.body, "network", "Self link of the network of the cluster", expression("google_container_cluster.cluster.network"))
+	addOutput(&f.body, "subnetwork", "Self link of the subnetwork of the cluster", expression("google_container_cluster.cluster.subnetwork"))
+	addOutput(&f.body, "service_account", "Email of the service account of the nodes", expression("google_service_account.gke-sa.email"))
+	poolNames := listValue{}
+	if spec.NodePools != nil {
+		for _, pool := range *spec.NodePools {
+			poolNames = append(poolNames, expression("google_container_node_pool."+pool.Name+"-np.name"))
+		}
+	}
+	addOutput(&f.body, "node_pools_names", "List of node pools names", poolNames)
+
+	if spec.Private.IsTrue() {
+		addOutput(&f.body, "get_credentials", "Gcloud get-credentials command",
+			expression(`format("gcloud container clusters get-credentials --project %s --region %s --internal-ip %s", var.project_id, var.region, var.cluster_name)`))
+	} else {
+		addOutput(&f.body, "get_credentials", "Gcloud get-credentials command",
+			expression(`format("gcloud container clusters get-credentials --project %s --region %s %s", var.project_id, var.region, var.cluster_name)`))
+	}
+
+	if spec.Private.IsTrue() && spec.Network.Spec.Existing == nil {
+		addOutput(&f.body, "bastion_ssh", "Gcloud compute ssh to the bastion host command",
+			expression(`format("gcloud compute ssh %s --project %s --zone %s -- -L8888:127.0.0.1:8888", google_compute_instance.instance.name, var.project_id, google_compute_instance.instance.zone)`))
+		addOutput(&f.body, "bastion_kubectl", "kubectl command using the local proxy once the bastion_ssh command is running",
+			stringValue("HTTPS_PROXY=localhost:8888 kubectl get pods --all-namespaces"))
+	}
+	return f
+}
+
+// addOutput adds an output.
+func addOutput(b *body, name, description string, v value) {
+	output := b.block("output", name)
+	output.set("description", stringValue(description))
+	output.set("value", v)
+}
+
+// variablesFile returns the variables.tf of a cluster, whose defaults are the values of the
+// cluster.
+func variablesFile(cluster *api.GkeTF, p *parameters) *file {
+	spec := &cluster.Spec
+	f := newFile("variables.tf")
+
+	addVariable(&f.body, "project_id", "GCP Project ID where all components will be deployed.\n",
+		p.tfvar(stringValue(spec.ProjectId), "project_id", spec.ProjectId))
+	addListVariable(&f.body, "project_services", "The GCP APIs that should be enabled in this project.\n",
+		stringList(
+			"cloudresourcemanager.googleapis.com",
+			"container.googleapis.com",
+			"compute.googleapis.com",
+			"iam.googleapis.com",
+			"logging.googleapis.com",
+			"monitoring.googleapis.com",
+		))
+	addVariable(&f.body, "region", "GCP Region where the components will be deployed.\n",
+		p.tfvar(stringValue(spec.Region), "region", spec.Region))
+
+	if existing := spec.Network.Spec.Existing; existing != nil {
+		networkProjectID := existing.HostProjectId
+		if networkProjectID == "" {
+			networkProjectID = spec.ProjectId
+		}
+		addVariable(&f.body, "network_project_id", "GCP Project ID that owns the existing network, which is the Shared VPC host\n"+
+			"project when the network is shared.\n", p.tfvar(stringValue(networkProjectID), "network_project_id", networkProjectID))
+	}
+
+	if hasZones(spec) {
+		addVariable(&f.body, "zones", "", p.tfvar(stringList(*spec.Zones...), "zones", spec.Zones))
+	}
+
+	f.comment("GKE")
+	addVariable(&f.body, "cluster_name", "The name of the GKE cluster", p.tfvar(stringValue(cluster.Name), "cluster_name", cluster.Name))
+	addListVariable(&f.body, "service_account_iam_roles", "List of the default IAM roles to attach to the service account on the\n"+
+		"GKE Nodes.\n", stringList(
+		"roles/logging.logWriter",
+		"roles/monitoring.metricWriter",
+		"roles/monitoring.viewer",
+	))
+	addListVariable(&f.body, "service_account_custom_iam_roles", "List of arbitrary additional IAM roles to attach to the service account on\n"+
+		"the GKE nodes.\n", stringList())
+	return f
+}
+
+// addVariable adds a variable with a default value.
+func addVariable(b *body, name, description string, defaultValue value) {
+	variable := b.block("variable", name)
+	variable.set("description", stringValue(description))
+	variable.set("default", defaultValue)
+}
+
+// addListVariable adds a variable of a list of strings.
+func addListVariable(b *body, name, description string, defaultValue listValue) {
+	variable := b.block("variable", name)
+	variable.set("type", reference("list(string)"))
+	variable.set("description", stringValue(description))
+	variable.set("default", defaultValue)
+}
+
+// versionsFile returns the versions.tf of a cluster, with the versions of terraform and of the
+// providers that it targets.  The required_providers have a source from terraform 0.13.
+func versionsFile(terraform *api.TerraformSpec, syntax api.TerraformSyntax) *file {
+	f := newFile("versions.tf", "The versions of terraform and of the providers that the terraform targets")
+	b := f.block("terraform")
+	b.set("required_version", stringValue(terraform.RequiredVersion))
+	providers := b.block("required_providers")
+	for _, provider := range []struct{ name, version string }{
+		{"google", terraform.GoogleProvider},
+		{"google-beta", terraform.GoogleBetaProvider},
+	} {
+		if syntax < api.Terraform013 {
+			providers.set(provider.name, stringValue(provider.version))
+			continue
+		}
+		providers.set(provider.name, objectValue{
+			{name: "source", value: stringValue("hashicorp/" + provider.name)},
+			{name: "version", value: stringValue(provider.version)},
+		})
+	}
+	return f
+}
@@ -0,0 +1,218 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// GCP Services and Networking
+
+// Create the GKE service account
+resource "google_service_account" "gke-sa" {
+  account_id   = format("%s-node-sa", var.cluster_name)
+  display_name = "GKE Security Service Account"
+  project      = var.project_id
+}
+
+// Add the service account to the project
+resource "google_project_iam_member" "service-account" {
+  count   = length(var.service_account_iam_roles)
+  project = var.project_id
+  role    = element(var.service_account_iam_roles, count.index)
+  member  = format("serviceAccount:%s", google_service_account.gke-sa.email)
+}
+
+// Add user-specified roles
+resource "google_project_iam_member" "service-account-custom" {
+  count   = length(var.service_account_custom_iam_roles)
+  project = var.project_id
+  role    = element(var.service_account_custom_iam_roles, count.index)
+  member  = format("serviceAccount:%s", google_service_account.gke-sa.email)
+}
+
+// Enable required services on the project
+resource "google_project_service" "service" {
+  count   = length(var.project_services)
+  project = var.project_id
+  service = element(var.project_services, count.index)
+
+  // Do not disable the service on destroy. On destroy, we are going to
+  // destroy the project, but we need the APIs available to destroy the
+  // underlying resources.
+  disable_on_destroy = false
+}
+
+// Create a network for GKE
+resource "google_compute_network" "network" {
+  name                    = format("%s-network", var.cluster_name)
+  project                 = var.project_id
+  auto_create_subnetworks = false
+  depends_on              = [google_project_service.service]
+}
+
+// Create subnets
+resource "google_compute_subnetwork" "subnetwork" {
+  name                     = "my-subnet"
+  project                  = var.project_id
+  network                  = google_compute_network.network.self_link
+  region                   = var.region
+  ip_cidr_range            = "10.0.0.0/24"
+  private_ip_google_access = true
+
+  secondary_ip_range {
+    range_name    = format("%s-pod-range", var.cluster_name)
+    ip_cidr_range = "10.1.0.0/16"
+  }
+
+  secondary_ip_range {
+    range_name    = format("%s-svc-range", var.cluster_name)
+    ip_cidr_range = "10.2.0.0/20"
+  }
+}
+
+// Create an external NAT IP
+resource "google_compute_address" "nat" {
+  name       = format("%s-nat-ip", var.cluster_name)
+  project    = var.project_id
+  region     = var.region
+  depends_on = [google_project_service.service]
+}
+
+// Create a cloud router for use by the Cloud NAT
+resource "google_compute_router" "router" {
+  name    = format("%s-cloud-router", var.cluster_name)
+  project = var.project_id
+  region  = var.region
+  network = google_compute_network.network.self_link
+
+  bgp {
+    asn = 64514
+  }
+}
+
+// Create a NAT router so the nodes can reach DockerHub, etc
+resource "google_compute_router_nat" "nat" {
+  name                               = format("%s-cloud-nat", var.cluster_name)
+  project                            = var.project_id
+  router                             = google_compute_router.router.name
+  region                             = var.region
+  nat_ip_allocate_option             = "MANUAL_ONLY"
+  nat_ips                            = [google_compute_address.nat.self_link]
+  source_subnetwork_ip_ranges_to_nat = "LIST_OF_SUBNETWORKS"
+
+  subnetwork {
+    name                    = google_compute_subnetwork.subnetwork.self_link
+    source_ip_ranges_to_nat = ["PRIMARY_IP_RANGE", "LIST_OF_SECONDARY_IP_RANGES"]
+    secondary_ip_range_names = [
+      google_compute_subnetwork.subnetwork.secondary_ip_range.0.range_name,
+      google_compute_subnetwork.subnetwork.secondary_ip_range.1.range_name,
+    ]
+  }
+}
+
+// Bastion Host
+locals {
+  hostname = format("%s-bastion", var.cluster_name)
+
+  // If zone a does not exist in a region please create a yaml spec for the bastion.
+  bastion_zone = format("%s-a", var.region)
+}
+
+// Dedicated service account for the Bastion instance
+resource "google_service_account" "bastion" {
+  account_id   = format("%s-bastion-sa", var.cluster_name)
+  display_name = "GKE Bastion SA"
+}
+
+// Allow access to the Bastion Host via SSH
+resource "google_compute_firewall" "bastion-ssh" {
+  name          = format("%s-bastion-ssh", var.cluster_name)
+  network       = google_compute_network.network.name
+  direction     = "INGRESS"
+  project       = var.project_id
+  source_ranges = ["0.0.0.0/0"]
+
+  allow {
+    protocol = "tcp"
+    ports    = ["22"]
+  }
+
+  target_tags = ["bastion"]
+}
+
+// The user-data script on Bastion instance provisioning
+data "template_file" "startup_script" {
+  template = <<EOF
+sudo apt-get update -y
+sudo apt-get install -y tinyproxy
+EOF
+}
+
+// The Bastion Host
+resource "google_compute_instance" "instance" {
+  name         = local.hostname
+  machine_type = "g1-small"
+  zone         = local.bastion_zone
+  project      = var.project_id
+  tags         = ["bastion"]
+
+  // Specify the Operating System Family and version.
+  boot_disk {
+    initialize_params {
+      image = "debian-cloud/debian-9"
+    }
+  }
+
+  // Ensure that when the bastion host is booted, it will have tinyproxy
+  metadata_startup_script = data.template_file.startup_script.rendered
+
+  // Define a network interface in the correct subnet.
+  network_interface {
+    subnetwork = google_compute_subnetwork.subnetwork.name
+
+    // Add an ephemeral external IP.
+    access_config {
+    }
+  }
+
+  // Allow the instance to be stopped by terraform when updating configuration
+  allow_stopping_for_update = true
+
+  service_account {
+    email  = google_service_account.bastion.email
+    scopes = ["cloud-platform"]
+  }
+
+  // local-exec providers may run before the host has fully initialized. However, they
+  // are run sequentially in the order they were defined.
+  //
+  // This provider is used to block the subsequent providers until the instance
+  // is available.
+  provisioner "local-exec" {
+    command = <<EOF
+        READY=""
+        for i in $(seq 1 20); do
+          if gcloud compute ssh ${local.hostname} --project ${var.project_id} --zone ${local.bastion_zone} --command uptime; then
+            READY="yes"
+            break;
+          fi
+          echo "Waiting for ${local.hostname} to initialize..."
+          sleep 10;
+        done
+        if [[ -z $READY ]]; then
+          echo "${local.hostname} failed to start in time."
+          echo "Please verify that the instance starts and then re-run `terraform apply`"
+          exit 1
+        fi
+EOF
+  }
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// GCP Services and Networking
+
+// Create the GKE service account
+resource "google_service_account" "gke-sa" {
+  account_id   = format("%s-node-sa", var.cluster_name)
+  display_name = "GKE Security Service Account"
+  project      = var.project_id
+}
+
+// Add the service account to the project
+resource "google_project_iam_member" "service-account" {
+  count   = length(var.service_account_iam_roles)
+  project = var.project_id
+  role    = element(var.service_account_iam_roles, count.index)
+  member  = format("serviceAccount:%s", google_service_account.gke-sa.email)
+}
+
+// Add user-specified roles
+resource "google_project_iam_member" "service-account-custom" {
+  count   = length(var.service_account_custom_iam_roles)
+  project = var.project_id
+  role    = element(var.service_account_custom_iam_roles, count.index)
+  member  = format("serviceAccount:%s", google_service_account.gke-sa.email)
+}
+
+// Enable required services on the project
+resource "google_project_service" "service" {
+  count   = length(var.project_services)
+  project = var.project_id
+  service = element(var.project_services, count.index)
+
+  // Do not disable the service on destroy. On destroy, we are going to
+  // destroy the project, but we need the APIs available to destroy the
+  // underlying resources.
+  disable_on_destroy = false
+}
+
+// Create a network for GKE
+resource "google_compute_network" "network" {
+  name                    = format("%s-network", var.cluster_name)
+  project                 = var.project_id
+  auto_create_subnetworks = false
+  depends_on              = [google_project_service.service]
+}
+
+// Create subnets
+resource "google_compute_subnetwork" "subnetwork" {
+  name                     = "my-subnet"
+  project                  = var.project_id
+  network                  = google_compute_network.network.self_link
+  region                   = var.region
+  ip_cidr_range            = "10.0.0.0/24"
+  private_ip_google_access = true
+
+  secondary_ip_range {
+    range_name    = format("%s-pod-range", var.cluster_name)
+    ip_cidr_range = "10.1.0.0/16"
+  }
+
+  secondary_ip_range {
+    range_name    = format("%s-svc-range", var.cluster_name)
+    ip_cidr_range = "10.2.0.0/20"
+  }
+}
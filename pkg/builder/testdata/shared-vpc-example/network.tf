@@ -0,0 +1,105 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// GCP Services and Networking
+
+// Create the GKE service account
+resource "google_service_account" "gke-sa" {
+  account_id   = format("%s-node-sa", var.cluster_name)
+  display_name = "GKE Security Service Account"
+  project      = var.project_id
+}
+
+// Add the service account to the project
+resource "google_project_iam_member" "service-account" {
+  count   = length(var.service_account_iam_roles)
+  project = var.project_id
+  role    = element(var.service_account_iam_roles, count.index)
+  member  = format("serviceAccount:%s", google_service_account.gke-sa.email)
+}
+
+// Add user-specified roles
+resource "google_project_iam_member" "service-account-custom" {
+  count   = length(var.service_account_custom_iam_roles)
+  project = var.project_id
+  role    = element(var.service_account_custom_iam_roles, count.index)
+  member  = format("serviceAccount:%s", google_service_account.gke-sa.email)
+}
+
+// Enable required services on the project
+resource "google_project_service" "service" {
+  count   = length(var.project_services)
+  project = var.project_id
+  service = element(var.project_services, count.index)
+
+  // Do not disable the service on destroy. On destroy, we are going to
+  // destroy the project, but we need the APIs available to destroy the
+  // underlying resources.
+  disable_on_destroy = false
+}
+
+// Look up the existing network, which may be in a Shared VPC host project
+data "google_compute_network" "network" {
+  name    = "shared-network"
+  project = var.network_project_id
+}
+
+// Look up the existing subnet and its secondary ranges
+data "google_compute_subnetwork" "subnetwork" {
+  name    = "gke-subnet"
+  project = var.network_project_id
+  region  = var.region
+}
+
+// The service project whose GKE service agent uses the Shared VPC
+data "google_project" "project" {
+  project_id = var.project_id
+}
+
+locals {
+  gke_service_agent     = format("serviceAccount:service-%s@container-engine-robot.iam.gserviceaccount.com", data.google_project.project.number)
+  cloud_services_member = format("serviceAccount:%s@cloudservices.gserviceaccount.com", data.google_project.project.number)
+}
+
+// Allow the GKE service agent of the service project to use the subnet
+resource "google_compute_subnetwork_iam_member" "gke-network-user" {
+  provider   = google-beta
+  project    = var.network_project_id
+  region     = var.region
+  subnetwork = data.google_compute_subnetwork.subnetwork.name
+  role       = "roles/compute.networkUser"
+  member     = local.gke_service_agent
+  depends_on = [google_project_service.service]
+}
+
+// Allow the Google APIs service account of the service project to use the subnet
+resource "google_compute_subnetwork_iam_member" "cloudservices-network-user" {
+  provider   = google-beta
+  project    = var.network_project_id
+  region     = var.region
+  subnetwork = data.google_compute_subnetwork.subnetwork.name
+  role       = "roles/compute.networkUser"
+  member     = local.cloud_services_member
+}
+
+// Allow the GKE service agent of the service project to manage the firewall
+// rules of the cluster in the host project
+resource "google_project_iam_member" "host-service-agent-user" {
+  project    = var.network_project_id
+  role       = "roles/container.hostServiceAgentUser"
+  member     = local.gke_service_agent
+  depends_on = [google_project_service.service]
+}
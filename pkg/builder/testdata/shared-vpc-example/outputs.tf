@@ -0,0 +1,71 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+output "cluster_name" {
+  description = "Cluster name"
+  value       = var.cluster_name
+}
+
+output "cluster_location" {
+  description = "Cluster location"
+  value       = var.region
+}
+
+output "cluster_endpoint" {
+  description = "Cluster endpoint"
+  value       = google_container_cluster.cluster.endpoint
+}
+
+output "cluster_ca_certificate" {
+  sensitive   = true
+  description = "Cluster ca certificate (base64 encoded)"
+  value       = google_container_cluster.cluster.master_auth[0].cluster_ca_certificate
+}
+
+output "cluster_id" {
+  description = "Cluster id"
+  value       = google_container_cluster.cluster.id
+}
+
+output "master_version" {
+  description = "Current master kubernetes version"
+  value       = google_container_cluster.cluster.master_version
+}
+
+output "network" {
+  description = "Self link of the network of the cluster"
+  value       = google_container_cluster.cluster.network
+}
+
+output "subnetwork" {
+  description = "Self link of the subnetwork of the cluster"
+  value       = google_container_cluster.cluster.subnetwork
+}
+
+output "service_account" {
+  description = "Email of the service account of the nodes"
+  value       = google_service_account.gke-sa.email
+}
+
+output "node_pools_names" {
+  description = "List of node pools names"
+  value       = [google_container_node_pool.my-node-pool-np.name]
+}
+
+output "get_credentials" {
+  description = "Gcloud get-credentials command"
+  value       = format("gcloud container clusters get-credentials --project %s --region %s --internal-ip %s", var.project_id, var.region, var.cluster_name)
+}
@@ -0,0 +1,74 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+variable "project_id" {
+  description = "GCP Project ID where all components will be deployed.\n"
+  default     = ""
+}
+
+variable "project_services" {
+  type        = list(string)
+  description = "The GCP APIs that should be enabled in this project.\n"
+  default = [
+    "cloudresourcemanager.googleapis.com",
+    "container.googleapis.com",
+    "compute.googleapis.com",
+    "iam.googleapis.com",
+    "logging.googleapis.com",
+    "monitoring.googleapis.com",
+  ]
+}
+
+variable "region" {
+  description = "GCP Region where the components will be deployed.\n"
+  default     = "us-west1"
+}
+
+variable "network_project_id" {
+  description = <<EOF
+GCP Project ID that owns the existing network, which is the Shared VPC host
+project when the network is shared.
+EOF
+  default     = "my-host-project"
+}
+
+// GKE
+variable "cluster_name" {
+  description = "The name of the GKE cluster"
+  default     = "shared-vpc-cluster"
+}
+
+variable "service_account_iam_roles" {
+  type        = list(string)
+  description = <<EOF
+List of the default IAM roles to attach to the service account on the
+GKE Nodes.
+EOF
+  default = [
+    "roles/logging.logWriter",
+    "roles/monitoring.metricWriter",
+    "roles/monitoring.viewer",
+  ]
+}
+
+variable "service_account_custom_iam_roles" {
+  type        = list(string)
+  description = <<EOF
+List of arbitrary additional IAM roles to attach to the service account on
+the GKE nodes.
+EOF
+  default     = []
+}
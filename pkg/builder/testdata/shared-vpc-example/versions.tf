@@ -0,0 +1,26 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// The versions of terraform and of the providers that the terraform targets
+
+terraform {
+  required_version = ">= 0.12"
+
+  required_providers {
+    google      = "2.13.0"
+    google-beta = "2.13.0"
+  }
+}
@@ -0,0 +1,145 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package generator
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+
+	"github.com/GoogleCloudPlatform/gke-terraform-generator/pkg/builder"
+)
+
+// diffContext is the number of unchanged lines around each change of a diff.
+const diffContext = 3
+
+// Diff returns a unified diff, file by file, of the changes that writing files to dir would make.
+// The user sections of the existing files are kept, as a DirWriter keeps them, so that only the
+// changes to the generated terraform are shown.  The files that gke-tf generated in the
+// directories of files, but that files no longer has, are shown as removed, since terraform
+// would still load them.  The diff is
+// empty if dir is up to date.
+func Diff(dir string, files map[string][]byte) (string, error) {
+	generated, err := generatedFiles(dir, files)
+	if err != nil {
+		return "", err
+	}
+	names := sortedNames(files)
+	for _, name := range generated {
+		if _, ok := files[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var b bytes.Buffer
+	for _, name := range names {
+		fromFile, toFile := "a/"+name, "b/"+name
+		existing, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if os.IsNotExist(err) {
+			fromFile = "/dev/null"
+		} else if err != nil {
+			return "", err
+		}
+
+		content, ok := files[name]
+		if !ok {
+			toFile = "/dev/null"
+		} else if existing != nil && hasSections(name) {
+			// a file that was edited outside of its user sections is still compared, so that
+			// the edits show as changes that gen would undo
+			content, err = mergeSections(content, existing, true)
+			if err != nil {
+				return "", err
+			}
+		}
+		if bytes.Equal(content, existing) {
+			continue
+		}
+
+		diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+			A:        splitLines(existing),
+			B:        splitLines(content),
+			FromFile: fromFile,
+			ToFile:   toFile,
+			Context:  diffContext,
+		})
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(diff)
+	}
+	return b.String(), nil
+}
+
+// splitLines splits a file into lines that keep their newline.  An empty file has no lines.
+func splitLines(content []byte) []string {
+	if len(content) == 0 {
+		return nil
+	}
+	lines := difflib.SplitLines(string(content))
+	if content[len(content)-1] == '\n' {
+		// SplitLines adds a newline to the last line, which is empty here
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// generatedFiles returns the slash separated paths, relative to dir, of the terraform files that
+// gke-tf generated in the directories of files, in order: the .tf and .tfvars files with its
+// header, and the .tf.json and .tfvars.json files with its note.  Only the directories that files
+// are written to are read, and not their subdirectories, so that the files of the other clusters
+// in dir are left out.  A directory that does not exist has no files.
+func generatedFiles(dir string, files map[string][]byte) ([]string, error) {
+	dirs := map[string]bool{}
+	for name := range files {
+		dirs[path.Dir(name)] = true
+	}
+
+	var names []string
+	for subdir := range dirs {
+		infos, err := ioutil.ReadDir(filepath.Join(dir, filepath.FromSlash(subdir)))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, info := range infos {
+			name := path.Join(subdir, info.Name())
+			jsonName := strings.TrimSuffix(name, builder.JSONSuffix)
+			if info.IsDir() || !hasSections(jsonName) {
+				continue
+			}
+			content, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+			if err != nil {
+				return nil, err
+			}
+			if jsonName == name && headerPattern.Match(content) || jsonName != name && generatedJSON(content) {
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
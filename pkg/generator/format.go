@@ -0,0 +1,90 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package generator
+
+import (
+	"bytes"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+)
+
+// format formats a terraform file as terraform fmt does, and also removes the blank lines that
+// the templates leave behind: those at the start and end of the file or of a block, and every
+// blank line that follows another one.  The lines of heredocs are kept as they are.
+func format(content []byte) []byte {
+	heredoc := heredocLines(content)
+	lines := bytes.Split(content, []byte("\n"))
+
+	var b bytes.Buffer
+	var previous []byte
+	blank := false
+	for i, line := range lines {
+		if heredoc[i+1] {
+			b.Write(line)
+			b.WriteByte('\n')
+			blank = false
+			continue
+		}
+		trimmed := bytes.TrimSpace(line)
+		if len(trimmed) == 0 {
+			blank = true
+			continue
+		}
+		// a single blank line is kept between two lines, unless it would open or close a block
+		if blank && previous != nil && !opensBlock(previous) && !closesBlock(trimmed) {
+			b.WriteByte('\n')
+		}
+		b.Write(line)
+		b.WriteByte('\n')
+		previous = trimmed
+		blank = false
+	}
+	return hclwrite.Format(b.Bytes())
+}
+
+// opensBlock returns true if a trimmed line starts a block, a list or an object.
+func opensBlock(line []byte) bool {
+	last := line[len(line)-1]
+	return last == '{' || last == '[' || last == '('
+}
+
+// closesBlock returns true if a trimmed line ends a block, a list or an object.
+func closesBlock(line []byte) bool {
+	return line[0] == '}' || line[0] == ']' || line[0] == ')'
+}
+
+// heredocLines returns the numbers of the lines that are the contents of a heredoc, which
+// formatting must not change.
+func heredocLines(content []byte) map[int]bool {
+	lines := map[int]bool{}
+	tokens, _ := hclsyntax.LexConfig(content, "", hcl.Pos{Line: 1, Column: 1})
+	start := 0
+	for _, token := range tokens {
+		switch token.Type {
+		case hclsyntax.TokenOHeredoc:
+			start = token.Range.End.Line
+		case hclsyntax.TokenCHeredoc:
+			for line := start; line < token.Range.Start.Line; line++ {
+				lines[line] = true
+			}
+			start = 0
+		}
+	}
+	return lines
+}
@@ -0,0 +1,208 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package generator renders the terraform of GKE clusters in memory.
+//
+// Generate returns the terraform files of a cluster without touching the filesystem, so that
+// gke-tf can be embedded in other programs.  The files can then be written by a Writer, to a
+// directory, a tarball or a stream such as stdout:
+//
+//	if err := generator.Prepare(gkeTF); err != nil {
+//		return err
+//	}
+//	files, err := generator.Generate(ctx, gkeTF, generator.Options{TFType: templates.VANILLA})
+//	if err != nil {
+//		return err
+//	}
+//	return generator.NewDirWriter(dir, generator.DirOptions{}).WriteFiles(files)
+package generator
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/gke-terraform-generator/pkg/api"
+	"github.com/GoogleCloudPlatform/gke-terraform-generator/pkg/builder"
+	"github.com/GoogleCloudPlatform/gke-terraform-generator/pkg/ipam"
+	"github.com/GoogleCloudPlatform/gke-terraform-generator/pkg/templates"
+)
+
+// Options configures the terraform that Generate renders.
+type Options struct {
+	// TFType is the type of terraform to render, CFT, VANILLA, BUILDER or a type that was added
+	// to the registry of the templates package.
+	TFType templates.TFType
+	// SkipSyntaxCheck renders the files without parsing them as HCL.  Otherwise a file that is
+	// not valid HCL is a *templates.SyntaxError.
+	SkipSyntaxCheck bool
+	// NoFormat leaves the files as the templates render them.  Otherwise they are formatted as
+	// terraform fmt formats them, so that the output is stable from one version to the next.
+	NoFormat bool
+	// JSON renders the files in the JSON syntax of terraform, such as main.tf.json.  The rendered
+	// templates are parsed to be converted, so SkipSyntaxCheck does not apply, and neither does
+	// NoFormat.  The builder always writes valid, formatted terraform, so they never apply to it.
+	JSON bool
+	// Parameterize writes the values of the fields of the cluster as references to typed
+	// variables, which are declared in parameters.tf, with the values in terraform.tfvars.
+	Parameterize bool
+	// AsModule renders the terraform as a child module without providers, with an example root
+	// module that calls it, as AsModule returns it.
+	AsModule bool
+}
+
+// Prepare sets the defaults of gkeTF, plans its empty network ranges and validates it.  A
+// validation error is an api.Diagnostics.
+func Prepare(gkeTF *api.GkeTF) error {
+	if err := api.SetApiDefaultValues(gkeTF); err != nil {
+		return err
+	}
+	if err := ipam.FillNetworkSpec(&gkeTF.Spec); err != nil {
+		return err
+	}
+	return api.ValidateYamlInput(gkeTF)
+}
+
+// Generate renders the terraform of a cluster and returns the files, keyed by file name, such
+// as main.tf.  gkeTF is rendered as it is, so it should have been prepared by Prepare.
+//
+// Every .tf file starts with a header that holds its checksum, and ends with a user section whose
+// terraform a DirWriter keeps when it replaces the file.  JSON has no comments, so a .tf.json file
+// has neither, but its // property starts with a note that gke-tf generated it.
+func Generate(ctx context.Context, gkeTF *api.GkeTF, opts Options) (map[string][]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if opts.TFType == templates.BUILDER {
+		// a module is made from the native syntax, and then converted
+		files, err := builder.Build(gkeTF, builder.Options{JSON: opts.JSON && !opts.AsModule, Parameterize: opts.Parameterize})
+		if err != nil {
+			return nil, err
+		}
+		if opts.AsModule {
+			if files, err = AsModule(files, gkeTF.Name, nil); err != nil {
+				return nil, err
+			}
+			if opts.JSON {
+				if files, err = convertJSON(files); err != nil {
+					return nil, err
+				}
+			}
+		}
+		return stampFiles(files)
+	}
+	gkeTemplates, err := templates.NewGKETemplates(opts.TFType)
+	if err != nil {
+		return nil, err
+	}
+	gkeTemplates.SkipSyntaxCheck = opts.SkipSyntaxCheck
+	gkeTemplates.Parameterize = opts.Parameterize
+	files, err := gkeTemplates.Render(gkeTF)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if opts.AsModule {
+		target, err := templates.NewTarget(gkeTF, gkeTemplates.Terraform)
+		if err != nil {
+			return nil, err
+		}
+		if files, err = AsModule(files, gkeTF.Name, target); err != nil {
+			return nil, err
+		}
+	}
+	if opts.JSON {
+		if files, err = convertJSON(files); err != nil {
+			return nil, err
+		}
+		return stampFiles(files)
+	}
+	if !opts.NoFormat {
+		for name, b := range files {
+			files[name] = format(b)
+		}
+	}
+	return stampFiles(files)
+}
+
+// convertJSON converts rendered files to the JSON syntax, such as main.tf.json.
+func convertJSON(files map[string][]byte) (map[string][]byte, error) {
+	converted := make(map[string][]byte, len(files))
+	for name, b := range files {
+		j, err := builder.ConvertJSON(name, b)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		converted[name+builder.JSONSuffix] = j
+	}
+	return converted, nil
+}
+
+// RootModule returns the files of a root module that uses each cluster as a module, in the JSON
+// syntax with opts.JSON.  The terraform of each cluster must be in the subdirectory named after
+// it, as InDirectory places it.
+func RootModule(clusterNames []string, opts Options) (map[string][]byte, error) {
+	b, err := templates.RenderRootModule(clusterNames)
+	if err != nil {
+		return nil, err
+	}
+	if opts.JSON {
+		files, err := convertJSON(map[string][]byte{templates.RootModuleFileName: b})
+		if err != nil {
+			return nil, err
+		}
+		return stampFiles(files)
+	}
+	if !opts.NoFormat {
+		b = format(b)
+	}
+	return stampFiles(map[string][]byte{templates.RootModuleFileName: b})
+}
+
+// stampFiles adds the gke-tf header and the default user section to every .tf and .tfvars file,
+// and the note of gke-tf to the // property of every .tf.json and .tfvars.json file.
+func stampFiles(files map[string][]byte) (map[string][]byte, error) {
+	stamped := make(map[string][]byte, len(files))
+	for name, b := range files {
+		stampFile := stamp
+		switch {
+		case hasSections(name):
+		case strings.HasSuffix(name, builder.JSONSuffix) && hasSections(strings.TrimSuffix(name, builder.JSONSuffix)):
+			stampFile = stampJSON
+		default:
+			stamped[name] = b
+			continue
+		}
+		s, err := stampFile(b)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		stamped[name] = s
+	}
+	return stamped, nil
+}
+
+// InDirectory returns files with their names moved into the directory dir.
+func InDirectory(dir string, files map[string][]byte) map[string][]byte {
+	moved := make(map[string][]byte, len(files))
+	for name, b := range files {
+		moved[path.Join(dir, name)] = b
+	}
+	return moved
+}
@@ -0,0 +1,817 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package generator
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+
+	"github.com/GoogleCloudPlatform/gke-terraform-generator/pkg/api"
+	"github.com/GoogleCloudPlatform/gke-terraform-generator/pkg/backend"
+	"github.com/GoogleCloudPlatform/gke-terraform-generator/pkg/params"
+	"github.com/GoogleCloudPlatform/gke-terraform-generator/pkg/templates"
+)
+
+func generate(t *testing.T, configFile string, tfType templates.TFType) map[string][]byte {
+	gkeTF, err := api.UnmarshalGkeTF(configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gkeTF.Spec.ProjectId = "my-project"
+	if err := Prepare(gkeTF); err != nil {
+		t.Fatal(err)
+	}
+	files, err := Generate(context.Background(), gkeTF, Options{TFType: tfType})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestGenerate(t *testing.T) {
+	for _, tfType := range []templates.TFType{templates.CFT, templates.VANILLA, templates.BUILDER} {
+		files := generate(t, "../../examples/example.yaml", tfType)
+		for _, name := range []string{"main.tf", "network.tf", "outputs.tf", "variables.tf"} {
+			if len(files[name]) == 0 {
+				t.Errorf("%s: %s is empty", tfType, name)
+			}
+		}
+		if !strings.Contains(string(files["variables.tf"]), "my-project") {
+			t.Errorf("%s: variables.tf does not contain the project", tfType)
+		}
+	}
+}
+
+func TestGenerateJSON(t *testing.T) {
+	gkeTF, err := api.UnmarshalGkeTF("../../examples/example.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gkeTF.Spec.ProjectId = "my-project"
+	if err := Prepare(gkeTF); err != nil {
+		t.Fatal(err)
+	}
+	for _, tfType := range []templates.TFType{templates.CFT, templates.VANILLA, templates.BUILDER} {
+		files, err := Generate(context.Background(), gkeTF, Options{TFType: tfType, JSON: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range []string{"main.tf.json", "network.tf.json", "outputs.tf.json", "variables.tf.json", "versions.tf.json"} {
+			var content map[string]interface{}
+			if err := json.Unmarshal(files[name], &content); err != nil {
+				t.Errorf("%s: %s is not valid JSON: %v", tfType, name, err)
+			}
+		}
+		if len(files) != 5 {
+			t.Errorf("%s: expected 5 files, got %d", tfType, len(files))
+		}
+		if !strings.Contains(string(files["variables.tf.json"]), "my-project") {
+			t.Errorf("%s: variables.tf.json does not contain the project", tfType)
+		}
+	}
+}
+
+func TestGenerateAsModule(t *testing.T) {
+	gkeTF, err := api.UnmarshalGkeTF("../../examples/example.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gkeTF.Spec.ProjectId = "my-project"
+	if err := Prepare(gkeTF); err != nil {
+		t.Fatal(err)
+	}
+	example := path.Join(ExampleDir, "main.tf")
+	for _, tfType := range []templates.TFType{templates.CFT, templates.VANILLA, templates.BUILDER} {
+		for _, parameterize := range []bool{false, true} {
+			files, err := Generate(context.Background(), gkeTF, Options{TFType: tfType, AsModule: true, Parameterize: parameterize})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for name, b := range files {
+				f, diags := hclsyntax.ParseConfig(b, name, hcl.Pos{Line: 1, Column: 1})
+				if diags.HasErrors() {
+					t.Fatalf("%s: %s is not valid HCL: %v", tfType, name, diags)
+				}
+				for _, block := range f.Body.(*hclsyntax.Body).Blocks {
+					if block.Type == "provider" && name != example {
+						t.Errorf("%s: %s has a provider block", tfType, name)
+					}
+				}
+			}
+			if _, ok := files[params.TFVarsFileName]; ok {
+				t.Errorf("%s: expected the tfvars to be moved to the example", tfType)
+			}
+
+			// the example is compared without its alignment
+			b := strings.Join(strings.Fields(string(files[example])), " ")
+			for _, s := range []string{`provider "google-beta"`, `source = "../.."`, "project_id = var.project_id", `default = "my-project"`, "module.test-cluster.cluster_name"} {
+				if !strings.Contains(b, s) {
+					t.Errorf("%s: expected %s in the example:\n%s", tfType, s, b)
+				}
+			}
+			if parameterize && !strings.Contains(b, `cluster_name = "test-cluster"`) {
+				t.Errorf("%s: expected the values of the tfvars in the example:\n%s", tfType, b)
+			}
+		}
+	}
+}
+
+// TestGenerateAsModuleLegacy checks that the example of a module for terraform 0.11 references
+// the variables and the module in the syntax of 0.11.
+func TestGenerateAsModuleLegacy(t *testing.T) {
+	gkeTF, err := api.UnmarshalGkeTF("../../examples/example.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gkeTF.Spec.ProjectId = "my-project"
+	gkeTF.Spec.Terraform = &api.TerraformSpec{RequiredVersion: "~> 0.11.14"}
+	if err := Prepare(gkeTF); err != nil {
+		t.Fatal(err)
+	}
+	files, err := Generate(context.Background(), gkeTF, Options{TFType: templates.CFT, AsModule: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := strings.Join(strings.Fields(string(files[path.Join(ExampleDir, "main.tf")])), " ")
+	for _, s := range []string{`project_id = "${var.project_id}"`, `value = "${module.test-cluster.cluster_name}"`} {
+		if !strings.Contains(b, s) {
+			t.Errorf("expected %s in the example:\n%s", s, b)
+		}
+	}
+	for _, s := range []string{"= var.", "= module."} {
+		if strings.Contains(b, s) {
+			t.Errorf("expected no %s in the example:\n%s", s, b)
+		}
+	}
+}
+
+func TestGenerateBackend(t *testing.T) {
+	gkeTF, err := api.UnmarshalGkeTF("../../examples/example.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gkeTF.Spec.ProjectId = "my-project"
+	key := "MTIzNDU2Nzg5MDEyMzQ1Njc4OTAxMjM0NTY3ODkwMTI="
+	gkeTF.Spec.Backend = &api.BackendSpec{GCS: &api.GCSBackendSpec{Bucket: "my-state", EncryptionKey: key, Bootstrap: api.NewBool(true)}}
+	if err := Prepare(gkeTF); err != nil {
+		t.Fatal(err)
+	}
+	bootstrap := path.Join(backend.BootstrapDir, "main.tf")
+	for _, tfType := range []templates.TFType{templates.CFT, templates.VANILLA, templates.BUILDER} {
+		for _, opts := range []Options{{}, {JSON: true}, {AsModule: true}} {
+			opts.TFType = tfType
+			files, err := Generate(context.Background(), gkeTF, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			backendFile, configFile, bootstrapFile := backend.FileName, backend.ConfigFileName, bootstrap
+			switch {
+			case opts.JSON:
+				backendFile, configFile, bootstrapFile = backendFile+".json", configFile+".json", bootstrapFile+".json"
+			case opts.AsModule:
+				backendFile, configFile = path.Join(ExampleDir, backendFile), path.Join(ExampleDir, configFile)
+				if _, ok := files[backend.FileName]; ok {
+					t.Errorf("%s: expected the backend to be moved to the example", tfType)
+				}
+			}
+			if !strings.Contains(string(files[backendFile]), "my-state") {
+				t.Errorf("%s %+v: expected the bucket in %s", tfType, opts, backendFile)
+			}
+			if strings.Contains(string(files[backendFile]), key) || !strings.Contains(string(files[configFile]), key) {
+				t.Errorf("%s %+v: expected the encryption key in %s only", tfType, opts, configFile)
+			}
+			if !strings.Contains(string(files[bootstrapFile]), "google_storage_bucket") {
+				t.Errorf("%s %+v: expected the bucket resource in %s", tfType, opts, bootstrapFile)
+			}
+		}
+	}
+}
+
+func TestGenerateCanceled(t *testing.T) {
+	gkeTF, err := api.UnmarshalGkeTF("../../examples/example.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := Generate(ctx, gkeTF, Options{TFType: templates.VANILLA}); err != context.Canceled {
+		t.Fatalf("expected %v, got %v", context.Canceled, err)
+	}
+}
+
+func TestPrepareInvalid(t *testing.T) {
+	gkeTF, err := api.UnmarshalGkeTF("../../examples/example.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the example has no project id
+	if _, ok := Prepare(gkeTF).(api.Diagnostics); !ok {
+		t.Fatal("expected diagnostics")
+	}
+}
+
+func TestFormat(t *testing.T) {
+	content := `
+resource "a" "b" {
+
+  name = "b"
+  machine_type = "c"
+
+
+  description = <<-EOF
+  first
+
+
+  second
+  EOF
+
+}
+
+
+`
+	expected := `resource "a" "b" {
+  name         = "b"
+  machine_type = "c"
+
+  description = <<-EOF
+  first
+
+
+  second
+  EOF
+}
+`
+	formatted := format([]byte(content))
+	if string(formatted) != expected {
+		t.Fatalf("expected %q, got %q", expected, formatted)
+	}
+	if again := format(formatted); string(again) != expected {
+		t.Fatalf("formatting is not stable, got %q", again)
+	}
+}
+
+func TestDirWriter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gke-tf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := InDirectory("dev", map[string][]byte{"main.tf": []byte("a"), "outputs.tf": []byte("b")})
+	if err := NewDirWriter(dir, DirOptions{}).WriteFiles(files); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, "dev", "outputs.tf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "b" {
+		t.Fatalf("unexpected content %q", b)
+	}
+
+	if err := NewDirWriter(dir, DirOptions{}).WriteFiles(files); err == nil {
+		t.Fatal("this should have failed, the files exist and overwrites are not allowed")
+	}
+	files["dev/main.tf"] = []byte("c")
+	if err := NewDirWriter(dir, DirOptions{AllowOverwrite: true, Force: true}).WriteFiles(files); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDirWriterBackup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gke-tf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	now = func() time.Time { return time.Date(2019, 1, 2, 15, 4, 5, 0, time.UTC) }
+	defer func() { now = time.Now }()
+
+	w := NewDirWriter(dir, DirOptions{AllowOverwrite: true, Force: true, Backup: true})
+	if err := w.WriteFiles(map[string][]byte{"main.tf": []byte("old")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteFiles(map[string][]byte{"main.tf": []byte("new")}); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, expected := range map[string]string{"main.tf": "new", "main.tf.20190102-150405.bak": "old"} {
+		b, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != expected {
+			t.Fatalf("%s: expected %q, got %q", name, expected, b)
+		}
+	}
+
+	// only the files and the backup are left
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 2 {
+		t.Fatalf("expected 2 files, got %d", len(infos))
+	}
+}
+
+func TestDirWriterRollback(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gke-tf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "main.tf"), []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// outputs.tf can not be replaced, after main.tf has been
+	if err := os.Mkdir(filepath.Join(dir, "outputs.tf"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string][]byte{"main.tf": []byte("new"), "network.tf": []byte("new"), "outputs.tf": []byte("new")}
+	if err := NewDirWriter(dir, DirOptions{AllowOverwrite: true, Force: true}).WriteFiles(files); err == nil {
+		t.Fatal("this should have failed, outputs.tf is a directory")
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, "main.tf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "old" {
+		t.Fatalf("main.tf was not restored, got %q", b)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "network.tf")); !os.IsNotExist(err) {
+		t.Fatalf("network.tf was not removed: %v", err)
+	}
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 2 {
+		t.Fatalf("expected main.tf and outputs.tf, got %d files", len(infos))
+	}
+}
+
+func TestDirWriterRollbackFailure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gke-tf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "main.tf"), []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// outputs.tf can not be moved into place, and then main.tf can not be moved back
+	sep := string(filepath.Separator)
+	rename = func(from, to string) error {
+		if strings.Contains(from, sep+"old"+sep) || filepath.Base(to) == "outputs.tf" {
+			return errors.New("rename failed")
+		}
+		return os.Rename(from, to)
+	}
+	defer func() { rename = os.Rename }()
+
+	files := map[string][]byte{"main.tf": []byte("new"), "outputs.tf": []byte("new")}
+	writeErr := NewDirWriter(dir, DirOptions{AllowOverwrite: true, Force: true}).WriteFiles(files)
+	if writeErr == nil {
+		t.Fatal("this should have failed, outputs.tf can not be renamed")
+	}
+
+	// the previous main.tf is kept in the temporary directory that the error names
+	kept, err := filepath.Glob(filepath.Join(dir, ".gke-tf-*", "old", "main.tf"))
+	if err != nil || len(kept) != 1 {
+		t.Fatalf("expected the previous main.tf to be kept, got %v: %v", kept, err)
+	}
+	if !strings.Contains(writeErr.Error(), filepath.Dir(filepath.Dir(kept[0]))) {
+		t.Errorf("expected the error to name the temporary directory: %v", writeErr)
+	}
+	b, err := ioutil.ReadFile(kept[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "old" {
+		t.Fatalf("expected the previous main.tf, got %q", b)
+	}
+}
+
+func TestDirWriterOtherSyntax(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gke-tf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	hclFiles, err := stampFiles(map[string][]byte{"main.tf": []byte("locals {}\n")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	jsonFiles := map[string][]byte{"main.tf.json": []byte("{}\n")}
+	w := NewDirWriter(dir, DirOptions{AllowOverwrite: true})
+	exists := func(name string) bool {
+		_, err := os.Stat(filepath.Join(dir, name))
+		return err == nil
+	}
+
+	// the generated main.tf is replaced by main.tf.json, since terraform would load both
+	if err := w.WriteFiles(hclFiles); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteFiles(jsonFiles); err != nil {
+		t.Fatal(err)
+	}
+	if exists("main.tf") || !exists("main.tf.json") {
+		t.Fatal("expected main.tf to be replaced by main.tf.json")
+	}
+
+	// main.tf.json may not have been generated, so it is only removed when forced
+	if err := w.WriteFiles(hclFiles); err == nil {
+		t.Fatal("this should have failed, main.tf.json exists")
+	}
+	if err := NewDirWriter(dir, DirOptions{AllowOverwrite: true, Force: true}).WriteFiles(hclFiles); err != nil {
+		t.Fatal(err)
+	}
+	if !exists("main.tf") || exists("main.tf.json") {
+		t.Fatal("expected main.tf.json to be replaced by main.tf")
+	}
+
+	// nor is a main.tf with terraform in its user section
+	b, err := ioutil.ReadFile(filepath.Join(dir, "main.tf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	end := endSection + DefaultSection
+	edited := strings.Replace(string(b), end, "resource \"null_resource\" \"custom\" {}\n"+end, 1)
+	if err := ioutil.WriteFile(filepath.Join(dir, "main.tf"), []byte(edited), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteFiles(jsonFiles); err == nil || !strings.Contains(err.Error(), "user section") {
+		t.Fatalf("expected an error about the user section, got %v", err)
+	}
+	if !exists("main.tf") || exists("main.tf.json") {
+		t.Fatal("expected nothing to be written")
+	}
+}
+
+func TestRootModuleJSON(t *testing.T) {
+	files, err := RootModule([]string{"dev-cluster"}, Options{JSON: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var content map[string]interface{}
+	if err := json.Unmarshal(files["main.tf.json"], &content); err != nil || len(files) != 1 {
+		t.Fatalf("expected only main.tf.json, got %v: %v", files, err)
+	}
+	if _, ok := content["module"]; !ok {
+		t.Errorf("expected the modules in main.tf.json, got %v", content)
+	}
+}
+
+func TestUserSections(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gke-tf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := generate(t, "../../examples/min-example.yaml", templates.VANILLA)
+	w := NewDirWriter(dir, DirOptions{AllowOverwrite: true})
+	if err := w.WriteFiles(files); err != nil {
+		t.Fatal(err)
+	}
+	for name, b := range files {
+		if err := verify(b); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+	}
+
+	// terraform in a user section and in other files is kept
+	custom := []byte("resource \"null_resource\" \"custom\" {}\n")
+	if err := ioutil.WriteFile(filepath.Join(dir, "custom.tf"), custom, 0644); err != nil {
+		t.Fatal(err)
+	}
+	mainTF := filepath.Join(dir, "main.tf")
+	b, err := ioutil.ReadFile(mainTF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	end := endSection + DefaultSection
+	edited := strings.Replace(string(b), end, string(custom)+end, 1)
+	if err := ioutil.WriteFile(mainTF, []byte(edited), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteFiles(files); err != nil {
+		t.Fatal(err)
+	}
+	b, err = ioutil.ReadFile(mainTF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != edited {
+		t.Fatal("the user section of main.tf was not kept")
+	}
+	if b, err := ioutil.ReadFile(filepath.Join(dir, "custom.tf")); err != nil || string(b) != string(custom) {
+		t.Fatalf("custom.tf was changed: %v", err)
+	}
+
+	// an edit outside of the user sections is only overwritten when forced
+	if err := ioutil.WriteFile(mainTF, []byte(strings.Replace(edited, "resource", "data", 1)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteFiles(files); err == nil || !strings.Contains(err.Error(), "edited") {
+		t.Fatalf("expected an error about the edit, got %v", err)
+	}
+	if err := NewDirWriter(dir, DirOptions{AllowOverwrite: true, Force: true}).WriteFiles(files); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := ioutil.ReadFile(mainTF); err != nil || string(b) != edited {
+		t.Fatalf("main.tf was not replaced, with its user section kept: %v", err)
+	}
+}
+
+func TestUserSectionsTFVars(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gke-tf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	gkeTF, err := api.UnmarshalGkeTF("../../examples/min-example.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gkeTF.Spec.ProjectId = "my-project"
+	if err := Prepare(gkeTF); err != nil {
+		t.Fatal(err)
+	}
+	files, err := Generate(context.Background(), gkeTF, Options{TFType: templates.VANILLA, Parameterize: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := verify(files[params.TFVarsFileName]); err != nil {
+		t.Fatalf("%s: %v", params.TFVarsFileName, err)
+	}
+
+	w := NewDirWriter(dir, DirOptions{AllowOverwrite: true})
+	if err := w.WriteFiles(files); err != nil {
+		t.Fatal(err)
+	}
+
+	// the values that are edited for an environment are only overwritten when forced
+	tfvars := filepath.Join(dir, params.TFVarsFileName)
+	b, err := ioutil.ReadFile(tfvars)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edited := strings.Replace(string(b), `"my-project"`, `"prod-project"`, 1)
+	if err := ioutil.WriteFile(tfvars, []byte(edited), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteFiles(files); err == nil || !strings.Contains(err.Error(), "edited") {
+		t.Fatalf("expected an error about the edit, got %v", err)
+	}
+	if b, err := ioutil.ReadFile(tfvars); err != nil || string(b) != edited {
+		t.Fatalf("%s was overwritten: %v", params.TFVarsFileName, err)
+	}
+}
+
+func TestMergeSections(t *testing.T) {
+	content := "a\n// gke-tf:begin-user-section one\ndefault\n// gke-tf:end-user-section one\nb\n"
+	existing := "x\n  // gke-tf:begin-user-section one\nmine\n  // gke-tf:end-user-section one\n"
+	merged, err := mergeSections([]byte(content), []byte(existing), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "a\n// gke-tf:begin-user-section one\nmine\n// gke-tf:end-user-section one\nb\n"
+	if string(merged) != expected {
+		t.Fatalf("expected %q, got %q", expected, merged)
+	}
+
+	gone := "// gke-tf:begin-user-section two\nmine\n// gke-tf:end-user-section two\n"
+	if _, err := mergeSections([]byte(content), []byte(gone), false); err == nil {
+		t.Fatal("this should have failed, section two is no longer generated")
+	}
+	unterminated := "// gke-tf:begin-user-section one\nmine\n"
+	if _, err := mergeSections([]byte(content), []byte(unterminated), false); err == nil {
+		t.Fatal("this should have failed, section one does not end")
+	}
+}
+
+func TestDiff(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gke-tf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string][]byte{"main.tf": []byte("a\n// gke-tf:begin-user-section one\n// gke-tf:end-user-section one\nb\n")}
+	diff, err := Diff(dir, files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(diff, "--- /dev/null\n+++ b/main.tf\n@@ -0,0 +1,4 @@\n+a\n") {
+		t.Fatalf("expected main.tf to be added, got %q", diff)
+	}
+
+	// the contents of a user section are not a change
+	existing := "a\n// gke-tf:begin-user-section one\nmine\n// gke-tf:end-user-section one\nb\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "main.tf"), []byte(existing), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if diff, err := Diff(dir, files); err != nil || diff != "" {
+		t.Fatalf("expected no diff, got %q, %v", diff, err)
+	}
+
+	files["main.tf"] = []byte("a\n// gke-tf:begin-user-section one\n// gke-tf:end-user-section one\nc\n")
+	diff, err = Diff(dir, files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "--- a/main.tf\n+++ b/main.tf\n@@ -2,4 +2,4 @@\n // gke-tf:begin-user-section one\n mine\n // gke-tf:end-user-section one\n-b\n+c\n"
+	if diff != expected {
+		t.Fatalf("expected %q, got %q", expected, diff)
+	}
+
+	// a generated file that would no longer be written is removed, but other files are not
+	stale, err := stamp([]byte("a\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "backend.tf"), stale, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "custom.tf"), []byte("a\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	diff, err = Diff(dir, files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(diff, "--- a/backend.tf\n+++ /dev/null\n") || strings.Contains(diff, "custom.tf") {
+		t.Fatalf("expected backend.tf to be removed, got %q", diff)
+	}
+}
+
+// TestDiffJSON checks that the generated files in the JSON syntax are compared, and that only the
+// directories of the cluster are read.
+func TestDiffJSON(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gke-tf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	gkeTF, err := api.UnmarshalGkeTF("../../examples/example.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gkeTF.Spec.ProjectId = "my-project"
+	gkeTF.Spec.Backend = &api.BackendSpec{GCS: &api.GCSBackendSpec{Bucket: "my-state"}}
+	if err := Prepare(gkeTF); err != nil {
+		t.Fatal(err)
+	}
+	for _, tfType := range []templates.TFType{templates.VANILLA, templates.BUILDER} {
+		opts := Options{TFType: tfType, JSON: true}
+		gkeTF.Spec.Backend = &api.BackendSpec{GCS: &api.GCSBackendSpec{Bucket: "my-state"}}
+		files, err := Generate(context.Background(), gkeTF, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = InDirectory("dev", files)
+		if err := NewDirWriter(dir, DirOptions{AllowOverwrite: true, Force: true}).WriteFiles(files); err != nil {
+			t.Fatal(err)
+		}
+		// the generated file of another cluster, and a file of the user
+		other, err := stamp([]byte("a\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.MkdirAll(filepath.Join(dir, "prod"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, "prod", "main.tf"), other, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, "dev", "custom.tf.json"), []byte("{}\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if diff, err := Diff(dir, files); err != nil || diff != "" {
+			t.Fatalf("%s: expected no diff, got %q, %v", tfType, diff, err)
+		}
+
+		gkeTF.Spec.Backend = nil
+		files, err = Generate(context.Background(), gkeTF, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		diff, err := Diff(dir, InDirectory("dev", files))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(diff, "--- a/dev/backend.tf.json\n+++ /dev/null\n") {
+			t.Errorf("%s: expected backend.tf.json to be removed, got %q", tfType, diff)
+		}
+		for _, name := range []string{"custom.tf.json", "prod/main.tf", "main.tf.json"} {
+			if strings.Contains(diff, name) {
+				t.Errorf("%s: expected no diff of %s, got %q", tfType, name, diff)
+			}
+		}
+		if err := os.RemoveAll(filepath.Join(dir, "dev")); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestStampJSON(t *testing.T) {
+	for _, test := range []struct {
+		content  string
+		expected string
+	}{
+		{"{\n  \"a\": 1\n}\n", "{\n  \"//\": \"Generated by gke-tf.\",\n  \"a\": 1\n}\n"},
+		{"{\n  \"//\": \"Builder <based>\",\n  \"a\": 1\n}\n", "{\n  \"//\": \"Generated by gke-tf.\\nBuilder <based>\",\n  \"a\": 1\n}\n"},
+		{"{}\n", "{\n  \"//\": \"Generated by gke-tf.\"\n}\n"},
+	} {
+		actual, err := stampJSON([]byte(test.content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(actual) != test.expected {
+			t.Errorf("expected %q, got %q", test.expected, actual)
+		}
+		if !generatedJSON(actual) || generatedJSON([]byte(test.content)) {
+			t.Errorf("%q: expected only the stamped file to be generated", test.content)
+		}
+	}
+}
+
+func TestTarWriter(t *testing.T) {
+	var b bytes.Buffer
+	w := NewTarWriter(&b)
+	if err := w.WriteFiles(map[string][]byte{"dev/main.tf": []byte("a")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteFiles(map[string][]byte{"main.tf": []byte("b")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	r := tar.NewReader(&b)
+	for {
+		header, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, header.Name)
+	}
+	if strings.Join(names, ",") != "dev/main.tf,main.tf" {
+		t.Fatalf("unexpected files %v", names)
+	}
+}
+
+func TestStreamWriter(t *testing.T) {
+	var b bytes.Buffer
+	if err := NewStreamWriter(&b).WriteFiles(map[string][]byte{"outputs.tf": []byte("b\n"), "main.tf": []byte("a\n")}); err != nil {
+		t.Fatal(err)
+	}
+	expected := "# File: main.tf\na\n# File: outputs.tf\nb\n"
+	if b.String() != expected {
+		t.Fatalf("expected %q, got %q", expected, b.String())
+	}
+}
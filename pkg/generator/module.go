@@ -0,0 +1,230 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"sort"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+
+	"github.com/GoogleCloudPlatform/gke-terraform-generator/pkg/backend"
+	"github.com/GoogleCloudPlatform/gke-terraform-generator/pkg/params"
+	"github.com/GoogleCloudPlatform/gke-terraform-generator/pkg/templates"
+)
+
+// ExampleDir is the directory of the example root module that AsModule adds, as the terraform
+// registry expects the examples of a module.
+const ExampleDir = "examples/basic"
+
+// exampleHeader is the comment at the start of the example root module.
+const exampleHeader = `/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Example root module that uses the module of the cluster %s.  The module has no
+// providers, so they are configured here, and it is called with the values of the cluster.
+`
+
+// AsModule turns the terraform files of a cluster, in the native syntax, into a child module
+// that can be published to a registry and called by other terraform.  The provider blocks are
+// moved out of the module, since a child module inherits the providers of its caller, and so
+// are the values of the terraform.tfvars, which terraform ignores in a child module.  They are
+// written to the main.tf of an example root module in ExampleDir instead, which calls the
+// module with the values of the cluster and has the outputs of the module.  The backend.tf and
+// backend.hcl of spec.backend are moved to the example too, since terraform only reads the
+// backend of the root module, and the files in subdirectories, as the backend.BootstrapDir, are
+// kept as they are.
+// The files that are changed are formatted.  The example references the variables and the
+// module in the syntax of target, which is the native syntax of terraform 0.12 if it is nil.
+func AsModule(files map[string][]byte, clusterName string, target *templates.Target) (map[string][]byte, error) {
+	module := map[string][]byte{}
+	var fileNames []string
+	for name, b := range files {
+		switch {
+		case path.Dir(name) != ".":
+			module[name] = b
+		case name == backend.FileName || name == backend.ConfigFileName:
+			module[path.Join(ExampleDir, name)] = b
+		case path.Ext(name) == ".tf":
+			fileNames = append(fileNames, name)
+		case name != params.TFVarsFileName:
+			module[name] = b
+		}
+	}
+	sort.Strings(fileNames)
+
+	var providers [][]byte
+	variables := map[string][]byte{}
+	var outputs []*hclsyntax.Block
+	var outputSources [][]byte
+	for _, name := range fileNames {
+		f, diags := hclwrite.ParseConfig(files[name], name, hcl.Pos{Line: 1, Column: 1})
+		if diags.HasErrors() {
+			return nil, diags
+		}
+		removed := false
+		for _, block := range f.Body().Blocks() {
+			switch block.Type() {
+			case "provider":
+				providers = append(providers, block.BuildTokens(nil).Bytes())
+				f.Body().RemoveBlock(block)
+				removed = true
+			case "variable":
+				variables[block.Labels()[0]] = block.BuildTokens(nil).Bytes()
+			}
+		}
+		if removed {
+			module[name] = format(f.Bytes())
+		} else {
+			module[name] = files[name]
+		}
+
+		syntax, diags := hclsyntax.ParseConfig(files[name], name, hcl.Pos{Line: 1, Column: 1})
+		if diags.HasErrors() {
+			return nil, diags
+		}
+		for _, block := range syntax.Body.(*hclsyntax.Body).Blocks {
+			if block.Type == "output" {
+				outputs = append(outputs, block)
+				outputSources = append(outputSources, files[name])
+			}
+		}
+	}
+
+	// the variables that the providers reference are declared by the example too, and passed
+	// to the module
+	var inputs []string
+	arguments := map[string]string{}
+	var declarations [][]byte
+	for _, provider := range providers {
+		for _, name := range providerVariables(provider) {
+			if _, ok := arguments[name]; ok {
+				continue
+			}
+			declaration, ok := variables[name]
+			if !ok {
+				return nil, fmt.Errorf("the providers reference var.%s, which is not declared", name)
+			}
+			declarations = append(declarations, declaration)
+			inputs = append(inputs, name)
+			arguments[name] = target.Expr("var." + name)
+		}
+	}
+	if tfvars, ok := files[params.TFVarsFileName]; ok {
+		f, diags := hclsyntax.ParseConfig(tfvars, params.TFVarsFileName, hcl.Pos{Line: 1, Column: 1})
+		if diags.HasErrors() {
+			return nil, diags
+		}
+		var attrs []*hclsyntax.Attribute
+		for _, attr := range f.Body.(*hclsyntax.Body).Attributes {
+			attrs = append(attrs, attr)
+		}
+		sort.Slice(attrs, func(i, j int) bool {
+			return attrs[i].SrcRange.Start.Byte < attrs[j].SrcRange.Start.Byte
+		})
+		for _, attr := range attrs {
+			if _, ok := arguments[attr.Name]; ok {
+				continue
+			}
+			inputs = append(inputs, attr.Name)
+			arguments[attr.Name] = string(attr.Expr.Range().SliceBytes(tfvars))
+		}
+	}
+
+	moduleName := templates.ResourceName(clusterName)
+	var b bytes.Buffer
+	fmt.Fprintf(&b, exampleHeader, clusterName)
+	for _, declaration := range declarations {
+		b.WriteString("\n")
+		b.Write(declaration)
+	}
+	for _, provider := range providers {
+		b.WriteString("\n")
+		b.Write(provider)
+	}
+	fmt.Fprintf(&b, "\nmodule %q {\n  source = \"../..\"\n", moduleName)
+	if len(inputs) > 0 {
+		b.WriteString("\n")
+	}
+	for _, name := range inputs {
+		fmt.Fprintf(&b, "  %s = %s\n", name, arguments[name])
+	}
+	b.WriteString("}\n")
+	for i, output := range outputs {
+		name := output.Labels[0]
+		fmt.Fprintf(&b, "\noutput %q {\n", name)
+		for _, attrName := range []string{"description", "sensitive"} {
+			if attr, ok := output.Body.Attributes[attrName]; ok {
+				fmt.Fprintf(&b, "  %s = %s\n", attrName, attr.Expr.Range().SliceBytes(outputSources[i]))
+			}
+		}
+		fmt.Fprintf(&b, "  value = %s\n}\n", target.Expr("module."+moduleName+"."+name))
+	}
+	module[path.Join(ExampleDir, templates.RootModuleFileName)] = format(b.Bytes())
+	return module, nil
+}
+
+// providerVariables returns the names of the variables that a provider block references, in
+// order.
+func providerVariables(provider []byte) []string {
+	f, diags := hclsyntax.ParseConfig(provider, "provider", hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		return nil
+	}
+	var names []string
+	seen := map[string]bool{}
+	for _, block := range f.Body.(*hclsyntax.Body).Blocks {
+		var attrs []*hclsyntax.Attribute
+		for _, attr := range block.Body.Attributes {
+			attrs = append(attrs, attr)
+		}
+		sort.Slice(attrs, func(i, j int) bool {
+			return attrs[i].SrcRange.Start.Byte < attrs[j].SrcRange.Start.Byte
+		})
+		for _, attr := range attrs {
+			for _, traversal := range attr.Expr.Variables() {
+				if traversal.RootName() != "var" || len(traversal) < 2 {
+					continue
+				}
+				attrStep, ok := traversal[1].(hcl.TraverseAttr)
+				if !ok || seen[attrStep.Name] {
+					continue
+				}
+				seen[attrStep.Name] = true
+				names = append(names, attrStep.Name)
+			}
+		}
+	}
+	return names
+}
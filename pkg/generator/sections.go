@@ -0,0 +1,259 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package generator
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+const (
+	// headerPrefix starts the first line of every generated file.
+	headerPrefix = "// Generated by gke-tf, only edit the user sections."
+	// beginSection and endSection, followed by the name of the section, delimit a user section.
+	beginSection = "// gke-tf:begin-user-section "
+	endSection   = "// gke-tf:end-user-section "
+	// DefaultSection is the user section that ends every generated file.
+	DefaultSection = "custom"
+	// jsonHeader starts the // property of every generated file in the JSON syntax.
+	jsonHeader = "Generated by gke-tf."
+)
+
+// headerPattern matches the header of a generated file and captures its checksum.
+var headerPattern = regexp.MustCompile(`^` + regexp.QuoteMeta(headerPrefix) + ` sha256:([0-9a-f]{64})\n`)
+
+var (
+	// errNoHeader is returned for a file that has no gke-tf header, so it was not generated or
+	// its header was removed.
+	errNoHeader = errors.New("it was not generated by gke-tf")
+	// errEdited is returned for a generated file that was edited outside of its user sections.
+	errEdited = errors.New("it was edited outside of its user sections")
+)
+
+// hasSections returns true if the file name is in the native syntax of terraform, such as main.tf
+// or terraform.tfvars, so that it has a header and user sections.  The values of a tfvars file
+// are edited for each environment, so it is not overwritten once edited either, unless forced.
+// The header and sections are comments, which the JSON syntax does not have, so a main.tf.json
+// is replaced as a whole.
+func hasSections(name string) bool {
+	return path.Ext(name) == ".tf" || path.Ext(name) == ".tfvars"
+}
+
+// stamp adds the default user section to the end of a rendered file, and a header with the
+// checksum of the file to its start.  Templates may define other user sections, such as one
+// inside a resource.
+func stamp(content []byte) ([]byte, error) {
+	var b bytes.Buffer
+	b.Write(content)
+	if len(content) > 0 && content[len(content)-1] != '\n' {
+		b.WriteByte('\n')
+	}
+	fmt.Fprintf(&b, "\n// Terraform between these markers is kept when gke-tf generates this file again.\n")
+	fmt.Fprintf(&b, "%s%s\n%s%s\n", beginSection, DefaultSection, endSection, DefaultSection)
+
+	body := b.Bytes()
+	sum, err := checksum(body)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(fmt.Sprintf("%s sha256:%s\n", headerPrefix, sum)), body...), nil
+}
+
+// stampJSON adds jsonHeader to the start of the // property of the root object of a file in the
+// JSON syntax, which terraform ignores, so that a generated file can be told apart.  The file is
+// indented, as the builder writes it, with a // property first if it has one.
+func stampJSON(content []byte) ([]byte, error) {
+	comment := jsonHeader
+	rest := bytes.TrimPrefix(content, []byte("{"))
+	if len(rest) == len(content) {
+		return nil, errors.New("the file is not a JSON object")
+	}
+	if existing := []byte("{\n  \"//\": "); bytes.HasPrefix(content, existing) {
+		decoder := json.NewDecoder(bytes.NewReader(content[len(existing):]))
+		var s string
+		if err := decoder.Decode(&s); err != nil {
+			return nil, err
+		}
+		comment += "\n" + s
+		rest = content[len(existing)+int(decoder.InputOffset()):]
+	} else if bytes.HasPrefix(bytes.TrimSpace(rest), []byte("}")) {
+		rest = []byte("\n}\n")
+	} else {
+		rest = append([]byte(","), rest...)
+	}
+
+	var b bytes.Buffer
+	encoder := json.NewEncoder(&b)
+	encoder.SetEscapeHTML(false)
+	b.WriteString("{\n  \"//\": ")
+	if err := encoder.Encode(comment); err != nil {
+		return nil, err
+	}
+	b.Truncate(b.Len() - 1)
+	b.Write(rest)
+	return b.Bytes(), nil
+}
+
+// generatedJSON returns true if a file in the JSON syntax was stamped by stampJSON.
+func generatedJSON(content []byte) bool {
+	var object struct {
+		Comment string `json:"//"`
+	}
+	return json.Unmarshal(content, &object) == nil && strings.HasPrefix(object.Comment, jsonHeader)
+}
+
+// verify returns an error if a file has no header or was edited outside of its user sections.
+func verify(content []byte) error {
+	match := headerPattern.FindSubmatch(content)
+	if match == nil {
+		return errNoHeader
+	}
+	sum, err := checksum(content[len(match[0]):])
+	if err != nil {
+		return err
+	}
+	if sum != string(match[1]) {
+		return errEdited
+	}
+	return nil
+}
+
+// checksum returns the sha256 of the body of a file, without the contents of its user sections.
+func checksum(body []byte) (string, error) {
+	var generated bytes.Buffer
+	err := scanSections(body, func(line []byte, section string) {
+		if section == "" {
+			generated.Write(line)
+		}
+	})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(generated.Bytes())
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// userSections returns the contents of the user sections of a file, by name.
+func userSections(content []byte) (map[string][]byte, error) {
+	sections := map[string][]byte{}
+	err := scanSections(content, func(line []byte, section string) {
+		if section != "" {
+			sections[section] = append(sections[section], line...)
+		} else if name, ok := marker(line, beginSection); ok {
+			// keep the sections that are empty
+			sections[name] = []byte{}
+		}
+	})
+	return sections, err
+}
+
+// mergeSections copies the contents of the user sections of an existing file into the same
+// sections of a new file.  A section of the existing file that the new file does not have is an
+// error, since its contents would be lost, unless force is true.
+func mergeSections(content, existing []byte, force bool) ([]byte, error) {
+	sections, err := userSections(existing)
+	if err != nil {
+		if force {
+			return content, nil
+		}
+		return nil, err
+	}
+
+	var merged bytes.Buffer
+	used := map[string]bool{}
+	err = scanSections(content, func(line []byte, section string) {
+		if section != "" {
+			// the contents of the new section are replaced by the existing ones
+			if _, ok := sections[section]; ok {
+				return
+			}
+			merged.Write(line)
+			return
+		}
+		merged.Write(line)
+		if name, ok := marker(line, beginSection); ok {
+			if existingLines, ok := sections[name]; ok {
+				merged.Write(existingLines)
+				used[name] = true
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for name, lines := range sections {
+		if !used[name] && len(bytes.TrimSpace(lines)) > 0 && !force {
+			return nil, fmt.Errorf("user section %s is no longer generated, move its terraform to another section", name)
+		}
+	}
+	return merged.Bytes(), nil
+}
+
+// scanSections calls fn with every line of content, including its newline, and the name of the
+// user section that the line is in.  The markers of a section are not in it.
+func scanSections(content []byte, fn func(line []byte, section string)) error {
+	var section string
+	lineNumber := 0
+	for len(content) > 0 {
+		lineNumber++
+		end := bytes.IndexByte(content, '\n') + 1
+		if end == 0 {
+			end = len(content)
+		}
+		line := content[:end]
+		content = content[end:]
+
+		if name, ok := marker(line, beginSection); ok {
+			if section != "" {
+				return fmt.Errorf("line %d: user section %s begins inside user section %s", lineNumber, name, section)
+			}
+			fn(line, "")
+			section = name
+			continue
+		}
+		if name, ok := marker(line, endSection); ok {
+			if name != section {
+				return fmt.Errorf("line %d: user section %s ends, but it did not begin", lineNumber, name)
+			}
+			section = ""
+			fn(line, "")
+			continue
+		}
+		fn(line, section)
+	}
+	if section != "" {
+		return fmt.Errorf("user section %s does not end", section)
+	}
+	return nil
+}
+
+// marker returns the name of the section if line is a marker that starts with prefix.
+func marker(line []byte, prefix string) (string, bool) {
+	trimmed := strings.TrimSpace(string(line))
+	if !strings.HasPrefix(trimmed, prefix) {
+		return "", false
+	}
+	return strings.TrimSpace(strings.TrimPrefix(trimmed, prefix)), true
+}
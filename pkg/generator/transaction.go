@@ -0,0 +1,214 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package generator
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"k8s.io/klog"
+)
+
+// backupTimeFormat is the format of the timestamp suffix of a backup, such as
+// main.tf.20190102-150405.bak.
+const backupTimeFormat = "20060102-150405"
+
+// now returns the time of a backup, and is replaced in tests.
+var now = time.Now
+
+// rename moves a file, and is replaced in tests.
+var rename = os.Rename
+
+// replacement is a file that a transaction moved into place.
+type replacement struct {
+	fileName string
+	// previous is where the file that was replaced was moved to, or an empty string if the file
+	// did not exist.
+	previous string
+}
+
+// transaction writes several files so that either all of them or none of them are replaced.
+// The files are first written to a temporary directory next to their destination, and then
+// renamed into place.  Renames do not copy, so a file is either the old one or the new one.  If
+// a rename fails, the files that were already replaced are restored.
+type transaction struct {
+	dir    string
+	tmpDir string
+	backup bool
+	stamp  string
+	done   []replacement
+	// unrestored is true if a file that was replaced could not be restored, so the temporary
+	// directory, which may hold its only copy, must be kept.
+	unrestored bool
+}
+
+// writeFiles writes files, keyed by slash separated paths relative to dir, and removes the files
+// of removed, in one transaction.
+// When backup is true every file that is replaced is kept next to it, with a timestamp suffix.
+// Otherwise the files are kept in the temporary directory until they are no longer needed, which
+// is left in dir, and logged, if a file could not be restored.
+func writeFiles(dir string, files map[string][]byte, removed []string, backup bool) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	tmpDir, err := ioutil.TempDir(dir, ".gke-tf-")
+	if err != nil {
+		return err
+	}
+	t := &transaction{
+		dir:    dir,
+		tmpDir: tmpDir,
+		backup: backup,
+		stamp:  now().Format(backupTimeFormat),
+	}
+	defer func() {
+		if t.unrestored {
+			klog.Errorf("The files that could not be restored are kept in %s", tmpDir)
+			return
+		}
+		os.RemoveAll(tmpDir)
+	}()
+
+	// replace nothing until every new file is on disk
+	names := sortedNames(files)
+	for _, name := range names {
+		fileName := filepath.Join(tmpDir, "new", filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(fileName), 0755); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(fileName, files[name], 0644); err != nil {
+			return err
+		}
+	}
+
+	for _, name := range removed {
+		if err := t.remove(name); err != nil {
+			if rollbackErr := t.rollback(); rollbackErr != nil {
+				return fmt.Errorf("%v, and the files that were replaced could not be restored, they are kept in %s: %v", err, tmpDir, rollbackErr)
+			}
+			return err
+		}
+	}
+	for _, name := range names {
+		if err := t.replace(name); err != nil {
+			if rollbackErr := t.rollback(); rollbackErr != nil {
+				return fmt.Errorf("%v, and the files that were replaced could not be restored, they are kept in %s: %v", err, tmpDir, rollbackErr)
+			}
+			return err
+		}
+	}
+
+	if backup {
+		for _, r := range t.done {
+			if r.previous != "" {
+				klog.Infof("Backed up %s to %s", r.fileName, r.previous)
+			}
+		}
+	}
+	return nil
+}
+
+// remove moves the file name out of the way, as replace moves the file that it replaces.
+func (t *transaction) remove(name string) error {
+	fileName := filepath.Join(t.dir, filepath.FromSlash(name))
+	r := replacement{
+		fileName: fileName,
+		previous: filepath.Join(t.tmpDir, "old", filepath.FromSlash(name)),
+	}
+	if t.backup {
+		r.previous = fmt.Sprintf("%s.%s.bak", fileName, t.stamp)
+	}
+	if err := os.MkdirAll(filepath.Dir(r.previous), 0755); err != nil {
+		return err
+	}
+	if err := rename(fileName, r.previous); err != nil {
+		return err
+	}
+	t.done = append(t.done, r)
+	return nil
+}
+
+// replace moves the new file name into place, and moves the file it replaces out of the way.
+func (t *transaction) replace(name string) error {
+	newFile := filepath.Join(t.tmpDir, "new", filepath.FromSlash(name))
+	fileName := filepath.Join(t.dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(fileName), 0755); err != nil {
+		return err
+	}
+
+	r := replacement{fileName: fileName}
+	info, err := os.Lstat(fileName)
+	switch {
+	case err == nil && info.IsDir():
+		return fmt.Errorf("unable to replace %s, it is a directory", fileName)
+	case err == nil:
+		// keep the permissions of the file that is replaced
+		if err := os.Chmod(newFile, info.Mode().Perm()); err != nil {
+			return err
+		}
+		r.previous = filepath.Join(t.tmpDir, "old", filepath.FromSlash(name))
+		if t.backup {
+			r.previous = fmt.Sprintf("%s.%s.bak", fileName, t.stamp)
+		}
+		if err := os.MkdirAll(filepath.Dir(r.previous), 0755); err != nil {
+			return err
+		}
+		if err := rename(fileName, r.previous); err != nil {
+			return err
+		}
+	case !os.IsNotExist(err):
+		return err
+	}
+
+	if err := rename(newFile, fileName); err != nil {
+		if r.previous != "" {
+			if restoreErr := rename(r.previous, fileName); restoreErr != nil {
+				t.unrestored = true
+				return fmt.Errorf("%v, and %s could not be restored from %s: %v", err, fileName, r.previous, restoreErr)
+			}
+		}
+		return err
+	}
+	t.done = append(t.done, r)
+	return nil
+}
+
+// rollback restores the files that the transaction replaced, and removes those it created.  A
+// file that can not be restored is left where it was moved to.
+func (t *transaction) rollback() error {
+	var failed error
+	for i := len(t.done) - 1; i >= 0; i-- {
+		r := t.done[i]
+		var err error
+		if r.previous == "" {
+			err = os.Remove(r.fileName)
+		} else {
+			err = rename(r.previous, r.fileName)
+			if err != nil {
+				t.unrestored = true
+			}
+		}
+		if err != nil && failed == nil {
+			failed = err
+		}
+	}
+	t.done = nil
+	return failed
+}
@@ -0,0 +1,270 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package generator
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"k8s.io/klog"
+
+	"github.com/GoogleCloudPlatform/gke-terraform-generator/pkg/builder"
+)
+
+// Writer writes rendered files.  The names of the files are slash separated paths, such as
+// main.tf or dev-cluster/main.tf.
+type Writer interface {
+	// WriteFiles writes files, which may be called several times.
+	WriteFiles(files map[string][]byte) error
+	// Close finishes the output after the last WriteFiles.
+	Close() error
+}
+
+// DirOptions configures a DirWriter.
+type DirOptions struct {
+	// AllowOverwrite replaces the files that exist.  Otherwise no file is written if one of
+	// them exists.
+	AllowOverwrite bool
+	// Force replaces the files that were edited outside of their user sections, or that were
+	// not generated by gke-tf.  Otherwise no file is written if one of them would be.
+	Force bool
+	// Backup keeps every file that is replaced next to it, with a timestamp suffix, such as
+	// main.tf.20190102-150405.bak.
+	Backup bool
+}
+
+// DirWriter writes files to a directory.  When a .tf file is replaced the terraform in its user
+// sections is kept, and the other files in the directory, such as a custom.tf, are never touched.
+// A .tf.json file has no user sections, so it is replaced as a whole.  Terraform loads both the
+// syntaxes of a file, so a main.tf that gke-tf generated is removed when a main.tf.json is
+// written, and a main.tf.json is only removed for a main.tf when forced.
+type DirWriter struct {
+	dir  string
+	opts DirOptions
+}
+
+// NewDirWriter returns a Writer that writes files to dir, creating the directories that do not
+// exist.
+func NewDirWriter(dir string, opts DirOptions) *DirWriter {
+	return &DirWriter{dir: dir, opts: opts}
+}
+
+// WriteFiles writes files to the directory.  Either every file is written, or none of them are
+// and the files that existed are left as they were.
+func (w *DirWriter) WriteFiles(files map[string][]byte) error {
+	names := sortedNames(files)
+	merged := make(map[string][]byte, len(files))
+	for _, name := range names {
+		fileName := filepath.Join(w.dir, filepath.FromSlash(name))
+		b, err := w.mergeExisting(fileName, files[name])
+		if err != nil {
+			return err
+		}
+		merged[name] = b
+	}
+
+	var removed []string
+	for _, name := range names {
+		other := otherSyntax(name)
+		if _, ok := files[other]; ok || other == "" {
+			continue
+		}
+		remove, err := w.removeOtherSyntax(name, other)
+		if err != nil {
+			return err
+		}
+		if remove {
+			removed = append(removed, other)
+		}
+	}
+
+	if err := writeFiles(w.dir, merged, removed, w.opts.Backup); err != nil {
+		return err
+	}
+	for _, name := range removed {
+		klog.Infof("Removed terraform file: %s", filepath.Join(w.dir, filepath.FromSlash(name)))
+	}
+	for _, name := range names {
+		klog.Infof("Created terraform file: %s", filepath.Join(w.dir, filepath.FromSlash(name)))
+	}
+	return nil
+}
+
+// otherSyntax returns the name of a file in the other syntax of terraform, main.tf.json for
+// main.tf and main.tf for main.tf.json, or an empty string if the file is not terraform.
+func otherSyntax(name string) string {
+	if strings.HasSuffix(name, builder.JSONSuffix) {
+		return strings.TrimSuffix(name, builder.JSONSuffix)
+	}
+	if hasSections(name) {
+		return name + builder.JSONSuffix
+	}
+	return ""
+}
+
+// removeOtherSyntax returns true if the file other, in the other syntax of the file name that is
+// written, exists and is to be removed, or an error if it may not be.  A generated .tf file whose
+// user sections are empty is removed, while a .tf file with terraform of the user, or a .tf.json
+// file, which has no checksum to tell whether it was edited, is only removed when forced.
+func (w *DirWriter) removeOtherSyntax(name, other string) (bool, error) {
+	fileName := filepath.Join(w.dir, filepath.FromSlash(other))
+	existing, err := ioutil.ReadFile(fileName)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if w.opts.Force {
+		return true, nil
+	}
+	if !w.opts.AllowOverwrite {
+		return false, fmt.Errorf("file already exists and overwrites not allowed file: %s", fileName)
+	}
+	if !hasSections(other) {
+		return false, fmt.Errorf("unable to write %s, terraform would also load %s, it is only removed when forced", name, fileName)
+	}
+	if err := verify(existing); err != nil {
+		return false, fmt.Errorf("unable to remove %s for %s, %v, it is only removed when forced", fileName, name, err)
+	}
+	sections, err := userSections(existing)
+	if err != nil {
+		return false, fmt.Errorf("unable to remove %s for %s: %v", fileName, name, err)
+	}
+	for section, content := range sections {
+		if len(bytes.TrimSpace(content)) > 0 {
+			return false, fmt.Errorf("unable to remove %s for %s, its user section %s is not empty, it is only removed when forced", fileName, name, section)
+		}
+	}
+	return true, nil
+}
+
+// mergeExisting returns the content of a file that replaces fileName, with the user sections of
+// the existing file, or an error if the existing file may not be replaced.
+func (w *DirWriter) mergeExisting(fileName string, content []byte) ([]byte, error) {
+	existing, err := ioutil.ReadFile(fileName)
+	if os.IsNotExist(err) {
+		return content, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !w.opts.AllowOverwrite {
+		return nil, fmt.Errorf("file already exists and overwrites not allowed file: %s", fileName)
+	}
+	if !hasSections(fileName) {
+		return content, nil
+	}
+	if !w.opts.Force {
+		if err := verify(existing); err != nil {
+			return nil, fmt.Errorf("unable to overwrite %s, %v, it is only overwritten when forced", fileName, err)
+		}
+	}
+	merged, err := mergeSections(content, existing, w.opts.Force)
+	if err != nil {
+		return nil, fmt.Errorf("unable to overwrite %s: %v", fileName, err)
+	}
+	return merged, nil
+}
+
+// Close does nothing, since every file is written by WriteFiles.
+func (w *DirWriter) Close() error {
+	return nil
+}
+
+// TarWriter writes files to a tarball.
+type TarWriter struct {
+	tw *tar.Writer
+}
+
+// NewTarWriter returns a Writer that writes files to an uncompressed tarball on out.  Close
+// must be called to finish the tarball, but it does not close out.
+func NewTarWriter(out io.Writer) *TarWriter {
+	return &TarWriter{tw: tar.NewWriter(out)}
+}
+
+// WriteFiles adds files to the tarball.
+func (w *TarWriter) WriteFiles(files map[string][]byte) error {
+	for _, name := range sortedNames(files) {
+		header := &tar.Header{
+			Name:     name,
+			Mode:     0644,
+			Size:     int64(len(files[name])),
+			Typeflag: tar.TypeReg,
+		}
+		if err := w.tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err := w.tw.Write(files[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close writes the end of the tarball.
+func (w *TarWriter) Close() error {
+	return w.tw.Close()
+}
+
+// StreamWriter writes files one after the other to a stream, such as stdout.
+type StreamWriter struct {
+	out io.Writer
+}
+
+// NewStreamWriter returns a Writer that writes files to out.  Each file is preceded by a
+// comment that names it.
+func NewStreamWriter(out io.Writer) *StreamWriter {
+	return &StreamWriter{out: out}
+}
+
+// WriteFiles writes files to the stream.
+func (w *StreamWriter) WriteFiles(files map[string][]byte) error {
+	for _, name := range sortedNames(files) {
+		if _, err := fmt.Fprintf(w.out, "# File: %s\n", name); err != nil {
+			return err
+		}
+		if _, err := w.out.Write(files[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close does nothing, since the stream belongs to the caller.
+func (w *StreamWriter) Close() error {
+	return nil
+}
+
+// sortedNames returns the names of files in order, so that the output does not change from one
+// run to the next.
+func sortedNames(files map[string][]byte) []string {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,257 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipam
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sort"
+
+	"k8s.io/klog"
+
+	"github.com/GoogleCloudPlatform/gke-terraform-generator/pkg/api"
+)
+
+const (
+	// DefaultServices is the number of service IPs planned when none are given.
+	// It matches the /20 service range that GKE creates by default.
+	DefaultServices = 4096
+	// minSubnetPrefix is the smallest subnet that GCP allows.
+	minSubnetPrefix = 29
+	// masterPrefix is the size of the range GKE needs for the hosted master.
+	masterPrefix = 28
+	// reservedSubnetAddresses is the number of addresses GCP reserves in every subnet.
+	reservedSubnetAddresses = 4
+	// minPodPrefix is the smallest pod range that is planned, that of a single node with the
+	// default 110 pods per node, so that node pools without a maxCount still get one.
+	minPodPrefix = 24
+)
+
+// Request describes the cluster that network ranges are planned for.
+type Request struct {
+	// Supernet is the CIDR that all of the ranges are carved out of, for example
+	// 10.0.0.0/14.
+	Supernet string
+	// Nodes is the maximum number of nodes in the cluster.
+	Nodes int64
+	// PodAddresses is the number of pod range addresses the nodes need.  Use
+	// PodAddressesFor to work it out from a number of nodes and pods per node.
+	PodAddresses int64
+	// Services is the number of service IPs.  It defaults to DefaultServices.
+	Services int64
+	// Used are CIDRs that are already in use and must not be overlapped.
+	Used []string
+}
+
+// Plan holds the ranges planned for a cluster network.
+type Plan struct {
+	SubnetRange         string
+	PodSubnetRange      string
+	ServiceSubnetRange  string
+	MasterIPV4CIDRBlock string
+}
+
+// PodAddressesFor returns the number of pod range addresses needed by a
+// number of nodes that each run up to maxPodsPerNode pods.
+func PodAddressesFor(nodes int64, maxPodsPerNode int) int64 {
+	return nodes * api.PodSliceSize(maxPodsPerNode)
+}
+
+// NewPlan plans a subnet, pod, service and master range in the request
+// Supernet that do not overlap each other or any of the Used ranges.  The
+// largest ranges are placed first so that the smaller ones fill the gaps.
+func NewPlan(request *Request) (*Plan, error) {
+	allocator, err := newAllocator(request.Supernet, request.Used)
+	if err != nil {
+		return nil, err
+	}
+
+	services := request.Services
+	if services <= 0 {
+		services = DefaultServices
+	}
+
+	subnetPrefix := prefixFor(request.Nodes + reservedSubnetAddresses)
+	if subnetPrefix > minSubnetPrefix {
+		subnetPrefix = minSubnetPrefix
+	}
+
+	plan := &Plan{}
+	blocks := []*block{
+		{name: "subnet", prefix: subnetPrefix, result: &plan.SubnetRange},
+		{name: "pod", prefix: podPrefixFor(request.PodAddresses), result: &plan.PodSubnetRange},
+		{name: "service", prefix: prefixFor(services), result: &plan.ServiceSubnetRange},
+		{name: "master", prefix: masterPrefix, result: &plan.MasterIPV4CIDRBlock},
+	}
+	if err := allocator.allocate(blocks); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// FillNetworkSpec plans any range in the cluster network that is empty.  It
+// does nothing unless the network sets a Supernet, or when the network is an
+// existing one whose ranges are referenced by name.  The ranges that are
+// already set, and the network UsedRanges, are not overlapped, and one that is
+// not a CIDR block is an error.  The size of the ranges comes from the node
+// pools scaled up to their maxCount, with a pod range of at least a /24.
+func FillNetworkSpec(spec *api.ClusterSpec) error {
+	if spec.Network == nil || spec.Network.Spec.Supernet == "" || spec.Network.Spec.Existing != nil {
+		return nil
+	}
+	network := &spec.Network.Spec
+
+	allocator, err := newAllocator(network.Supernet, network.UsedRanges)
+	if err != nil {
+		return fmt.Errorf("unable to plan spec.network.spec ranges: %v", err)
+	}
+
+	capacity := api.CalculateNetworkCapacity(spec)
+	subnetPrefix := prefixFor(capacity.MaxNodes + reservedSubnetAddresses)
+	if subnetPrefix > minSubnetPrefix {
+		subnetPrefix = minSubnetPrefix
+	}
+
+	var blocks []*block
+	for _, b := range []*block{
+		{name: "subnetRange", prefix: subnetPrefix, result: &network.SubnetRange},
+		{name: "podSubnetRange", prefix: podPrefixFor(capacity.PodAddresses), result: &network.PodSubnetRange},
+		{name: "serviceSubnetRange", prefix: prefixFor(DefaultServices), result: &network.ServiceSubnetRange},
+		{name: "masterIPV4CIDRBlock", prefix: masterPrefix, result: &network.MasterIPV4CIDRBlock},
+	} {
+		if *b.result == "" {
+			blocks = append(blocks, b)
+			continue
+		}
+		// ranges set by the user must be left alone
+		_, ipNet, err := net.ParseCIDR(*b.result)
+		if err != nil {
+			return fmt.Errorf("unable to plan spec.network.spec ranges: spec.network.spec.%s %q is not a CIDR block", b.name, *b.result)
+		}
+		allocator.used = append(allocator.used, ipNet)
+	}
+
+	if err := allocator.allocate(blocks); err != nil {
+		return fmt.Errorf("unable to plan spec.network.spec ranges: %v", err)
+	}
+	for _, b := range blocks {
+		klog.Infof("Planned spec.network.spec.%s %s in supernet %s", b.name, *b.result, network.Supernet)
+	}
+	return nil
+}
+
+// block is a range that needs to be allocated.
+type block struct {
+	name   string
+	prefix int
+	// result is set to the CIDR of the allocated range.
+	result *string
+}
+
+// allocator hands out ranges from a supernet.
+type allocator struct {
+	supernet *net.IPNet
+	used     []*net.IPNet
+}
+
+func newAllocator(supernet string, used []string) (*allocator, error) {
+	_, supernetIPNet, err := net.ParseCIDR(supernet)
+	if err != nil || supernetIPNet.IP.To4() == nil {
+		return nil, fmt.Errorf("supernet %q is not an IPv4 CIDR block", supernet)
+	}
+
+	a := &allocator{supernet: supernetIPNet}
+	for _, cidr := range used {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("used range %q is not a CIDR block", cidr)
+		}
+		a.used = append(a.used, ipNet)
+	}
+	return a, nil
+}
+
+// allocate finds a free range for each block, largest first.
+func (a *allocator) allocate(blocks []*block) error {
+	sorted := make([]*block, len(blocks))
+	copy(sorted, blocks)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].prefix < sorted[j].prefix
+	})
+
+	for _, b := range sorted {
+		ipNet := a.next(b.prefix)
+		if ipNet == nil {
+			return fmt.Errorf("no free /%d left in %s for the %s range", b.prefix, a.supernet, b.name)
+		}
+		a.used = append(a.used, ipNet)
+		*b.result = ipNet.String()
+	}
+	return nil
+}
+
+// next returns the first range of the given prefix in the supernet that does
+// not overlap a used range, or nil if there is none.
+func (a *allocator) next(prefix int) *net.IPNet {
+	supernetPrefix, _ := a.supernet.Mask.Size()
+	if prefix < supernetPrefix || prefix > 32 {
+		return nil
+	}
+
+	start := binary.BigEndian.Uint32(a.supernet.IP.To4())
+	size := uint64(1) << uint(32-prefix)
+	count := uint64(1) << uint(prefix-supernetPrefix)
+	for i := uint64(0); i < count; i++ {
+		ip := make(net.IP, net.IPv4len)
+		binary.BigEndian.PutUint32(ip, start+uint32(i*size))
+		candidate := &net.IPNet{IP: ip, Mask: net.CIDRMask(prefix, 32)}
+		if !a.overlaps(candidate) {
+			return candidate
+		}
+	}
+	return nil
+}
+
+func (a *allocator) overlaps(candidate *net.IPNet) bool {
+	for _, used := range a.used {
+		if used.Contains(candidate.IP) || candidate.Contains(used.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+// prefixFor returns the longest prefix whose range holds the given number of
+// addresses.
+func prefixFor(addresses int64) int {
+	prefix := 32
+	for prefix > 0 && int64(1)<<uint(32-prefix) < addresses {
+		prefix--
+	}
+	return prefix
+}
+
+// podPrefixFor returns the prefix of a pod range that holds the given number
+// of addresses, but no smaller than minPodPrefix.
+func podPrefixFor(addresses int64) int {
+	prefix := prefixFor(addresses)
+	if prefix > minPodPrefix {
+		prefix = minPodPrefix
+	}
+	return prefix
+}
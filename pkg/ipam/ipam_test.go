@@ -0,0 +1,156 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipam
+
+import (
+	"testing"
+
+	"github.com/GoogleCloudPlatform/gke-terraform-generator/pkg/api"
+)
+
+var configFile = "../../examples/example.yaml"
+
+func TestNewPlan(t *testing.T) {
+	plan, err := NewPlan(&Request{
+		Supernet:     "10.0.0.0/14",
+		Nodes:        200,
+		PodAddresses: PodAddressesFor(200, 110),
+		Used:         []string{"10.0.0.0/16"},
+	})
+	if err != nil {
+		t.Fatalf("failed %v", err)
+	}
+
+	// 200 nodes with 110 pods each need a /16 of pod addresses, the first free
+	// /16 follows the used range
+	expected := Plan{
+		SubnetRange:         "10.2.16.0/24",
+		PodSubnetRange:      "10.1.0.0/16",
+		ServiceSubnetRange:  "10.2.0.0/20",
+		MasterIPV4CIDRBlock: "10.2.17.0/28",
+	}
+	if *plan != expected {
+		t.Fatalf("expected %+v, got %+v", expected, *plan)
+	}
+}
+
+func TestNewPlanFull(t *testing.T) {
+	_, err := NewPlan(&Request{
+		Supernet:     "10.0.0.0/16",
+		Nodes:        200,
+		PodAddresses: PodAddressesFor(200, 110),
+	})
+	if err == nil {
+		t.Fatal("this should have failed, a /16 can not hold a /16 pod range and the other ranges")
+	}
+
+	if _, err := NewPlan(&Request{Supernet: "10.0.0.0"}); err == nil {
+		t.Fatal("this should have failed, the supernet is not a CIDR")
+	}
+}
+
+func TestFillNetworkSpec(t *testing.T) {
+	gkeTF, err := api.UnmarshalGkeTF(configFile)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := api.SetApiDefaultValues(gkeTF); err != nil {
+		t.Fatalf("failed %v", err)
+	}
+
+	gkeTF.Spec.ProjectId = "my-project"
+
+	network := &gkeTF.Spec.Network.Spec
+	network.Supernet = "10.0.0.0/14"
+	network.UsedRanges = []string{"10.0.0.0/24"}
+	network.SubnetRange = ""
+	network.PodSubnetRange = ""
+
+	if err := FillNetworkSpec(&gkeTF.Spec); err != nil {
+		t.Fatalf("failed %v", err)
+	}
+
+	// the ranges that were set are left alone
+	if network.ServiceSubnetRange != "10.2.0.0/20" || network.MasterIPV4CIDRBlock != "172.16.0.16/28" {
+		t.Fatalf("ranges were changed %+v", network)
+	}
+	// 22 nodes need 3072 pod addresses, which is a /20
+	if network.PodSubnetRange != "10.0.16.0/20" {
+		t.Fatalf("unexpected pod range %s", network.PodSubnetRange)
+	}
+	if network.SubnetRange != "10.0.1.0/27" {
+		t.Fatalf("unexpected subnet range %s", network.SubnetRange)
+	}
+
+	if err := api.ValidateYamlInput(gkeTF); err != nil {
+		t.Fatalf("the planned ranges are not valid: %v", err)
+	}
+}
+
+func TestFillNetworkSpecInvalid(t *testing.T) {
+	gkeTF, err := api.UnmarshalGkeTF(configFile)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := api.SetApiDefaultValues(gkeTF); err != nil {
+		t.Fatalf("failed %v", err)
+	}
+
+	network := &gkeTF.Spec.Network.Spec
+	network.Supernet = "10.0.0.0/14"
+	network.SubnetRange = ""
+	network.PodSubnetRange = ""
+	network.ServiceSubnetRange = "10.2.0.0/33"
+
+	// a range that is set but can not be parsed is not planned around
+	if err := FillNetworkSpec(&gkeTF.Spec); err == nil {
+		t.Fatal("this should have failed, the service range is not a CIDR")
+	}
+}
+
+func TestFillNetworkSpecMinimumPodRange(t *testing.T) {
+	gkeTF, err := api.UnmarshalGkeTF(configFile)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := api.SetApiDefaultValues(gkeTF); err != nil {
+		t.Fatalf("failed %v", err)
+	}
+
+	network := &gkeTF.Spec.Network.Spec
+	network.Supernet = "10.0.0.0/14"
+	network.SubnetRange = ""
+	network.PodSubnetRange = ""
+	for _, nodePool := range *gkeTF.Spec.NodePools {
+		nodePool.Spec.MaxCount = 0
+	}
+
+	if err := FillNetworkSpec(&gkeTF.Spec); err != nil {
+		t.Fatalf("failed %v", err)
+	}
+	if network.PodSubnetRange != "10.0.0.0/24" {
+		t.Fatalf("expected a /24 pod range, got %s", network.PodSubnetRange)
+	}
+}
+
+func TestPrefixFor(t *testing.T) {
+	for addresses, expected := range map[int64]int{1: 32, 2: 31, 3: 30, 256: 24, 257: 23, 4096: 20} {
+		if got := prefixFor(addresses); got != expected {
+			t.Errorf("%d addresses: expected /%d, got /%d", addresses, expected, got)
+		}
+	}
+}
@@ -0,0 +1,252 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package overlay
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// operation is a single JSON6902 operation.  See
+// https://tools.ietf.org/html/rfc6902
+type operation struct {
+	Op    string    `yaml:"op"`
+	Path  string    `yaml:"path"`
+	From  string    `yaml:"from"`
+	Value yaml.Node `yaml:"value"`
+}
+
+// newOperations decodes a list of JSON6902 operations.
+func newOperations(node *yaml.Node) ([]*operation, error) {
+	var operations []*operation
+	for i, item := range node.Content {
+		op := &operation{}
+		if err := item.Decode(op); err != nil {
+			return nil, fmt.Errorf("operation %d: %v", i, err)
+		}
+		switch op.Op {
+		case "add", "replace", "test":
+			if op.Value.Kind == 0 {
+				return nil, fmt.Errorf("operation %d: %s requires a value", i, op.Op)
+			}
+		case "move", "copy":
+			if op.From == "" {
+				return nil, fmt.Errorf("operation %d: %s requires from", i, op.Op)
+			}
+		case "remove":
+		default:
+			return nil, fmt.Errorf("operation %d: unknown op %q", i, op.Op)
+		}
+		operations = append(operations, op)
+	}
+	return operations, nil
+}
+
+// apply applies the operation to root and returns the new root.
+func (op *operation) apply(root *yaml.Node) (*yaml.Node, error) {
+	switch op.Op {
+	case "add":
+		return add(root, op.Path, copyNode(&op.Value))
+	case "remove":
+		_, err := remove(root, op.Path)
+		return root, err
+	case "replace":
+		if _, err := remove(root, op.Path); err != nil {
+			return nil, err
+		}
+		return add(root, op.Path, copyNode(&op.Value))
+	case "move":
+		value, err := remove(root, op.From)
+		if err != nil {
+			return nil, err
+		}
+		return add(root, op.Path, value)
+	case "copy":
+		value, err := get(root, op.From)
+		if err != nil {
+			return nil, err
+		}
+		return add(root, op.Path, copyNode(value))
+	case "test":
+		value, err := get(root, op.Path)
+		if err != nil {
+			return nil, err
+		}
+		if !equalNodes(value, &op.Value) {
+			return nil, fmt.Errorf("test failed, %s is not the expected value", op.Path)
+		}
+		return root, nil
+	}
+	return nil, fmt.Errorf("unknown op %q", op.Op)
+}
+
+// splitPointer splits a JSON pointer into its unescaped tokens.
+func splitPointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("path %q must start with /", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		token = strings.Replace(token, "~1", "/", -1)
+		tokens[i] = strings.Replace(token, "~0", "~", -1)
+	}
+	return tokens, nil
+}
+
+// parent returns the node that holds the last token of pointer, and that token.
+func parent(root *yaml.Node, pointer string) (*yaml.Node, string, error) {
+	tokens, err := splitPointer(pointer)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(tokens) == 0 {
+		return nil, "", fmt.Errorf("path %q must not be the root", pointer)
+	}
+	node := root
+	for _, token := range tokens[:len(tokens)-1] {
+		if node, err = child(node, token); err != nil {
+			return nil, "", fmt.Errorf("path %q: %v", pointer, err)
+		}
+	}
+	return node, tokens[len(tokens)-1], nil
+}
+
+// child returns the value of token in a mapping or sequence node.
+func child(node *yaml.Node, token string) (*yaml.Node, error) {
+	switch node.Kind {
+	case yaml.MappingNode:
+		if value := mappingValue(node, token); value != nil {
+			return value, nil
+		}
+		return nil, fmt.Errorf("%s not found", token)
+	case yaml.SequenceNode:
+		index, err := listIndex(node, token, false)
+		if err != nil {
+			return nil, err
+		}
+		return node.Content[index], nil
+	}
+	return nil, fmt.Errorf("%s not found, the parent is not a mapping or a list", token)
+}
+
+// listIndex parses a list index.  When appending, the index may be one past
+// the end of the list, or "-".
+func listIndex(node *yaml.Node, token string, appending bool) (int, error) {
+	if appending && token == "-" {
+		return len(node.Content), nil
+	}
+	index, err := strconv.Atoi(token)
+	if err != nil || index < 0 {
+		return 0, fmt.Errorf("%s is not a list index", token)
+	}
+	if index > len(node.Content) || (!appending && index == len(node.Content)) {
+		return 0, fmt.Errorf("index %d is out of range", index)
+	}
+	return index, nil
+}
+
+func get(root *yaml.Node, pointer string) (*yaml.Node, error) {
+	tokens, err := splitPointer(pointer)
+	if err != nil {
+		return nil, err
+	}
+	node := root
+	for _, token := range tokens {
+		if node, err = child(node, token); err != nil {
+			return nil, fmt.Errorf("path %q: %v", pointer, err)
+		}
+	}
+	return node, nil
+}
+
+func add(root *yaml.Node, pointer string, value *yaml.Node) (*yaml.Node, error) {
+	if pointer == "" {
+		return value, nil
+	}
+	node, token, err := parent(root, pointer)
+	if err != nil {
+		return nil, err
+	}
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == token {
+				node.Content[i+1] = value
+				return root, nil
+			}
+		}
+		key := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: token}
+		node.Content = append(node.Content, key, value)
+	case yaml.SequenceNode:
+		index, err := listIndex(node, token, true)
+		if err != nil {
+			return nil, fmt.Errorf("path %q: %v", pointer, err)
+		}
+		node.Content = append(node.Content, nil)
+		copy(node.Content[index+1:], node.Content[index:])
+		node.Content[index] = value
+	default:
+		return nil, fmt.Errorf("path %q: the parent is not a mapping or a list", pointer)
+	}
+	return root, nil
+}
+
+// remove removes the value at pointer and returns it.
+func remove(root *yaml.Node, pointer string) (*yaml.Node, error) {
+	node, token, err := parent(root, pointer)
+	if err != nil {
+		return nil, err
+	}
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == token {
+				value := node.Content[i+1]
+				node.Content = append(node.Content[:i], node.Content[i+2:]...)
+				return value, nil
+			}
+		}
+	case yaml.SequenceNode:
+		index, err := listIndex(node, token, false)
+		if err != nil {
+			return nil, fmt.Errorf("path %q: %v", pointer, err)
+		}
+		value := node.Content[index]
+		node.Content = append(node.Content[:index], node.Content[index+1:]...)
+		return value, nil
+	}
+	return nil, fmt.Errorf("path %q not found", pointer)
+}
+
+// equalNodes compares the values of two nodes, ignoring their style.
+func equalNodes(a, b *yaml.Node) bool {
+	var va, vb interface{}
+	if err := a.Decode(&va); err != nil {
+		return false
+	}
+	if err := b.Decode(&vb); err != nil {
+		return false
+	}
+	return reflect.DeepEqual(va, vb)
+}
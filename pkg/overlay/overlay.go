@@ -0,0 +1,239 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package overlay applies environment specific patches to a base GkeTF.
+//
+// An overlay file holds one or more YAML documents.  A mapping document is a
+// strategic merge patch: mappings are merged key by key, a null value removes
+// a key, and lists whose items have a metadata.name, such as nodePools, are
+// merged item by item by that name.  An item with "$patch: delete" removes the
+// item of the same name.  Any other list is replaced.  A strategic merge patch
+// with a metadata.name only applies to the cluster of that name.
+//
+// A sequence document is a list of JSON6902 operations (add, remove, replace,
+// move, copy and test) whose paths are JSON pointers, for example
+// /spec/nodePools/0/spec/maxCount.  They apply to every cluster.
+package overlay
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	yamlv2 "gopkg.in/yaml.v2"
+	"gopkg.in/yaml.v3"
+
+	"github.com/GoogleCloudPlatform/gke-terraform-generator/pkg/api"
+)
+
+// Patch is a single document of an overlay file.
+type Patch struct {
+	// File is the overlay file that the patch was read from.
+	File string
+	// Index is the position of the document in the file, starting at zero.
+	Index int
+	// Target is the metadata.name of the cluster that a strategic merge patch
+	// applies to.  It is empty if the patch applies to every cluster.
+	Target string
+
+	// merge is the strategic merge patch, or nil for JSON6902 operations.
+	merge *yaml.Node
+	// operations are the JSON6902 operations of the patch.
+	operations []*operation
+}
+
+// String names the patch by its file and document index.
+func (p *Patch) String() string {
+	return fmt.Sprintf("%s[%d]", p.File, p.Index)
+}
+
+// Load reads the patches of each overlay file, in order.
+func Load(files []string) ([]*Patch, error) {
+	var patches []*Patch
+	for _, file := range files {
+		source, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		decoder := yaml.NewDecoder(bytes.NewReader(source))
+		for index := 0; ; index++ {
+			var doc yaml.Node
+			if err := decoder.Decode(&doc); err == io.EOF {
+				break
+			} else if err != nil {
+				return nil, fmt.Errorf("%s: document %d: %v", file, index, err)
+			}
+			if len(doc.Content) == 0 {
+				continue
+			}
+
+			patch, err := newPatch(doc.Content[0])
+			if err != nil {
+				return nil, fmt.Errorf("%s: document %d: %v", file, index, err)
+			}
+			patch.File = file
+			patch.Index = index
+			patches = append(patches, patch)
+		}
+	}
+	return patches, nil
+}
+
+func newPatch(node *yaml.Node) (*Patch, error) {
+	switch node.Kind {
+	case yaml.MappingNode:
+		patch := &Patch{merge: node}
+		if metadata := mappingValue(node, "metadata"); metadata != nil {
+			if name := mappingValue(metadata, "name"); name != nil {
+				patch.Target = name.Value
+			}
+		}
+		return patch, nil
+	case yaml.SequenceNode:
+		operations, err := newOperations(node)
+		if err != nil {
+			return nil, err
+		}
+		return &Patch{operations: operations}, nil
+	default:
+		return nil, fmt.Errorf("an overlay must be a mapping or a list of JSON6902 operations")
+	}
+}
+
+// Apply applies the patches, in order, to gkeTF.  Strategic merge patches
+// that target another cluster are skipped.  The result is decoded as strictly
+// as the configuration file, so a patch can not add unknown fields.
+func Apply(gkeTF *api.GkeTF, patches []*Patch) error {
+	if len(patches) == 0 {
+		return nil
+	}
+
+	node, err := toNode(gkeTF)
+	if err != nil {
+		return err
+	}
+
+	for _, patch := range patches {
+		if patch.merge != nil {
+			if patch.Target != "" && patch.Target != gkeTF.Name {
+				continue
+			}
+			node = mergeNode(node, patch.merge)
+			continue
+		}
+		for i, op := range patch.operations {
+			if node, err = op.apply(node); err != nil {
+				return fmt.Errorf("%s: operation %d: %v", patch, i, err)
+			}
+		}
+	}
+
+	b, err := yaml.Marshal(node)
+	if err != nil {
+		return err
+	}
+	merged := &api.GkeTF{}
+	if err := yamlv2.UnmarshalStrict(b, merged); err != nil {
+		return fmt.Errorf("the overlays for %s do not produce a valid configuration: %v", gkeTF.Name, err)
+	}
+	*gkeTF = *merged
+	return nil
+}
+
+// Marshal encodes gkeTF as YAML, leaving out the fields that are not set.
+func Marshal(gkeTF *api.GkeTF) ([]byte, error) {
+	node, err := toNode(gkeTF)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(node); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// toNode converts gkeTF to a YAML node tree.  The api types are encoded with
+// yaml.v2, which is what they are decoded with, and fields that are null are
+// removed.
+func toNode(gkeTF *api.GkeTF) (*yaml.Node, error) {
+	b, err := yamlv2.Marshal(gkeTF)
+	if err != nil {
+		return nil, err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return nil, err
+	}
+	node := doc.Content[0]
+	removeNulls(node)
+	return node, nil
+}
+
+// removeNulls removes the mapping keys whose value is null.
+func removeNulls(node *yaml.Node) {
+	switch node.Kind {
+	case yaml.MappingNode:
+		content := node.Content[:0]
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if isNull(node.Content[i+1]) {
+				continue
+			}
+			removeNulls(node.Content[i+1])
+			content = append(content, node.Content[i], node.Content[i+1])
+		}
+		node.Content = content
+	case yaml.SequenceNode:
+		for _, item := range node.Content {
+			removeNulls(item)
+		}
+	}
+}
+
+func isNull(node *yaml.Node) bool {
+	return node.Kind == yaml.ScalarNode && node.Tag == "!!null"
+}
+
+// mappingValue returns the value of key in a mapping node, or nil.
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// copyNode returns a deep copy of node.
+func copyNode(node *yaml.Node) *yaml.Node {
+	c := *node
+	c.Content = make([]*yaml.Node, len(node.Content))
+	for i, child := range node.Content {
+		c.Content[i] = copyNode(child)
+	}
+	return &c
+}
@@ -0,0 +1,206 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package overlay
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/GoogleCloudPlatform/gke-terraform-generator/pkg/api"
+)
+
+var configFile = "../../examples/example.yaml"
+
+func loadPatches(t *testing.T, overlay string) []*Patch {
+	dir, err := ioutil.TempDir("", "gke-tf")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "overlay.yaml")
+	if err := ioutil.WriteFile(file, []byte(overlay), 0644); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	patches, err := Load([]string{file})
+	if err != nil {
+		t.Fatalf("failed %v", err)
+	}
+	return patches
+}
+
+func parseYAML(t *testing.T) *api.GkeTF {
+	gkeTF, err := api.UnmarshalGkeTF(configFile)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	return gkeTF
+}
+
+func TestStrategicMerge(t *testing.T) {
+	gkeTF := parseYAML(t)
+	patches := loadPatches(t, `
+spec:
+  region: us-east1
+  zones: null
+  labels:
+    l3: v3
+  tags:
+    - prod
+  nodePools:
+    - metadata:
+        name: my-node-pool
+      spec:
+        maxCount: 20
+    - metadata:
+        name: my-other-nodepool
+      $patch: delete
+    - metadata:
+        name: gpu-pool
+      spec:
+        machineType: n1-standard-8
+---
+metadata:
+  name: another-cluster
+spec:
+  region: europe-west1
+`)
+
+	if err := Apply(gkeTF, patches); err != nil {
+		t.Fatalf("failed %v", err)
+	}
+
+	spec := gkeTF.Spec
+	// the patch for another cluster is skipped
+	if spec.Region != "us-east1" {
+		t.Fatalf("expected region us-east1, got %s", spec.Region)
+	}
+	if spec.Zones != nil {
+		t.Fatalf("expected zones to be removed, got %v", *spec.Zones)
+	}
+	if len(*spec.Labels) != 3 || (*spec.Labels)["l1"] != "v1" {
+		t.Fatalf("expected labels to be merged, got %v", *spec.Labels)
+	}
+	if len(*spec.Tags) != 1 || (*spec.Tags)[0] != "prod" {
+		t.Fatalf("expected tags to be replaced, got %v", *spec.Tags)
+	}
+
+	nodePools := *spec.NodePools
+	if len(nodePools) != 2 || nodePools[0].Name != "my-node-pool" || nodePools[1].Name != "gpu-pool" {
+		t.Fatalf("unexpected node pools %v", nodePools)
+	}
+	// fields of a node pool that are not patched are kept
+	if nodePools[0].Spec.MaxCount != 20 || nodePools[0].Spec.MaxPodsPerNode != 64 {
+		t.Fatalf("expected my-node-pool to be merged, got %+v", nodePools[0].Spec)
+	}
+}
+
+func TestNewPatch(t *testing.T) {
+	var node yaml.Node
+	if err := yaml.Unmarshal([]byte("- op: foo\n"), &node); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if _, err := newPatch(node.Content[0]); err == nil {
+		t.Error("this should have failed, foo is not an operation")
+	}
+	if err := yaml.Unmarshal([]byte("just a string\n"), &node); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if _, err := newPatch(node.Content[0]); err == nil {
+		t.Error("this should have failed, an overlay can not be a string")
+	}
+}
+
+func TestJSONPatch(t *testing.T) {
+	gkeTF := parseYAML(t)
+	patches := loadPatches(t, `
+- op: test
+  path: /spec/nodePools/1/metadata/name
+  value: my-other-nodepool
+- op: replace
+  path: /spec/nodePools/1/spec/diskType
+  value: pd-standard
+- op: add
+  path: /spec/tags/-
+  value: prod
+- op: copy
+  from: /spec/labels
+  path: /spec/nodePools/1/spec/labels
+- op: move
+  from: /spec/network/spec/masterIPV4CIDRBlock
+  path: /spec/network/spec/supernet
+- op: remove
+  path: /spec/nodePools/0
+`)
+
+	if err := Apply(gkeTF, patches); err != nil {
+		t.Fatalf("failed %v", err)
+	}
+
+	nodePools := *gkeTF.Spec.NodePools
+	if len(nodePools) != 1 || nodePools[0].Spec.DiskType != "pd-standard" {
+		t.Fatalf("unexpected node pools %v", nodePools)
+	}
+	if nodePools[0].Spec.Labels == nil || (*nodePools[0].Spec.Labels)["l1"] != "v1" {
+		t.Fatalf("expected the labels to be copied")
+	}
+	if tags := *gkeTF.Spec.Tags; len(tags) != 3 || tags[2] != "prod" {
+		t.Fatalf("expected prod to be appended, got %v", tags)
+	}
+	network := gkeTF.Spec.Network.Spec
+	if network.MasterIPV4CIDRBlock != "" || network.Supernet != "172.16.0.16/28" {
+		t.Fatalf("expected the master range to be moved, got %+v", network)
+	}
+}
+
+func TestJSONPatchFailures(t *testing.T) {
+	for _, overlay := range []string{
+		"- op: test\n  path: /spec/region\n  value: europe-west1\n",
+		"- op: remove\n  path: /spec/missing\n",
+		"- op: add\n  path: /spec/nodePools/5\n  value: {}\n",
+		// the result is decoded strictly
+		"- op: add\n  path: /spec/unknown\n  value: true\n",
+	} {
+		if err := Apply(parseYAML(t), loadPatches(t, overlay)); err == nil {
+			t.Errorf("this should have failed: %s", overlay)
+		}
+	}
+
+	if _, err := Load([]string{"missing.yaml"}); err == nil {
+		t.Error("this should have failed, the overlay does not exist")
+	}
+}
+
+func TestMarshal(t *testing.T) {
+	b, err := Marshal(parseYAML(t))
+	if err != nil {
+		t.Fatalf("failed %v", err)
+	}
+	s := string(b)
+	if !strings.HasPrefix(s, "apiVersion: gke-tf.dev/v1beta1\nkind: gke-cluster\nmetadata:\n  name: test-cluster\n") {
+		t.Fatalf("unexpected yaml %s", s)
+	}
+	// fields that are not set are left out
+	if strings.Contains(s, "null") {
+		t.Fatalf("unexpected null in %s", s)
+	}
+}
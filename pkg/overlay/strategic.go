@@ -0,0 +1,151 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package overlay
+
+import (
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// directiveKey is the mapping key that changes how a strategic merge patch
+	// is applied to a mapping.
+	directiveKey = "$patch"
+	// deleteDirective removes the list item with the same metadata.name.
+	deleteDirective = "delete"
+	// replaceDirective replaces the mapping instead of merging it.
+	replaceDirective = "replace"
+)
+
+// mergeNode returns the result of applying a strategic merge patch to dst.
+// dst is not modified, and may be nil.
+func mergeNode(dst, patch *yaml.Node) *yaml.Node {
+	switch patch.Kind {
+	case yaml.MappingNode:
+		if dst == nil || dst.Kind != yaml.MappingNode || directive(patch) == replaceDirective {
+			dst = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		} else {
+			dst = copyNode(dst)
+		}
+
+		for i := 0; i+1 < len(patch.Content); i += 2 {
+			key, value := patch.Content[i], patch.Content[i+1]
+			if key.Value == directiveKey {
+				continue
+			}
+
+			index := -1
+			for j := 0; j+1 < len(dst.Content); j += 2 {
+				if dst.Content[j].Value == key.Value {
+					index = j
+					break
+				}
+			}
+
+			switch {
+			case isNull(value) && index >= 0:
+				// a null value removes the key
+				dst.Content = append(dst.Content[:index], dst.Content[index+2:]...)
+			case isNull(value):
+			case index >= 0:
+				dst.Content[index+1] = mergeNode(dst.Content[index+1], value)
+			default:
+				dst.Content = append(dst.Content, copyNode(key), mergeNode(nil, value))
+			}
+		}
+		return dst
+
+	case yaml.SequenceNode:
+		if dst != nil && dst.Kind == yaml.SequenceNode && isNamedList(dst) && isNamedList(patch) {
+			return mergeNamedList(dst, patch)
+		}
+		// any other list is replaced
+		list := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", Style: patch.Style}
+		for _, item := range patch.Content {
+			if directive(item) == deleteDirective {
+				continue
+			}
+			list.Content = append(list.Content, mergeNode(nil, item))
+		}
+		return list
+
+	default:
+		return copyNode(patch)
+	}
+}
+
+// mergeNamedList merges the items of patch into the items of dst that have the
+// same metadata.name.  Items that are new are appended.
+func mergeNamedList(dst, patch *yaml.Node) *yaml.Node {
+	list := copyNode(dst)
+	for _, item := range patch.Content {
+		name := itemName(item)
+		index := -1
+		for i, existing := range list.Content {
+			if itemName(existing) == name {
+				index = i
+				break
+			}
+		}
+
+		switch {
+		case directive(item) == deleteDirective && index >= 0:
+			list.Content = append(list.Content[:index], list.Content[index+1:]...)
+		case directive(item) == deleteDirective:
+		case index >= 0:
+			list.Content[index] = mergeNode(list.Content[index], item)
+		default:
+			list.Content = append(list.Content, mergeNode(nil, item))
+		}
+	}
+	return list
+}
+
+// isNamedList returns true if every item of a non empty list has a
+// metadata.name.
+func isNamedList(node *yaml.Node) bool {
+	if len(node.Content) == 0 {
+		return false
+	}
+	for _, item := range node.Content {
+		if itemName(item) == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// itemName returns the metadata.name of a list item, or an empty string.
+func itemName(item *yaml.Node) string {
+	metadata := mappingValue(item, "metadata")
+	if metadata == nil {
+		return ""
+	}
+	name := mappingValue(metadata, "name")
+	if name == nil || name.Kind != yaml.ScalarNode {
+		return ""
+	}
+	return name.Value
+}
+
+// directive returns the $patch directive of a mapping, or an empty string.
+func directive(node *yaml.Node) string {
+	value := mappingValue(node, directiveKey)
+	if value == nil {
+		return ""
+	}
+	return value.Value
+}
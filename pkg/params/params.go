@@ -0,0 +1,419 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package params turns the fields of a cluster into terraform variables, so that the terraform
+// of one cluster can be reused for others by replacing its terraform.tfvars.
+//
+// The templates and the builder write the value of a field with Var.  Without Parameters, which
+// is a nil *Parameters, Var returns the value as an HCL literal.  With Parameters it returns a
+// reference to a typed variable, such as var.node_pools_default_machine_type, and the variables
+// are written to parameters.tf, with their values in terraform.tfvars.
+package params
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"unicode"
+
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+
+	"github.com/GoogleCloudPlatform/gke-terraform-generator/pkg/schema"
+)
+
+const (
+	// VariablesFileName is the name of the file that declares the variables of the fields.
+	VariablesFileName = "parameters.tf"
+	// TFVarsFileName is the name of the file that holds the values of the variables, which
+	// terraform reads by default.
+	TFVarsFileName = "terraform.tfvars"
+)
+
+// reservedNames are the names that terraform does not allow for variables, since they are
+// arguments of module blocks.  The variable of spec.version is cluster_version.
+var reservedNames = map[string]bool{
+	"count":      true,
+	"depends_on": true,
+	"for_each":   true,
+	"lifecycle":  true,
+	"locals":     true,
+	"providers":  true,
+	"source":     true,
+	"version":    true,
+}
+
+// license is the comment at the start of the variables file.
+const license = `/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+`
+
+// Variable is a terraform variable that holds the value of a field of the cluster.
+type Variable struct {
+	// Name is the name of the variable, such as node_pools_default_machine_type.
+	Name string
+	// Path is the yaml path of the field, with the names of the list items that the variable
+	// is scoped to, such as spec.nodePools[default].spec.machineType.  It is empty for the
+	// variables that the templates declare themselves, such as project_id.
+	Path string
+	// Description is the path and the first sentence of the doc comment of the field.
+	Description string
+	// Value is the value of the field.
+	Value cty.Value
+}
+
+// Parameters collects the variables of a cluster.  A nil *Parameters writes literals instead.
+type Parameters struct {
+	// variables are the variables of the fields, in the order they were first referenced.
+	variables []*Variable
+	// values are the values of the variables that the templates declare.
+	values []*Variable
+	// root documents the fields of the api, to check the paths and describe the variables.
+	root *schema.Field
+}
+
+// New returns empty Parameters.
+func New() (*Parameters, error) {
+	root, err := schema.Explain("")
+	if err != nil {
+		return nil, err
+	}
+	return &Parameters{root: root}, nil
+}
+
+// Var returns an HCL expression for value, the value of the field at path, such as
+// spec.nodePools.spec.machineType.  Every list of objects on the path, such as nodePools, takes
+// the name of an item from scope.
+//
+// Without Parameters the expression is the literal of value.  Otherwise it is a reference to the
+// variable of the field, which is named after the path, without its spec segments, and the
+// scope, in snake case, such as var.node_pools_default_machine_type, or cluster_version for a
+// name that terraform reserves.  Strings, integers, bools,
+// lists of strings and maps of strings are supported, or pointers to them, and a nil pointer is
+// the empty value of its type.
+func (p *Parameters) Var(path string, value interface{}, scope ...string) (string, error) {
+	v, err := ctyValue(value)
+	if err != nil {
+		return "", fmt.Errorf("%s: %v", path, err)
+	}
+	if p == nil {
+		return Literal(v), nil
+	}
+
+	name, scopedPath, description, err := p.describe(path, scope)
+	if err != nil {
+		return "", err
+	}
+	for _, variable := range p.variables {
+		if variable.Name != name {
+			continue
+		}
+		if variable.Path != scopedPath {
+			return "", fmt.Errorf("%s and %s are both named %s", variable.Path, scopedPath, name)
+		}
+		if !variable.Value.RawEquals(v) {
+			return "", fmt.Errorf("%s has two values, %s and %s", scopedPath, Literal(variable.Value), Literal(v))
+		}
+		return "var." + name, nil
+	}
+	p.variables = append(p.variables, &Variable{Name: name, Path: scopedPath, Description: description, Value: v})
+	return "var." + name, nil
+}
+
+// TFVar returns the literal of value, the default of a variable that the templates declare, such
+// as project_id.  With Parameters the value is also written to the tfvars.
+func (p *Parameters) TFVar(name string, value interface{}) (string, error) {
+	v, err := ctyValue(value)
+	if err != nil {
+		return "", fmt.Errorf("%s: %v", name, err)
+	}
+	if p == nil {
+		return Literal(v), nil
+	}
+	if !hclsyntax.ValidIdentifier(name) {
+		return "", fmt.Errorf("%q is not a valid variable name", name)
+	}
+	for _, variable := range p.values {
+		if variable.Name == name {
+			variable.Value = v
+			return Literal(v), nil
+		}
+	}
+	p.values = append(p.values, &Variable{Name: name, Value: v})
+	return Literal(v), nil
+}
+
+// Variables returns the variables of the fields, in the order they were first referenced.
+func (p *Parameters) Variables() []*Variable {
+	return p.variables
+}
+
+// VariablesFile returns the parameters.tf that declares the variables of the fields.  They
+// have no defaults, so that every value is set by the tfvars.
+func (p *Parameters) VariablesFile() []byte {
+	f := hclwrite.NewEmptyFile()
+	body := f.Body()
+	body.AppendUnstructuredTokens(hclwrite.Tokens{
+		{Type: hclsyntax.TokenComment, Bytes: []byte(license)},
+		{Type: hclsyntax.TokenNewline, Bytes: []byte("\n")},
+		{Type: hclsyntax.TokenComment, Bytes: []byte("// The variables of the fields of the cluster, whose values are in " + TFVarsFileName + "\n")},
+	})
+	for _, variable := range p.variables {
+		body.AppendNewline()
+		block := body.AppendNewBlock("variable", []string{variable.Name}).Body()
+		block.SetAttributeValue("description", cty.StringVal(variable.Description))
+		block.SetAttributeRaw("type", hclwrite.Tokens{
+			{Type: hclsyntax.TokenIdent, Bytes: []byte(typeName(variable.Value.Type()))},
+		})
+	}
+	return hclwrite.Format(f.Bytes())
+}
+
+// TFVarsFile returns the terraform.tfvars that sets every variable to the value of the cluster:
+// first those that the templates declare, then those of the fields.
+func (p *Parameters) TFVarsFile() []byte {
+	var b bytes.Buffer
+	b.WriteString("// The values of the cluster.  Replace them, or pass another file with -var-file, to\n")
+	b.WriteString("// apply the same terraform to another cluster.\n")
+	for _, variables := range [][]*Variable{p.values, p.variables} {
+		if len(variables) == 0 {
+			continue
+		}
+		b.WriteString("\n")
+		for _, variable := range variables {
+			// the keys are quoted, since the values of the tfvars are not checked by the templates
+			fmt.Fprintf(&b, "%s = %s\n", variable.Name, Literal(variable.Value))
+		}
+	}
+	return hclwrite.Format(b.Bytes())
+}
+
+// describe returns the name, the scoped path and the description of the variable of the field
+// at path.
+func (p *Parameters) describe(path string, scope []string) (string, string, string, error) {
+	field := p.root
+	var names, segments []string
+	for _, segment := range strings.Split(path, ".") {
+		var child *schema.Field
+		for _, f := range field.Fields {
+			if f.Name == segment {
+				child = f
+				break
+			}
+		}
+		if child == nil {
+			return "", "", "", fmt.Errorf("the field %s does not exist", path)
+		}
+		field = child
+		if segment != "spec" {
+			names = append(names, snakeCase(segment))
+		}
+		if !strings.HasPrefix(field.Type, "[]") || len(field.Fields) == 0 {
+			segments = append(segments, segment)
+			continue
+		}
+		// a list of objects, whose item is named by the scope
+		if len(scope) == 0 {
+			return "", "", "", fmt.Errorf("%s needs the name of an item of %s", path, segment)
+		}
+		names = append(names, snakeCase(scope[0]))
+		segments = append(segments, segment+"["+scope[0]+"]")
+		scope = scope[1:]
+	}
+	if len(scope) > 0 {
+		return "", "", "", fmt.Errorf("%s has no list for the names %v", path, scope)
+	}
+	name := strings.Join(names, "_")
+	if reservedNames[name] {
+		name = "cluster_" + name
+	}
+	scopedPath := strings.Join(segments, ".")
+	return name, scopedPath, scopedPath + ": " + firstSentence(field.Description), nil
+}
+
+// Literal returns the HCL literal of a value.  Lists and maps are written one item per line, and
+// the keys of maps that are not identifiers, such as app.kubernetes.io/name, are quoted.
+func Literal(v cty.Value) string {
+	t := v.Type()
+	switch {
+	case t.IsListType():
+		if v.LengthInt() == 0 {
+			return "[]"
+		}
+		var b strings.Builder
+		b.WriteString("[\n")
+		for it := v.ElementIterator(); it.Next(); {
+			_, element := it.Element()
+			b.WriteString("  " + Literal(element) + ",\n")
+		}
+		b.WriteString("]")
+		return b.String()
+	case t.IsMapType():
+		if v.LengthInt() == 0 {
+			return "{}"
+		}
+		var b strings.Builder
+		b.WriteString("{\n")
+		// the elements of a map are sorted by key
+		for it := v.ElementIterator(); it.Next(); {
+			key, element := it.Element()
+			k := key.AsString()
+			if !hclsyntax.ValidIdentifier(k) {
+				k = Literal(key)
+			}
+			b.WriteString("  " + k + " = " + Literal(element) + "\n")
+		}
+		b.WriteString("}")
+		return b.String()
+	}
+	return string(hclwrite.TokensForValue(v).Bytes())
+}
+
+// ctyValue returns the value of a field.
+func ctyValue(value interface{}) (cty.Value, error) {
+	v := reflect.ValueOf(value)
+	if !v.IsValid() {
+		return cty.NilVal, fmt.Errorf("nil has no type")
+	}
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v = reflect.Zero(v.Type().Elem())
+		} else {
+			v = v.Elem()
+		}
+	}
+	// an api.Bool
+	if b, ok := v.Interface().(interface{ IsTrue() bool }); ok {
+		return cty.BoolVal(b.IsTrue()), nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return cty.StringVal(v.String()), nil
+	case reflect.Bool:
+		return cty.BoolVal(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return cty.NumberIntVal(v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return cty.NumberUIntVal(v.Uint()), nil
+	case reflect.Slice, reflect.Array:
+		if v.Len() == 0 {
+			return cty.ListValEmpty(cty.String), nil
+		}
+		var elements []cty.Value
+		for i := 0; i < v.Len(); i++ {
+			s, ok := indirect(v.Index(i))
+			if !ok {
+				return cty.NilVal, fmt.Errorf("%s is not a list of strings", v.Type())
+			}
+			elements = append(elements, cty.StringVal(s))
+		}
+		return cty.ListVal(elements), nil
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return cty.NilVal, fmt.Errorf("%s is not a map of strings", v.Type())
+		}
+		if v.Len() == 0 {
+			return cty.MapValEmpty(cty.String), nil
+		}
+		elements := map[string]cty.Value{}
+		for _, key := range v.MapKeys() {
+			s, ok := indirect(v.MapIndex(key))
+			if !ok {
+				return cty.NilVal, fmt.Errorf("%s is not a map of strings", v.Type())
+			}
+			elements[key.String()] = cty.StringVal(s)
+		}
+		return cty.MapVal(elements), nil
+	}
+	return cty.NilVal, fmt.Errorf("%s is not supported", v.Type())
+}
+
+// indirect returns the string of an item of a list or a map, which may be an interface, as the
+// items of the lists of the Concat function of the templates are.
+func indirect(v reflect.Value) (string, bool) {
+	for v.Kind() == reflect.Interface || v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return "", false
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.String {
+		return "", false
+	}
+	return v.String(), true
+}
+
+// typeName returns the type constraint of a value, such as list(string).
+func typeName(t cty.Type) string {
+	switch {
+	case t.IsListType():
+		return "list(" + typeName(t.ElementType()) + ")"
+	case t.IsMapType():
+		return "map(" + typeName(t.ElementType()) + ")"
+	case t == cty.Number:
+		return "number"
+	case t == cty.Bool:
+		return "bool"
+	}
+	return "string"
+}
+
+// snakeCase returns a yaml key or a name in snake case, such as disk_size_gb for diskSizeGB, or
+// my_pool for my-pool.
+func snakeCase(s string) string {
+	runes := []rune(s)
+	var b strings.Builder
+	for i, r := range runes {
+		switch {
+		case unicode.IsUpper(r):
+			if i > 0 && (unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1]) ||
+				unicode.IsUpper(runes[i-1]) && i+1 < len(runes) && unicode.IsLower(runes[i+1])) {
+				b.WriteRune('_')
+			}
+			b.WriteRune(unicode.ToLower(r))
+		case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			b.WriteRune(r)
+		default:
+			b.WriteRune('_')
+		}
+	}
+	return b.String()
+}
+
+// firstSentence returns the first sentence of a doc comment, on one line.
+func firstSentence(doc string) string {
+	doc = strings.Join(strings.Fields(doc), " ")
+	if i := strings.Index(doc, ". "); i >= 0 {
+		return doc[:i+1]
+	}
+	return doc
+}
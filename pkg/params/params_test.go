@@ -0,0 +1,218 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package params
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+
+	"github.com/GoogleCloudPlatform/gke-terraform-generator/pkg/api"
+)
+
+func TestVarLiteral(t *testing.T) {
+	var p *Parameters
+	version := "1.15"
+	var nilVersion *string
+	tags := []string{"a", "b"}
+	for _, test := range []struct {
+		value    interface{}
+		expected string
+	}{
+		{"n1-standard-1", `"n1-standard-1"`},
+		{"${x}", `"$${x}"`},
+		{&version, `"1.15"`},
+		{nilVersion, `""`},
+		{int32(100), "100"},
+		{api.NewBool(true), "true"},
+		{api.NewBool(false), "false"},
+		{&tags, "[\n  \"a\",\n  \"b\",\n]"},
+		{[]interface{}{"c"}, "[\n  \"c\",\n]"},
+		{[]string{}, "[]"},
+		{map[string]string{"b": "2", "a": "1"}, "{\n  a = \"1\"\n  b = \"2\"\n}"},
+		{map[string]string{"app.kubernetes.io/team": "infra"}, "{\n  \"app.kubernetes.io/team\" = \"infra\"\n}"},
+		{map[string]interface{}{}, "{}"},
+	} {
+		actual, err := p.Var("spec.version", test.value)
+		if err != nil {
+			t.Fatalf("%#v: %v", test.value, err)
+		}
+		if actual != test.expected {
+			t.Errorf("%#v: expected %q, got %q", test.value, test.expected, actual)
+		}
+	}
+}
+
+func TestVar(t *testing.T) {
+	p, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		path     string
+		value    interface{}
+		scope    []string
+		expected string
+	}{
+		{"spec.addons.hpa", api.NewBool(true), nil, "var.addons_hpa"},
+		{"spec.addons.hpa", api.NewBool(true), nil, "var.addons_hpa"},
+		{"spec.version", "latest", nil, "var.cluster_version"},
+		{"spec.network.spec.masterIPV4CIDRBlock", "172.16.0.16/28", nil, "var.network_master_ipv4_cidr_block"},
+		{"spec.nodePools.spec.diskSizeGB", 100, []string{"my-pool"}, "var.node_pools_my_pool_disk_size_gb"},
+		{"spec.nodePools.spec.diskSizeGB", 50, []string{"other"}, "var.node_pools_other_disk_size_gb"},
+	} {
+		actual, err := p.Var(test.path, test.value, test.scope...)
+		if err != nil {
+			t.Fatalf("%s: %v", test.path, err)
+		}
+		if actual != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.path, test.expected, actual)
+		}
+	}
+
+	variables := p.Variables()
+	if len(variables) != 5 {
+		t.Fatalf("expected 5 variables, got %d", len(variables))
+	}
+	pool := variables[3]
+	if pool.Path != "spec.nodePools[my-pool].spec.diskSizeGB" {
+		t.Errorf("expected the path to be scoped to the node pool, got %s", pool.Path)
+	}
+	if !strings.HasPrefix(pool.Description, "spec.nodePools[my-pool].spec.diskSizeGB: ") {
+		t.Errorf("expected the description to start with the path, got %q", pool.Description)
+	}
+}
+
+func TestVarErrors(t *testing.T) {
+	p, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Var("spec.addons.hpa", api.NewBool(true)); err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		name  string
+		path  string
+		value interface{}
+		scope []string
+	}{
+		{"unknown field", "spec.nope", "x", nil},
+		{"missing scope", "spec.nodePools.spec.diskSizeGB", 100, nil},
+		{"extra scope", "spec.addons.hpa", api.NewBool(true), []string{"default"}},
+		{"two values", "spec.addons.hpa", api.NewBool(false), nil},
+		{"unsupported value", "spec.network.spec.existing", &api.ExistingNetworkSpec{}, nil},
+	} {
+		if _, err := p.Var(test.path, test.value, test.scope...); err == nil {
+			t.Errorf("%s: expected an error", test.name)
+		}
+	}
+
+	// two paths with the same name
+	if _, err := p.Var("spec.nodePools.spec.machineType", "n1-standard-1", "a_b"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Var("spec.nodePools.spec.machineType", "n1-standard-1", "a-b"); err == nil {
+		t.Error("expected an error for two node pools whose variables have the same name")
+	}
+}
+
+func TestFiles(t *testing.T) {
+	p, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.TFVar("project_id", "my-project"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.TFVar("zones", []string{"us-east4-a"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.TFVar("not valid", "x"); err == nil {
+		t.Error("expected an error for a variable name that is not an identifier")
+	}
+	if _, err := p.Var("spec.nodePools.spec.labels", map[string]string{"cost center": "a"}, "default"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Var("spec.nodePools.spec.preemptible", api.NewBool(true), "default"); err != nil {
+		t.Fatal(err)
+	}
+
+	variables := parse(t, VariablesFileName, p.VariablesFile())
+	content, diags := variables.Content(&hcl.BodySchema{
+		Blocks: []hcl.BlockHeaderSchema{{Type: "variable", LabelNames: []string{"name"}}},
+	})
+	if diags.HasErrors() {
+		t.Fatal(diags)
+	}
+	types := map[string]string{}
+	for _, block := range content.Blocks {
+		attrs, diags := block.Body.JustAttributes()
+		if diags.HasErrors() {
+			t.Fatal(diags)
+		}
+		if _, ok := attrs["default"]; ok {
+			t.Errorf("expected %s to have no default", block.Labels[0])
+		}
+		types[block.Labels[0]] = hcl.ExprAsKeyword(attrs["type"].Expr)
+		if types[block.Labels[0]] == "" {
+			types[block.Labels[0]] = string(attrs["type"].Expr.Range().SliceBytes(p.VariablesFile()))
+		}
+	}
+	expected := map[string]string{
+		"node_pools_default_labels":      "map(string)",
+		"node_pools_default_preemptible": "bool",
+	}
+	for name, typ := range expected {
+		if types[name] != typ {
+			t.Errorf("expected %s to be a %s, got %q", name, typ, types[name])
+		}
+	}
+	if len(types) != len(expected) {
+		t.Errorf("expected only the variables of the fields, got %v", types)
+	}
+
+	tfvars := parse(t, TFVarsFileName, p.TFVarsFile())
+	attrs, diags := tfvars.JustAttributes()
+	if diags.HasErrors() {
+		t.Fatal(diags)
+	}
+	for _, name := range []string{"project_id", "zones", "node_pools_default_labels", "node_pools_default_preemptible"} {
+		if _, ok := attrs[name]; !ok {
+			t.Errorf("expected %s in the tfvars", name)
+		}
+	}
+	labels, diags := attrs["node_pools_default_labels"].Expr.Value(nil)
+	if diags.HasErrors() {
+		t.Fatal(diags)
+	}
+	if labels.GetAttr("cost center").AsString() != "a" {
+		t.Errorf("expected the labels in the tfvars, got %#v", labels)
+	}
+}
+
+// parse parses a file in the native syntax.
+func parse(t *testing.T, name string, b []byte) hcl.Body {
+	t.Helper()
+	f, diags := hclsyntax.ParseConfig(b, name, hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		t.Fatalf("%s is not valid HCL: %v\n%s", name, diags, b)
+	}
+	return f.Body
+}
@@ -0,0 +1,75 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package schema
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strings"
+)
+
+// docs holds the doc comments of the api types and of their fields.
+type docs struct {
+	// types maps a type name to its doc comment.
+	types map[string]string
+	// fields maps a type and field name, such as ClusterSpec.ProjectId, to its doc comment.
+	fields map[string]string
+}
+
+// parseDocs reads the doc comments of the types declared in the Go source of a file.
+func parseDocs(source string) (*docs, error) {
+	f, err := parser.ParseFile(token.NewFileSet(), "api.go", source, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &docs{types: map[string]string{}, fields: map[string]string{}}
+	for _, decl := range f.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			typeSpec := spec.(*ast.TypeSpec)
+			doc := typeSpec.Doc
+			if doc == nil && len(gen.Specs) == 1 {
+				doc = gen.Doc
+			}
+			d.types[typeSpec.Name.Name] = commentText(doc)
+
+			structType, ok := typeSpec.Type.(*ast.StructType)
+			if !ok {
+				continue
+			}
+			for _, field := range structType.Fields.List {
+				for _, name := range field.Names {
+					d.fields[typeSpec.Name.Name+"."+name.Name] = commentText(field.Doc)
+				}
+			}
+		}
+	}
+	return d, nil
+}
+
+// commentText returns the text of a comment without its comment markers, or an empty string.
+func commentText(comment *ast.CommentGroup) string {
+	if comment == nil {
+		return ""
+	}
+	return strings.TrimSpace(comment.Text())
+}
@@ -0,0 +1,188 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package schema
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/gke-terraform-generator/pkg/api"
+)
+
+// linkPattern matches the URLs in a doc comment.
+var linkPattern = regexp.MustCompile(`https?://[^\s)]+`)
+
+// indexPattern matches a list index in a path, such as the [0] of spec.nodePools[0].
+var indexPattern = regexp.MustCompile(`\[[0-9]*\]`)
+
+// Field documents a field of the GkeTF API.
+type Field struct {
+	// Name is the yaml key of the field.
+	Name string
+	// Path is the yaml path of the field without list indexes, such as
+	// spec.nodePools.spec.imageType.  The path of the document itself is empty.
+	Path string
+	// Type is the type of the field, such as string, []string or ClusterSpec.
+	Type string
+	// Required is true if the field must be set.
+	Required bool
+	// Description is the doc comment of the field, or of its type.
+	Description string
+	// Links are the URLs of the description.
+	Links []string
+	// Schema holds the default value and the constraints of the field.
+	Schema *Schema
+	// Fields are the fields of an object, or of the objects of a list or a map, sorted by name.
+	Fields []*Field
+}
+
+// Explain returns the documentation of the field at path, such as spec.nodePools.spec.imageType,
+// with its fields.  List indexes in the path, such as nodePools[0], are ignored.  An empty path
+// returns the document itself.
+func Explain(path string) (*Field, error) {
+	d, err := parseDocs(apiSource)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the api doc comments: %v", err)
+	}
+	g := newGenerator(d, "")
+	root, err := g.structSchema(reflect.TypeOf(api.GkeTF{}))
+	if err != nil {
+		return nil, err
+	}
+	root.Description = d.types["GkeTF"]
+
+	field := g.newField(api.ClusterKind, "", "GkeTF", root, false)
+	path = strings.Trim(indexPattern.ReplaceAllString(path, ""), ".")
+	if path == "" {
+		return field, nil
+	}
+	for _, name := range strings.Split(path, ".") {
+		var child *Field
+		for _, f := range field.Fields {
+			if f.Name == name {
+				child = f
+				break
+			}
+		}
+		if child == nil {
+			if field.Path == "" {
+				return nil, fmt.Errorf("field %q does not exist", name)
+			}
+			return nil, fmt.Errorf("field %q does not exist in %s", name, field.Path)
+		}
+		field = child
+	}
+	return field, nil
+}
+
+// newField documents a field whose schema is s.  The schemas of the definitions are referenced by
+// their type name.
+func (g *generator) newField(name, path, fieldType string, s *Schema, required bool) *Field {
+	field := &Field{
+		Name:        name,
+		Path:        path,
+		Type:        fieldType,
+		Required:    required,
+		Description: s.Description,
+		Schema:      s,
+	}
+
+	object := g.objectSchema(s)
+	if object == nil {
+		field.Links = links(field.Description)
+		return field
+	}
+	if field.Description == "" {
+		field.Description = object.Description
+	}
+	field.Links = links(field.Description)
+
+	keys := make([]string, 0, len(object.Properties))
+	for key := range object.Properties {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		property := object.Properties[key]
+		childPath := key
+		if path != "" {
+			childPath = path + "." + key
+		}
+		child := g.newField(key, childPath, typeName(property), property, contains(object.Required, key))
+		field.Fields = append(field.Fields, child)
+	}
+	return field
+}
+
+// objectSchema returns the schema of the object that s, or the items or values of s, refer to,
+// or nil if s does not hold objects.
+func (g *generator) objectSchema(s *Schema) *Schema {
+	switch {
+	case s.Ref != "":
+		return g.definitions[s.Ref]
+	case len(s.AllOf) == 1:
+		return g.objectSchema(s.AllOf[0])
+	case s.Items != nil:
+		return g.objectSchema(s.Items)
+	case s.Properties != nil:
+		return s
+	}
+	if values, ok := s.AdditionalProperties.(*Schema); ok {
+		return g.objectSchema(values)
+	}
+	return nil
+}
+
+// typeName returns the type of a value with schema s, as it is shown to a user.
+func typeName(s *Schema) string {
+	switch {
+	case s.Ref != "":
+		return s.Ref
+	case len(s.AllOf) == 1:
+		return typeName(s.AllOf[0])
+	case len(s.AnyOf) > 0:
+		// an api.Bool
+		return "boolean"
+	case s.Items != nil:
+		return "[]" + typeName(s.Items)
+	}
+	if values, ok := s.AdditionalProperties.(*Schema); ok {
+		return "map[string]" + typeName(values)
+	}
+	return s.Type
+}
+
+// links returns the URLs in a description.
+func links(description string) []string {
+	var urls []string
+	for _, url := range linkPattern.FindAllString(description, -1) {
+		urls = append(urls, strings.TrimRight(url, ".,"))
+	}
+	return urls
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
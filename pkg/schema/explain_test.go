@@ -0,0 +1,85 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package schema
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExplain(t *testing.T) {
+	tests := []struct {
+		path     string
+		name     string
+		typ      string
+		required bool
+		defaults interface{}
+		link     string
+	}{
+		{path: "", name: "gke-cluster", typ: "GkeTF"},
+		{path: "spec", name: "spec", typ: "ClusterSpec", required: true},
+		{path: "spec.nodePools.spec.imageType", name: "imageType", typ: "string", defaults: "COS"},
+		{path: "spec.nodePools[0].spec.gvisor", name: "gvisor", typ: "boolean", defaults: false},
+		{path: "spec.nodePools", name: "nodePools", typ: "[]GkeNodePool", required: true},
+		{path: "spec.labels", name: "labels", typ: "map[string]string"},
+		{path: "spec.tpu", name: "tpu", typ: "boolean", defaults: false, link: "https://cloud.google.com/tpu/docs/kubernetes-engine-setup"},
+	}
+	for _, test := range tests {
+		field, err := Explain(test.path)
+		if err != nil {
+			t.Errorf("%q: failed %v", test.path, err)
+			continue
+		}
+		if field.Name != test.name || field.Type != test.typ || field.Required != test.required {
+			t.Errorf("%q: expected %s %s required=%v, got %s %s required=%v", test.path, test.name, test.typ, test.required, field.Name, field.Type, field.Required)
+		}
+		if field.Schema.Default != test.defaults {
+			t.Errorf("%q: expected default %v, got %v", test.path, test.defaults, field.Schema.Default)
+		}
+		if test.link != "" && (len(field.Links) != 1 || field.Links[0] != test.link) {
+			t.Errorf("%q: expected link %s, got %v", test.path, test.link, field.Links)
+		}
+		if field.Description == "" {
+			t.Errorf("%q: expected a description", test.path)
+		}
+	}
+}
+
+func TestExplainFields(t *testing.T) {
+	field, err := Explain("spec.nodePools")
+	if err != nil {
+		t.Fatalf("failed %v", err)
+	}
+	var names []string
+	for _, f := range field.Fields {
+		names = append(names, f.Name)
+	}
+	if strings.Join(names, ",") != "apiVersion,kind,metadata,spec" {
+		t.Fatalf("expected the fields of a node pool, got %v", names)
+	}
+	if path := field.Fields[3].Fields[0].Path; !strings.HasPrefix(path, "spec.nodePools.spec.") {
+		t.Fatalf("unexpected path %s", path)
+	}
+}
+
+func TestExplainUnknownField(t *testing.T) {
+	if _, err := Explain("spec.nodePools.spec.imageTypo"); err == nil {
+		t.Fatal("expected an error")
+	} else if !strings.Contains(err.Error(), "spec.nodePools.spec") {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
@@ -0,0 +1,395 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package schema generates a JSON Schema or an OpenAPI v3 document for the GkeTF API.
+//
+// The schema is built from the api structs.  The yaml struct tags name the properties, the
+// doc comments of the api package become descriptions, the default tags become defaults and
+// the validate tags become enums, minimums, maximums, formats, patterns and required
+// properties, except for the fields that are set before the validation.
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/gke-terraform-generator/pkg/api"
+)
+
+const (
+	// JSONSchema is a JSON Schema draft-07 document.
+	JSONSchema = "jsonschema"
+	// OpenAPI is an OpenAPI v3 document, whose components hold the schemas.
+	OpenAPI = "openapi"
+)
+
+// filledFields are the fields, by type and field name, that the validation requires but that are
+// set before it runs, without a default tag: the project id by the -p flag, the addons by
+// api.SetApiDefaultValues and the spec of a node pool by the defaults of its fields.  They are
+// not required properties, since a configuration file may leave them out.
+var filledFields = map[string]bool{
+	"ClusterSpec.ProjectId": true,
+	"ClusterSpec.Addons":    true,
+	"GkeNodePool.Spec":      true,
+}
+
+// cidrPattern matches an IPv4 CIDR, such as 10.0.0.0/24.
+const cidrPattern = `^([0-9]{1,3}\.){3}[0-9]{1,3}/[0-9]{1,2}$`
+
+// Schema is a JSON Schema, which is also an OpenAPI v3 schema object.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Default              interface{}        `json:"default,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	Minimum              *int64             `json:"minimum,omitempty"`
+	Maximum              *int64             `json:"maximum,omitempty"`
+	MinLength            *int64             `json:"minLength,omitempty"`
+	MaxLength            *int64             `json:"maxLength,omitempty"`
+	MinItems             *int64             `json:"minItems,omitempty"`
+	MaxItems             *int64             `json:"maxItems,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties interface{}        `json:"additionalProperties,omitempty"`
+	AllOf                []*Schema          `json:"allOf,omitempty"`
+	AnyOf                []*Schema          `json:"anyOf,omitempty"`
+}
+
+// Generate returns the schema of api.GkeTF in format, encoded as indented JSON.
+func Generate(format string) ([]byte, error) {
+	d, err := parseDocs(apiSource)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the api doc comments: %v", err)
+	}
+
+	var document interface{}
+	switch format {
+	case JSONSchema:
+		g := newGenerator(d, "#/definitions/")
+		root, err := g.structSchema(reflect.TypeOf(api.GkeTF{}))
+		if err != nil {
+			return nil, err
+		}
+		root.Description = d.types["GkeTF"]
+		document = struct {
+			Version string `json:"$schema"`
+			Title   string `json:"title"`
+			*Schema
+			Definitions map[string]*Schema `json:"definitions"`
+		}{
+			Version:     "http://json-schema.org/draft-07/schema#",
+			Title:       "GkeTF " + api.HubVersion,
+			Schema:      root,
+			Definitions: g.definitions,
+		}
+	case OpenAPI:
+		g := newGenerator(d, "#/components/schemas/")
+		if _, err := g.typeSchema(reflect.TypeOf(api.GkeTF{})); err != nil {
+			return nil, err
+		}
+		document = map[string]interface{}{
+			"openapi": "3.0.0",
+			"info": map[string]string{
+				"title":   "gke-tf",
+				"version": api.HubVersion,
+			},
+			"paths": map[string]interface{}{},
+			"components": map[string]interface{}{
+				"schemas": g.definitions,
+			},
+		}
+	default:
+		return nil, fmt.Errorf("schema format %q is not supported, use %s or %s", format, JSONSchema, OpenAPI)
+	}
+
+	b, err := json.MarshalIndent(document, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
+
+// generator builds the schemas of Go types.  Named structs are added to the definitions once and
+// referenced by $ref.
+type generator struct {
+	docs        *docs
+	refPrefix   string
+	definitions map[string]*Schema
+}
+
+func newGenerator(d *docs, refPrefix string) *generator {
+	return &generator{docs: d, refPrefix: refPrefix, definitions: map[string]*Schema{}}
+}
+
+// typeSchema returns the schema of a value of type t.
+func (g *generator) typeSchema(t reflect.Type) (*Schema, error) {
+	if t == reflect.TypeOf(api.Unset) {
+		return boolSchema(), nil
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return g.typeSchema(t.Elem())
+	case reflect.String:
+		return &Schema{Type: "string"}, nil
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &Schema{Type: "integer"}, nil
+	case reflect.Slice:
+		items, err := g.typeSchema(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return &Schema{Type: "array", Items: items}, nil
+	case reflect.Map:
+		values, err := g.typeSchema(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return &Schema{Type: "object", AdditionalProperties: values}, nil
+	case reflect.Struct:
+		if _, ok := g.definitions[t.Name()]; !ok {
+			// reserve the name first, since a type may refer to itself
+			g.definitions[t.Name()] = nil
+			definition, err := g.structSchema(t)
+			if err != nil {
+				return nil, err
+			}
+			definition.Description = g.docs.types[t.Name()]
+			g.definitions[t.Name()] = definition
+		}
+		return &Schema{Ref: g.refPrefix + t.Name()}, nil
+	}
+	return nil, fmt.Errorf("type %s is not supported", t)
+}
+
+// structSchema returns the object schema of a struct.  Since configuration files are decoded
+// strictly, no other properties are allowed.
+func (g *generator) structSchema(t reflect.Type) (*Schema, error) {
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}, AdditionalProperties: false}
+	if err := g.addProperties(s, t); err != nil {
+		return nil, err
+	}
+	sort.Strings(s.Required)
+	return s, nil
+}
+
+// addProperties adds the fields of t, and of the structs that t inlines, to s.
+func (g *generator) addProperties(s *Schema, t reflect.Type) error {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, inline := yamlName(field)
+		if name == "-" || field.PkgPath != "" {
+			continue
+		}
+		if inline {
+			if err := g.addProperties(s, field.Type); err != nil {
+				return err
+			}
+			continue
+		}
+
+		property, required, err := g.fieldSchema(t, field)
+		if err != nil {
+			return fmt.Errorf("%s.%s: %v", t.Name(), field.Name, err)
+		}
+		s.Properties[name] = property
+		if required {
+			s.Required = append(s.Required, name)
+		}
+	}
+	return nil
+}
+
+// fieldSchema returns the schema of a struct field, and whether the field is required.
+func (g *generator) fieldSchema(owner reflect.Type, field reflect.StructField) (*Schema, bool, error) {
+	s, err := g.typeSchema(field.Type)
+	if err != nil {
+		return nil, false, err
+	}
+
+	elem := field.Type
+	for elem.Kind() == reflect.Ptr {
+		elem = elem.Elem()
+	}
+
+	// a field that gets a value before the validation is not required in the file
+	var required bool
+	rules, itemRules := splitRules(field.Tag.Get("validate"))
+	_, hasDefault := field.Tag.Lookup("default")
+	for _, rule := range rules {
+		if rule == "required" && !hasDefault && !filledFields[owner.Name()+"."+field.Name] {
+			required = true
+		}
+	}
+
+	description := g.docs.fields[owner.Name()+"."+field.Name]
+	if s.Ref != "" {
+		// $ref replaces its siblings, so the description is added around it
+		if description == "" {
+			return s, required, nil
+		}
+		return &Schema{Description: description, AllOf: []*Schema{s}}, required, nil
+	}
+
+	s.Description = description
+	if err := applyRules(s, elem, rules); err != nil {
+		return nil, false, err
+	}
+	if s.Items != nil && s.Items.Ref == "" {
+		if err := applyRules(s.Items, elem.Elem(), itemRules); err != nil {
+			return nil, false, err
+		}
+	}
+	if value, ok := field.Tag.Lookup("default"); ok {
+		if s.Default, err = defaultValue(elem, value); err != nil {
+			return nil, false, fmt.Errorf("default %q: %v", value, err)
+		}
+	}
+	return s, required, nil
+}
+
+// boolSchema is the schema of an api.Bool, which also accepts the strings that api.ParseBool
+// accepts.
+func boolSchema() *Schema {
+	return &Schema{AnyOf: []*Schema{
+		{Type: "boolean"},
+		{Type: "string", Enum: []interface{}{"true", "false", "yes", "no", "on", "off"}},
+	}}
+}
+
+// yamlName returns the name of a field in YAML, and whether it is inlined.
+func yamlName(field reflect.StructField) (string, bool) {
+	tag := strings.Split(field.Tag.Get("yaml"), ",")
+	for _, option := range tag[1:] {
+		if option == "inline" {
+			return "", true
+		}
+	}
+	if tag[0] == "" {
+		return strings.ToLower(field.Name), false
+	}
+	return tag[0], false
+}
+
+// splitRules splits a validate tag into the rules of the field and the rules that apply to the
+// items of a list, which follow dive.
+func splitRules(tag string) ([]string, []string) {
+	if tag == "" {
+		return nil, nil
+	}
+	rules := strings.Split(tag, ",")
+	for i, rule := range rules {
+		if rule == "dive" {
+			return rules[:i], rules[i+1:]
+		}
+	}
+	return rules, nil
+}
+
+// applyRules adds the constraints of validate rules to the schema of a value of type t.  Rules
+// that have no equivalent in a schema, such as ltefield, are skipped.
+func applyRules(s *Schema, t reflect.Type, rules []string) error {
+	for _, rule := range rules {
+		if strings.HasPrefix(rule, "eq=") {
+			for _, alternative := range strings.Split(rule, "|") {
+				value, err := parseValue(t, strings.TrimPrefix(alternative, "eq="))
+				if err != nil {
+					return err
+				}
+				s.Enum = append(s.Enum, value)
+			}
+			continue
+		}
+
+		name, param := rule, ""
+		if i := strings.Index(rule, "="); i >= 0 {
+			name, param = rule[:i], rule[i+1:]
+		}
+		switch name {
+		case "cidrv4":
+			s.Pattern = cidrPattern
+		case "ipv4", "email":
+			s.Format = name
+		case "gt", "gte", "lt", "lte":
+			n, err := strconv.ParseInt(param, 10, 64)
+			if err != nil {
+				return fmt.Errorf("rule %s: %v", rule, err)
+			}
+			switch name {
+			case "gt":
+				n++
+			case "lt":
+				n--
+			}
+			setBound(s, strings.HasPrefix(name, "g"), n)
+		}
+	}
+	return nil
+}
+
+// setBound sets the minimum or maximum of a number, the length of a string or the number of
+// items of a list.
+func setBound(s *Schema, minimum bool, n int64) {
+	switch {
+	case s.Type == "string" && minimum:
+		s.MinLength = &n
+	case s.Type == "string":
+		s.MaxLength = &n
+	case s.Type == "array" && minimum:
+		s.MinItems = &n
+	case s.Type == "array":
+		s.MaxItems = &n
+	case minimum:
+		s.Minimum = &n
+	default:
+		s.Maximum = &n
+	}
+}
+
+// defaultValue parses the default tag of a field of type t.
+func defaultValue(t reflect.Type, value string) (interface{}, error) {
+	if t.Kind() == reflect.Slice || t.Kind() == reflect.Map {
+		var v interface{}
+		err := json.Unmarshal([]byte(value), &v)
+		return v, err
+	}
+	return parseValue(t, value)
+}
+
+// parseValue parses a value of type t from a struct tag.
+func parseValue(t reflect.Type, value string) (interface{}, error) {
+	if t == reflect.TypeOf(api.Unset) {
+		b, err := api.ParseBool(value)
+		return b.IsTrue(), err
+	}
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.ParseInt(value, 10, 64)
+	case reflect.Bool:
+		return strconv.ParseBool(value)
+	}
+	return value, nil
+}
@@ -0,0 +1,315 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/GoogleCloudPlatform/gke-terraform-generator/pkg/api"
+)
+
+// schemaFile is the JSON Schema that editors use, which must match the api types.
+const schemaFile = "gke-tf.schema.json"
+
+func generate(t *testing.T, format string) map[string]interface{} {
+	b, err := Generate(format)
+	if err != nil {
+		t.Fatalf("failed %v", err)
+	}
+	var document map[string]interface{}
+	if err := json.Unmarshal(b, &document); err != nil {
+		t.Fatalf("failed %v", err)
+	}
+	return document
+}
+
+func TestSchemaFileIsUpToDate(t *testing.T) {
+	b, err := Generate(JSONSchema)
+	if err != nil {
+		t.Fatalf("failed %v", err)
+	}
+	expected, err := ioutil.ReadFile(schemaFile)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if string(b) != string(expected) {
+		t.Fatalf("%s does not match the api types, run: gke-tf schema > pkg/schema/%s", schemaFile, schemaFile)
+	}
+}
+
+// TestSchemaCoversFields walks the api types and checks that every field has a property.
+func TestSchemaCoversFields(t *testing.T) {
+	definitions := generate(t, JSONSchema)["definitions"].(map[string]interface{})
+
+	seen := map[reflect.Type]bool{}
+	var walk func(typ reflect.Type)
+	walk = func(typ reflect.Type) {
+		for typ.Kind() == reflect.Ptr || typ.Kind() == reflect.Slice || typ.Kind() == reflect.Map {
+			typ = typ.Elem()
+		}
+		if typ.Kind() != reflect.Struct || seen[typ] {
+			return
+		}
+		seen[typ] = true
+
+		var properties map[string]interface{}
+		if typ.Name() != "GkeTF" {
+			definition, ok := definitions[typ.Name()].(map[string]interface{})
+			if !ok {
+				t.Errorf("%s has no definition", typ.Name())
+				return
+			}
+			properties = definition["properties"].(map[string]interface{})
+		}
+
+		for i := 0; i < typ.NumField(); i++ {
+			field := typ.Field(i)
+			name, inline := yamlName(field)
+			if !inline && properties != nil {
+				if _, ok := properties[name]; !ok {
+					t.Errorf("%s.%s has no property %s", typ.Name(), field.Name, name)
+				}
+			}
+			if !inline {
+				walk(field.Type)
+			}
+		}
+	}
+	walk(reflect.TypeOf(api.GkeTF{}))
+}
+
+func TestSchemaRules(t *testing.T) {
+	definitions := generate(t, JSONSchema)["definitions"].(map[string]interface{})
+	property := func(definition, name string) map[string]interface{} {
+		properties := definitions[definition].(map[string]interface{})["properties"].(map[string]interface{})
+		return properties[name].(map[string]interface{})
+	}
+
+	diskType := property("NodePoolSpec", "diskType")
+	if !reflect.DeepEqual(diskType["enum"], []interface{}{"pd-ssd", "pd-standard"}) || diskType["default"] != "pd-ssd" {
+		t.Errorf("unexpected diskType %v", diskType)
+	}
+	if !strings.HasPrefix(diskType["description"].(string), "DiskType is the node disk type.") {
+		t.Errorf("unexpected description %v", diskType["description"])
+	}
+
+	maxPods := property("ClusterSpec", "defaultMaxPodsPerNode")
+	if maxPods["minimum"] != 8.0 || maxPods["maximum"] != 110.0 || maxPods["default"] != 110.0 {
+		t.Errorf("unexpected defaultMaxPodsPerNode %v", maxPods)
+	}
+
+	if property("AddonsSpec", "istio")["default"] != true {
+		t.Error("the Bool default is not a boolean")
+	}
+
+	if property("NetworkSpec", "subnetRange")["pattern"] != cidrPattern {
+		t.Error("subnetRange has no CIDR pattern")
+	}
+
+	dnsServers := property("StubDomainsSpec", "dnsServerIPAddresses")
+	if dnsServers["items"].(map[string]interface{})["format"] != "ipv4" {
+		t.Errorf("the rules after dive do not apply to the items %v", dnsServers)
+	}
+
+	required := definitions["ClusterSpec"].(map[string]interface{})["required"]
+	if !reflect.DeepEqual(required, []interface{}{"network", "nodePools", "region"}) {
+		t.Errorf("unexpected required properties %v", required)
+	}
+}
+
+// TestSchemaAcceptsExamples checks every example configuration against the schema, which must
+// accept what gke-tf accepts.
+func TestSchemaAcceptsExamples(t *testing.T) {
+	b, err := ioutil.ReadFile(schemaFile)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	var root map[string]interface{}
+	if err := json.Unmarshal(b, &root); err != nil {
+		t.Fatalf("failed %v", err)
+	}
+
+	files, err := filepath.Glob("../../examples/*.yaml")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no examples: %v", err)
+	}
+	for _, file := range files {
+		source, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		var document interface{}
+		if err := yaml.Unmarshal(source, &document); err != nil {
+			t.Fatalf("%s: %v", file, err)
+		}
+		// the document is compared as JSON, as an editor does
+		j, err := json.Marshal(document)
+		if err != nil {
+			t.Fatalf("%s: %v", file, err)
+		}
+		var value interface{}
+		if err := json.Unmarshal(j, &value); err != nil {
+			t.Fatalf("%s: %v", file, err)
+		}
+		for _, message := range validateSchema(root, root, value, "") {
+			t.Errorf("%s: %s", file, message)
+		}
+	}
+}
+
+// validateSchema returns the reasons that value does not match the schema s, for the keywords
+// that Generate writes.  Definitions are resolved in root.
+func validateSchema(root, s map[string]interface{}, value interface{}, path string) []string {
+	if ref, ok := s["$ref"].(string); ok {
+		name := strings.TrimPrefix(ref, "#/definitions/")
+		return validateSchema(root, root["definitions"].(map[string]interface{})[name].(map[string]interface{}), value, path)
+	}
+	fail := func(format string, args ...interface{}) []string {
+		return []string{fmt.Sprintf("%s: %s", path, fmt.Sprintf(format, args...))}
+	}
+
+	var messages []string
+	if all, ok := s["allOf"].([]interface{}); ok {
+		for _, sub := range all {
+			messages = append(messages, validateSchema(root, sub.(map[string]interface{}), value, path)...)
+		}
+	}
+	if any, ok := s["anyOf"].([]interface{}); ok {
+		matched := false
+		for _, sub := range any {
+			if len(validateSchema(root, sub.(map[string]interface{}), value, path)) == 0 {
+				matched = true
+			}
+		}
+		if !matched {
+			messages = append(messages, fail("%v matches none of anyOf", value)...)
+		}
+	}
+	if enum, ok := s["enum"].([]interface{}); ok {
+		found := false
+		for _, e := range enum {
+			if reflect.DeepEqual(e, value) {
+				found = true
+			}
+		}
+		if !found {
+			messages = append(messages, fail("%v is not one of %v", value, enum)...)
+		}
+	}
+
+	switch s["type"] {
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return fail("%v is not an object", value)
+		}
+		for _, name := range asStrings(s["required"]) {
+			if _, ok := object[name]; !ok {
+				messages = append(messages, fail("%s is required", name)...)
+			}
+		}
+		properties, _ := s["properties"].(map[string]interface{})
+		for name, v := range object {
+			if property, ok := properties[name].(map[string]interface{}); ok {
+				messages = append(messages, validateSchema(root, property, v, path+"."+name)...)
+			} else if additional, ok := s["additionalProperties"].(map[string]interface{}); ok {
+				messages = append(messages, validateSchema(root, additional, v, path+"."+name)...)
+			} else if s["additionalProperties"] == false {
+				messages = append(messages, fail("%s is not allowed", name)...)
+			}
+		}
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			return fail("%v is not an array", value)
+		}
+		if schema, ok := s["items"].(map[string]interface{}); ok {
+			for i, item := range items {
+				messages = append(messages, validateSchema(root, schema, item, fmt.Sprintf("%s[%d]", path, i))...)
+			}
+		}
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			return fail("%v is not a string", value)
+		}
+		if pattern, ok := s["pattern"].(string); ok && !regexp.MustCompile(pattern).MatchString(str) {
+			messages = append(messages, fail("%q does not match %s", str, pattern)...)
+		}
+		if s["format"] == "ipv4" && net.ParseIP(str).To4() == nil {
+			messages = append(messages, fail("%q is not an ipv4 address", str)...)
+		}
+	case "integer", "number":
+		n, ok := value.(float64)
+		if !ok || s["type"] == "integer" && n != math.Trunc(n) {
+			return fail("%v is not an %s", value, s["type"])
+		}
+		if minimum, ok := s["minimum"].(float64); ok && n < minimum {
+			messages = append(messages, fail("%v is less than %v", n, minimum)...)
+		}
+		if maximum, ok := s["maximum"].(float64); ok && n > maximum {
+			messages = append(messages, fail("%v is more than %v", n, maximum)...)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fail("%v is not a boolean", value)
+		}
+	}
+	return messages
+}
+
+// asStrings returns the strings of a JSON list.
+func asStrings(v interface{}) []string {
+	var strs []string
+	list, _ := v.([]interface{})
+	for _, item := range list {
+		strs = append(strs, item.(string))
+	}
+	return strs
+}
+
+func TestOpenAPI(t *testing.T) {
+	document := generate(t, OpenAPI)
+	if document["openapi"] != "3.0.0" {
+		t.Fatalf("unexpected openapi version %v", document["openapi"])
+	}
+	schemas := document["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+	gkeTF, ok := schemas["GkeTF"].(map[string]interface{})
+	if !ok {
+		t.Fatal("GkeTF is missing from the components")
+	}
+	spec := gkeTF["properties"].(map[string]interface{})["spec"].(map[string]interface{})
+	ref := spec["allOf"].([]interface{})[0].(map[string]interface{})["$ref"]
+	if ref != "#/components/schemas/ClusterSpec" {
+		t.Fatalf("unexpected $ref %v", ref)
+	}
+
+	if _, err := Generate("xml"); err == nil {
+		t.Fatal("xml should not be supported")
+	}
+}
@@ -0,0 +1,189 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package templates
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+	"k8s.io/klog"
+)
+
+const (
+	// ManifestFileName is the name of the optional manifest of a template directory.
+	ManifestFileName = "manifest.yaml"
+	// TemplateSuffix ends the name of a template, which renders the file named by the rest of
+	// it: main.tf.tmpl renders main.tf.
+	TemplateSuffix = ".tmpl"
+	// PartialPrefix starts the name of a template that is a partial, such as _helpers.tmpl,
+	// which renders no file but defines named templates for the others.
+	PartialPrefix = "_"
+)
+
+// Manifest describes the files that a template directory renders.
+type Manifest struct {
+	// Name is the name of the terraform type that RegisterDir registers.  It defaults to the
+	// name of the base type and the directory, such as "Vanilla from ./templates".
+	Name string `yaml:"name"`
+	// Files are the names of the files that are rendered, such as main.tf, in order.  Each
+	// is rendered from the template of the directory named after it, such as main.tf.tmpl, or
+	// else from the template of the base type for the same file.  Without a manifest, every
+	// file of the base type and every template of the directory is rendered.
+	Files []string `yaml:"files"`
+}
+
+// ReadManifest reads the manifest of a template directory.  A directory without a manifest has
+// an empty one.
+func ReadManifest(dir string) (*Manifest, error) {
+	manifest := &Manifest{}
+	b, err := ioutil.ReadFile(filepath.Join(dir, ManifestFileName))
+	if os.IsNotExist(err) {
+		return manifest, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.UnmarshalStrict(b, manifest); err != nil {
+		return nil, fmt.Errorf("%s: %v", filepath.Join(dir, ManifestFileName), err)
+	}
+	return manifest, nil
+}
+
+// LoadDir returns the templates of base with those of a directory, which override the templates
+// of base that render the same files.  The files that are rendered are listed by the manifest of
+// the directory, if it has one.  The templates of the directory are executed with the same
+// *api.GkeTF, FuncMap and partials as the embedded ones, and the partials of the directory are
+// added to those of base, in the order of their names.  The ignored fields, the versions of
+// terraform and the syntaxes that are supported are those of base.
+func LoadDir(dir string, base *GKETemplates) (*GKETemplates, error) {
+	manifest, err := ReadManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	// the templates of the directory, by the name of the file that they render
+	overrides := map[string]string{}
+	var added []string
+	// the partials of base, then those of the directory, which ReadDir sorts by name
+	partials := append([]string{}, base.Partials...)
+	for _, info := range infos {
+		if info.IsDir() || !strings.HasSuffix(info.Name(), TemplateSuffix) {
+			continue
+		}
+		b, err := ioutil.ReadFile(filepath.Join(dir, info.Name()))
+		if err != nil {
+			return nil, err
+		}
+		if strings.HasPrefix(info.Name(), PartialPrefix) {
+			partials = append(partials, string(b))
+			continue
+		}
+		fileName := strings.TrimSuffix(info.Name(), TemplateSuffix)
+		overrides[fileName] = string(b)
+		if base.template(fileName) == nil {
+			added = append(added, fileName)
+		}
+	}
+	sort.Strings(added)
+
+	fileNames := manifest.Files
+	if len(fileNames) == 0 {
+		for _, t := range base.Templates {
+			fileNames = append(fileNames, t.FileName)
+		}
+		fileNames = append(fileNames, added...)
+	}
+
+	gkeTemplates := &GKETemplates{
+		IgnoredFields: base.IgnoredFields,
+		Terraform:     base.Terraform,
+		LegacySyntax:  base.LegacySyntax,
+		Partials:      partials,
+	}
+	seen := map[string]bool{}
+	for _, fileName := range fileNames {
+		if seen[fileName] {
+			return nil, fmt.Errorf("%s: %s is listed twice", filepath.Join(dir, ManifestFileName), fileName)
+		}
+		seen[fileName] = true
+		if goTemplate, ok := overrides[fileName]; ok {
+			gkeTemplates.Templates = append(gkeTemplates.Templates, &TerraformTemplate{fileName, goTemplate})
+			continue
+		}
+		t := base.template(fileName)
+		if t == nil {
+			return nil, fmt.Errorf("%s: %s has no template, %s is not in the directory", filepath.Join(dir, ManifestFileName), fileName, fileName+TemplateSuffix)
+		}
+		gkeTemplates.Templates = append(gkeTemplates.Templates, &TerraformTemplate{t.FileName, t.GoTemplate})
+	}
+	for fileName := range overrides {
+		if !seen[fileName] {
+			klog.Warningf("%s is not rendered, %s is not in the files of the manifest", filepath.Join(dir, fileName+TemplateSuffix), fileName)
+		}
+	}
+	return gkeTemplates, nil
+}
+
+// RegisterDir registers the templates of a directory, loaded by LoadDir with the templates of
+// base, as a terraform type and returns it.  The directory is loaded once to check it, and again
+// by each call to NewGKETemplates.
+func RegisterDir(dir string, base TFType) (TFType, error) {
+	baseTemplates, err := NewGKETemplates(base)
+	if err != nil {
+		return 0, err
+	}
+	if len(baseTemplates.Templates) == 0 {
+		return 0, fmt.Errorf("the %s terraform type has no templates", base.Name())
+	}
+	manifest, err := ReadManifest(dir)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := LoadDir(dir, baseTemplates); err != nil {
+		return 0, err
+	}
+	name := manifest.Name
+	if name == "" {
+		name = fmt.Sprintf("%s from %s", base.Name(), dir)
+	}
+	return Register(name, func() (*GKETemplates, error) {
+		baseTemplates, err := NewGKETemplates(base)
+		if err != nil {
+			return nil, err
+		}
+		return LoadDir(dir, baseTemplates)
+	})
+}
+
+// template returns the template of a file, or nil if there is none.
+func (gkeTemplates *GKETemplates) template(fileName string) *TerraformTemplate {
+	for _, t := range gkeTemplates.Templates {
+		if t.FileName == fileName {
+			return t
+		}
+	}
+	return nil
+}
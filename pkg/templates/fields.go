@@ -0,0 +1,124 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package templates
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/gke-terraform-generator/pkg/api"
+)
+
+// indexPattern matches a list index in a path, such as the [0] of spec.nodePools[0].
+var indexPattern = regexp.MustCompile(`\[[0-9]*\]`)
+
+// cftIgnoredFields are the api fields that the CFT module does not expose, or that the CFT
+// templates leave commented out.
+var cftIgnoredFields = []string{
+	"spec.addons.binaryAuth",
+	"spec.addons.cloudrun",
+	"spec.addons.clusterAutoscaling",
+	"spec.addons.istio",
+	"spec.addons.logging",
+	"spec.addons.monitoring",
+	"spec.addons.podSecurityPolicy",
+	"spec.addons.vpa",
+	"spec.alpha",
+	"spec.bastion",
+	"spec.defaultMaxPodsPerNode",
+	"spec.intraNodeVisibility",
+	"spec.metadata",
+	"spec.nodePools.spec.acceleratorCount",
+	"spec.nodePools.spec.gvisor",
+	"spec.nodePools.spec.localSSDCount",
+	"spec.nodePools.spec.maxPodsPerNode",
+	"spec.nodePools.spec.metadata",
+	"spec.nodePools.spec.minCpuPlatform",
+	"spec.nodePools.spec.serviceAccount",
+	"spec.nodePools.spec.version",
+	"spec.nodePools.spec.workloadMetadataConfig",
+	"spec.resourceUsageExportConfig",
+	"spec.tpu",
+	"spec.workloadIdentityConfig",
+}
+
+// vanillaIgnoredFields are the api fields that the Vanilla templates do not use.  The Vanilla
+// templates always create a service account for the cluster.
+var vanillaIgnoredFields = []string{
+	"spec.addons.clusterAutoscaling",
+	"spec.addons.httpLoadBalancing",
+	"spec.deployUsingPrivateEndpoint",
+	"spec.description",
+	"spec.ipMasqLinkLocal",
+	"spec.ipMasqRsyncInterval",
+	"spec.metadata",
+	"spec.nodePools.spec.metadata",
+	"spec.nodeVersion",
+	"spec.serviceAccount",
+	"spec.stubDomains",
+}
+
+// builderIgnoredFields are the api fields that the builder package does not use, which are
+// those of the Vanilla templates that it replaces.
+var builderIgnoredFields = vanillaIgnoredFields
+
+// Supports returns false if the templates ignore the api field at path, or one of its parents.
+// The path is the yaml path of the field, such as spec.nodePools[0].spec.gvisor, and list
+// indexes are ignored.
+func (gkeTemplates *GKETemplates) Supports(path string) bool {
+	return gkeTemplates.ignoredField(path) == ""
+}
+
+// IgnoredSetFields returns the yaml paths of the fields of gkeTF that are set to a value other
+// than their default, but that the templates ignore.  When the templates ignore a whole object
+// or list, such as spec.stubDomains, its path is returned instead of those of its fields.
+func (gkeTemplates *GKETemplates) IgnoredSetFields(gkeTF *api.GkeTF) ([]string, error) {
+	paths, err := api.SetFields(gkeTF)
+	if err != nil {
+		return nil, err
+	}
+	var ignored []string
+	seen := map[string]bool{}
+	for _, path := range paths {
+		field := gkeTemplates.ignoredField(path)
+		if field == "" {
+			continue
+		}
+		// keep the list indexes of the parents of the ignored field
+		segments := strings.Split(path, ".")
+		path = strings.Join(segments[:strings.Count(field, ".")+1], ".")
+		if strings.HasSuffix(path, "]") {
+			path = path[:strings.LastIndex(path, "[")]
+		}
+		if !seen[path] {
+			seen[path] = true
+			ignored = append(ignored, path)
+		}
+	}
+	return ignored, nil
+}
+
+// ignoredField returns the entry of IgnoredFields that matches path, or an empty string.
+func (gkeTemplates *GKETemplates) ignoredField(path string) string {
+	path = indexPattern.ReplaceAllString(path, "")
+	for _, ignored := range gkeTemplates.IgnoredFields {
+		if path == ignored || strings.HasPrefix(path, ignored+".") {
+			return ignored
+		}
+	}
+	return ""
+}
@@ -0,0 +1,348 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package templates
+
+import (
+	"fmt"
+	"math/big"
+	"net"
+	"reflect"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+
+	"github.com/GoogleCloudPlatform/gke-terraform-generator/pkg/params"
+)
+
+// maxGCPNameLength is the maximum length of the name of most GCP resources.
+const maxGCPNameLength = 63
+
+// FuncMap returns the functions that the templates can call, along with those of text/template.
+// Functions that take a list or a map also take a pointer to one, as the api fields are, and
+// treat a nil pointer as empty.
+//
+// HCL:
+//
+//	HCLString  quotes a string as an HCL string literal, escaping the ${ and %{ sequences
+//	HCLKey     returns a map key as is if it is an identifier, or else quoted
+//	HCLList    renders a list of strings as an HCL list, ["a", "b"]
+//	HCLMap     renders a map of strings as an HCL object, {a = "b"}, sorted by key
+//	HCLNot     negates an HCL bool expression, such as true or var.addons_hpa
+//
+// Terraform versions, see Target:
+//
+//	Terraform  returns the Target of the cluster, the versions of terraform and of the providers
+//	Expr       renders an expression in the syntax of the target, "${var.region}" for 0.11
+//	Ref        renders a reference in the syntax of the target, such as a provider, "google-beta" for 0.11
+//
+// Parameters, see the params package:
+//
+//	Var    renders the value of a field, or a reference to its variable with --parameterize
+//	TFVar  renders the default of a variable of the templates, which is also a tfvars value
+//
+// Lists and maps:
+//
+//	StringsJoin  joins strings with a separator, as strings.Join
+//	Concat       concatenates lists
+//	Merge        merges maps, the values of the later maps win
+//
+// Defaults:
+//
+//	Default   returns its second argument, or the first if the second is empty
+//	Coalesce  returns the first argument that is not empty
+//
+// CIDR math, as the terraform functions of the same names:
+//
+//	CIDRHost     returns the address of a host number in a range
+//	CIDRNetmask  returns the netmask of an IPv4 range, 255.255.255.0
+//	CIDRSubnet   returns a subnet of a range, by the bits it adds and its number
+//
+// Names:
+//
+//	ResourceName  returns a string as a terraform resource name
+//	GCPName       returns a string as a GCP resource name, lower case and at most 63 characters
+func FuncMap() template.FuncMap {
+	return template.FuncMap{
+		"HCLString":    HCLString,
+		"HCLKey":       HCLKey,
+		"HCLList":      HCLList,
+		"HCLMap":       HCLMap,
+		"HCLNot":       HCLNot,
+		"Terraform":    func() *Target { return nil },
+		"Expr":         (*Target)(nil).Expr,
+		"Ref":          (*Target)(nil).Ref,
+		"Var":          (*params.Parameters)(nil).Var,
+		"TFVar":        (*params.Parameters)(nil).TFVar,
+		"StringsJoin":  strings.Join,
+		"Concat":       Concat,
+		"Merge":        Merge,
+		"Default":      Default,
+		"Coalesce":     Coalesce,
+		"CIDRHost":     CIDRHost,
+		"CIDRNetmask":  CIDRNetmask,
+		"CIDRSubnet":   CIDRSubnet,
+		"ResourceName": ResourceName,
+		"GCPName":      GCPName,
+	}
+}
+
+// HCLString returns s as a quoted HCL string literal.  Quotes, backslashes and control characters
+// are escaped, and so are the ${ and %{ sequences, so that terraform does not interpolate them.
+func HCLString(s string) string {
+	return string(hclwrite.TokensForValue(cty.StringVal(s)).Bytes())
+}
+
+// HCLKey returns the key of an HCL object, which is s if it is an identifier, or else s quoted.
+func HCLKey(s string) string {
+	if hclsyntax.ValidIdentifier(s) {
+		return s
+	}
+	return HCLString(s)
+}
+
+// HCLList returns a list of strings, or a pointer to one, as an HCL list of string literals.
+func HCLList(list interface{}) (string, error) {
+	v := indirect(list)
+	if v.IsValid() && v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return "", fmt.Errorf("HCLList: %T is not a list", list)
+	}
+	var values []string
+	for i := 0; v.IsValid() && i < v.Len(); i++ {
+		values = append(values, HCLString(fmt.Sprint(v.Index(i).Interface())))
+	}
+	return "[" + strings.Join(values, ", ") + "]", nil
+}
+
+// HCLMap returns a map of strings, or a pointer to one, as an HCL object, sorted by key.
+func HCLMap(m interface{}) (string, error) {
+	v := indirect(m)
+	if v.IsValid() && v.Kind() != reflect.Map {
+		return "", fmt.Errorf("HCLMap: %T is not a map", m)
+	}
+	var entries []string
+	if v.IsValid() {
+		for _, key := range v.MapKeys() {
+			entries = append(entries, HCLKey(fmt.Sprint(key.Interface()))+" = "+HCLString(fmt.Sprint(v.MapIndex(key).Interface())))
+		}
+	}
+	sort.Strings(entries)
+	return "{" + strings.Join(entries, ", ") + "}", nil
+}
+
+// HCLNot returns the negation of an HCL bool expression: false for true, true for false, or else
+// the expression after !, such as !var.addons_hpa, or "${!var.addons_hpa}" in the syntax of
+// terraform 0.11.
+func HCLNot(expr string) string {
+	switch expr {
+	case "true":
+		return "false"
+	case "false":
+		return "true"
+	}
+	if interpolation, ok := interpolated(expr); ok {
+		return `"${!` + interpolation + `}"`
+	}
+	return "!" + expr
+}
+
+// Concat returns the values of lists, or of pointers to lists, one after the other.
+func Concat(lists ...interface{}) ([]interface{}, error) {
+	var values []interface{}
+	for _, list := range lists {
+		v := indirect(list)
+		if !v.IsValid() {
+			continue
+		}
+		if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+			return nil, fmt.Errorf("Concat: %T is not a list", list)
+		}
+		for i := 0; i < v.Len(); i++ {
+			values = append(values, v.Index(i).Interface())
+		}
+	}
+	return values, nil
+}
+
+// Merge returns the entries of maps with string keys, or of pointers to maps, in one map.  The
+// value of a key in a later map replaces the value of the same key in an earlier one.
+func Merge(maps ...interface{}) (map[string]interface{}, error) {
+	merged := map[string]interface{}{}
+	for _, m := range maps {
+		v := indirect(m)
+		if !v.IsValid() {
+			continue
+		}
+		if v.Kind() != reflect.Map || v.Type().Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("Merge: %T is not a map with string keys", m)
+		}
+		for _, key := range v.MapKeys() {
+			merged[key.String()] = v.MapIndex(key).Interface()
+		}
+	}
+	return merged, nil
+}
+
+// Default returns value, or defaultValue if value is empty.  Its arguments are in that order so
+// that value can be piped: {{.Spec.Version | Default "latest"}}.
+func Default(defaultValue, value interface{}) interface{} {
+	if isEmpty(value) {
+		return defaultValue
+	}
+	return value
+}
+
+// Coalesce returns the first value that is not empty, or nil.
+func Coalesce(values ...interface{}) interface{} {
+	for _, value := range values {
+		if !isEmpty(value) {
+			return value
+		}
+	}
+	return nil
+}
+
+// CIDRHost returns the address of a host in a range, such as 10.0.0.5 for 10.0.0.0/24 and 5.  A
+// negative host number counts back from the end of the range, so -1 is the last address.
+func CIDRHost(prefix string, hostnum int) (string, error) {
+	_, network, err := net.ParseCIDR(prefix)
+	if err != nil {
+		return "", err
+	}
+	ones, bits := network.Mask.Size()
+	size := new(big.Int).Lsh(big.NewInt(1), uint(bits-ones))
+	host := big.NewInt(int64(hostnum))
+	if hostnum < 0 {
+		host.Add(host, size)
+	}
+	if host.Sign() < 0 || host.Cmp(size) >= 0 {
+		return "", fmt.Errorf("CIDRHost: %s has no host %d", prefix, hostnum)
+	}
+	return addIP(network.IP, host).String(), nil
+}
+
+// CIDRNetmask returns the netmask of an IPv4 range, such as 255.255.240.0 for 10.0.0.0/20.
+func CIDRNetmask(prefix string) (string, error) {
+	_, network, err := net.ParseCIDR(prefix)
+	if err != nil {
+		return "", err
+	}
+	if network.IP.To4() == nil {
+		return "", fmt.Errorf("CIDRNetmask: %s is not an IPv4 range", prefix)
+	}
+	return net.IP(network.Mask).String(), nil
+}
+
+// CIDRSubnet returns the subnet of a range that is newbits longer, with the number netnum, such as
+// 10.0.16.0/20 for 10.0.0.0/16, 4 and 1.
+func CIDRSubnet(prefix string, newbits, netnum int) (string, error) {
+	_, network, err := net.ParseCIDR(prefix)
+	if err != nil {
+		return "", err
+	}
+	ones, bits := network.Mask.Size()
+	if newbits < 0 || ones+newbits > bits {
+		return "", fmt.Errorf("CIDRSubnet: %s can not be extended by %d bits", prefix, newbits)
+	}
+	if netnum < 0 || big.NewInt(int64(netnum)).Cmp(new(big.Int).Lsh(big.NewInt(1), uint(newbits))) >= 0 {
+		return "", fmt.Errorf("CIDRSubnet: %s has no subnet %d of %d more bits", prefix, netnum, newbits)
+	}
+	offset := new(big.Int).Lsh(big.NewInt(int64(netnum)), uint(bits-ones-newbits))
+	subnet := &net.IPNet{IP: addIP(network.IP, offset), Mask: net.CIDRMask(ones+newbits, bits)}
+	return subnet.String(), nil
+}
+
+// ResourceName returns s as the name of a terraform resource, replacing the characters that are
+// not valid in an identifier with _, and starting it with _ if it does not start with a letter.
+func ResourceName(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r == '_' || r == '-' || r < 128 && (r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune('_')
+		}
+	}
+	name := b.String()
+	if name == "" || !(name[0] >= 'a' && name[0] <= 'z' || name[0] >= 'A' && name[0] <= 'Z' || name[0] == '_') {
+		name = "_" + name
+	}
+	return name
+}
+
+// GCPName returns s as the name of a GCP resource: lower case letters, digits and single dashes,
+// starting with a letter and at most 63 characters long.
+func GCPName(s string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(s) {
+		if r < 128 && (r >= 'a' && r <= 'z' || r >= '0' && r <= '9') {
+			if dash && b.Len() > 0 {
+				b.WriteRune('-')
+			}
+			dash = false
+			b.WriteRune(r)
+		} else {
+			dash = true
+		}
+	}
+	name := b.String()
+	if name == "" || name[0] < 'a' || name[0] > 'z' {
+		name = "x" + name
+	}
+	if len(name) > maxGCPNameLength {
+		name = strings.TrimRight(name[:maxGCPNameLength], "-")
+	}
+	return name
+}
+
+// indirect returns the value of v, following pointers.  It is not valid if v is nil or a nil
+// pointer.
+func indirect(v interface{}) reflect.Value {
+	value := reflect.ValueOf(v)
+	for value.IsValid() && value.Kind() == reflect.Ptr {
+		value = value.Elem()
+	}
+	return value
+}
+
+// isEmpty returns true if v is nil, a nil pointer, a zero value or an empty list or map.
+func isEmpty(v interface{}) bool {
+	value := indirect(v)
+	if !value.IsValid() {
+		return true
+	}
+	switch value.Kind() {
+	case reflect.Slice, reflect.Map, reflect.Array, reflect.String:
+		return value.Len() == 0
+	}
+	return value.IsZero()
+}
+
+// addIP returns ip plus n.
+func addIP(ip net.IP, n *big.Int) net.IP {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	sum := new(big.Int).Add(new(big.Int).SetBytes(ip), n).Bytes()
+	result := make(net.IP, len(ip))
+	copy(result[len(result)-len(sum):], sum)
+	return result
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package templates
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// registration is a terraform type of the registry.
+type registration struct {
+	// name is the name of the type, such as Vanilla.
+	name string
+	// newTemplates returns new templates of the type, which the caller may change.
+	newTemplates func() (*GKETemplates, error)
+}
+
+var (
+	// registryLock guards registry.
+	registryLock sync.RWMutex
+	// registry holds the terraform types, indexed by TFType.
+	registry = []*registration{
+		CFT:     {"CFT", newCFTTemplates},
+		VANILLA: {"Vanilla", newVanillaTemplates},
+		BUILDER: {"Builder", newBuilderTemplates},
+	}
+)
+
+// Register adds a terraform type to the registry and returns it.  newTemplates is called by
+// NewGKETemplates, and must return new templates each time, since they may be changed.  The name
+// of the type must not be the name of another one, ignoring case.
+func Register(name string, newTemplates func() (*GKETemplates, error)) (TFType, error) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	if name == "" {
+		return 0, fmt.Errorf("a terraform type must have a name")
+	}
+	for _, r := range registry {
+		if strings.EqualFold(r.name, name) {
+			return 0, fmt.Errorf("the terraform type %s is already registered", r.name)
+		}
+	}
+	registry = append(registry, &registration{name: name, newTemplates: newTemplates})
+	return TFType(len(registry) - 1), nil
+}
+
+// Lookup returns the terraform type with a name, ignoring case, such as vanilla.
+func Lookup(name string) (TFType, bool) {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+	for i, r := range registry {
+		if strings.EqualFold(r.name, name) {
+			return TFType(i), true
+		}
+	}
+	return 0, false
+}
+
+// Types returns the registered terraform types, in the order they were registered.
+func Types() []TFType {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+	types := make([]TFType, len(registry))
+	for i := range registry {
+		types[i] = TFType(i)
+	}
+	return types
+}
+
+// TypeNames returns the names of the registered terraform types, such as "CFT, Vanilla or
+// Builder".
+func TypeNames() string {
+	var names []string
+	for _, tfType := range Types() {
+		names = append(names, tfType.Name())
+	}
+	if len(names) < 2 {
+		return strings.Join(names, "")
+	}
+	return strings.Join(names[:len(names)-1], ", ") + " or " + names[len(names)-1]
+}
+
+// lookupType returns the registration of a type, or nil if it is not registered.
+func lookupType(tfType TFType) *registration {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+	if tfType < 0 || int(tfType) >= len(registry) {
+		return nil
+	}
+	return registry[tfType]
+}
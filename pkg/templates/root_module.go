@@ -0,0 +1,72 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package templates
+
+import (
+	"bytes"
+	"text/template"
+)
+
+// RootModuleFileName is the name of the file that RenderRootModule renders.
+const RootModuleFileName = "main.tf"
+
+// rootModuleTF uses the terraform of each cluster as a module.
+const rootModuleTF = `/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Root module for the clusters generated by gke-tf.  Each cluster is a module
+// in the directory named after it.
+{{- range . }}
+
+module "{{ ResourceName . }}" {
+  source = {{ HCLString (printf "./%s" .) }}
+}
+{{- end }}
+`
+
+// RenderRootModule returns a main.tf that uses the terraform of each cluster, in the
+// subdirectory named after the cluster, as a module.  This allows all of the clusters to be
+// planned and applied together.  The module of a cluster is named with ResourceName, as the
+// example of generator.AsModule names it.
+func RenderRootModule(clusterNames []string) ([]byte, error) {
+	tmpl, err := template.New(RootModuleFileName).Funcs(FuncMap()).Parse(rootModuleTF)
+	if err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, clusterNames); err != nil {
+		return nil, err
+	}
+	if err := checkSyntax(RootModuleFileName, b.Bytes(), nil); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
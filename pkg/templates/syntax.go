@@ -0,0 +1,99 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package templates
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+
+	"github.com/GoogleCloudPlatform/gke-terraform-generator/pkg/api"
+)
+
+// SyntaxError is returned when a template renders terraform that is not valid HCL.
+type SyntaxError struct {
+	// Template is the name of the template, such as main.tf.
+	Template string
+	// Line is the number of the rendered line with the error, and Text is that line.
+	Line int
+	Text string
+	// Message describes the error.
+	Message string
+	// Fields are the YAML paths of the fields whose values are on the line, which are most
+	// likely the input that caused the error.
+	Fields []string
+}
+
+func (e *SyntaxError) Error() string {
+	s := fmt.Sprintf("%s:%d: the rendered terraform is not valid HCL, %s", e.Template, e.Line, e.Message)
+	if text := strings.TrimSpace(e.Text); text != "" {
+		s += "\n    " + text
+	}
+	if len(e.Fields) > 0 {
+		s += fmt.Sprintf("\n    rendered from %s", strings.Join(e.Fields, ", "))
+	}
+	return s
+}
+
+// checkSyntax parses a rendered file with the HCL parser, and returns a *SyntaxError for the
+// first error.  cluster is the input of the template, or nil if it has none.
+func checkSyntax(name string, content []byte, cluster *api.GkeTF) error {
+	_, diags := hclsyntax.ParseConfig(content, name, hcl.Pos{Line: 1, Column: 1})
+	if !diags.HasErrors() {
+		return nil
+	}
+
+	var diag *hcl.Diagnostic
+	for _, d := range diags {
+		if d.Severity == hcl.DiagError {
+			diag = d
+			break
+		}
+	}
+	e := &SyntaxError{
+		Template: name,
+		Message:  strings.TrimSuffix(diag.Summary, ".") + ": " + diag.Detail,
+	}
+	if diag.Subject != nil {
+		e.Line = diag.Subject.Start.Line
+		lines := bytes.Split(content, []byte("\n"))
+		if e.Line > 0 && e.Line <= len(lines) {
+			e.Text = string(lines[e.Line-1])
+		}
+	}
+	if cluster != nil && strings.TrimSpace(e.Text) != "" {
+		e.Fields = fieldsOnLine(e.Text, cluster)
+	}
+	return e
+}
+
+// fieldsOnLine returns the YAML paths of the text fields of cluster whose values are on a
+// rendered line.
+func fieldsOnLine(line string, cluster *api.GkeTF) []string {
+	var fields []string
+	for path, value := range api.StringValues(cluster) {
+		if strings.Contains(line, value) {
+			fields = append(fields, path)
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
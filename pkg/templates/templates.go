@@ -20,36 +20,48 @@ package templates
 // TODO godocs in general
 
 import (
-	"bufio"
+	"bytes"
 	"fmt"
-	"os"
-	"path"
 	"strings"
 	"text/template"
 
-	"k8s.io/klog"
-
 	"github.com/GoogleCloudPlatform/gke-terraform-generator/pkg/api"
+	"github.com/GoogleCloudPlatform/gke-terraform-generator/pkg/backend"
+	"github.com/GoogleCloudPlatform/gke-terraform-generator/pkg/params"
 	"github.com/GoogleCloudPlatform/gke-terraform-generator/pkg/terraform/cft"
+	"github.com/GoogleCloudPlatform/gke-terraform-generator/pkg/terraform/partials"
 	"github.com/GoogleCloudPlatform/gke-terraform-generator/pkg/terraform/vanilla"
 )
 
+// TFType is a type of terraform, which the registry names.  CFT, VANILLA and BUILDER are
+// always registered, and Register adds other types at runtime.
 type TFType int
 
 const (
 	CFT     TFType = 0
 	VANILLA TFType = 1
+	// BUILDER builds the terraform of the Vanilla templates in Go, with the builder package, so
+	// it has no templates.
+	BUILDER TFType = 2
 )
 
+// String returns the name of the type in upper case, such as VANILLA.
 func (templateType TFType) String() string {
-	names := [...]string{
-		"CFT",
-		"VANILLA",
-	}
-	if templateType < CFT || templateType > VANILLA {
+	r := lookupType(templateType)
+	if r == nil {
 		return "Unknown"
 	}
-	return names[templateType]
+	return strings.ToUpper(r.name)
+}
+
+// Name returns the name of the type as it was registered, such as Vanilla, which the -t flag of
+// gen uses.
+func (templateType TFType) Name() string {
+	r := lookupType(templateType)
+	if r == nil {
+		return templateType.String()
+	}
+	return r.name
 }
 
 type TerraformTemplate struct {
@@ -59,98 +71,190 @@ type TerraformTemplate struct {
 
 type GKETemplates struct {
 	Templates []*TerraformTemplate
+	// IgnoredFields are the yaml paths of the api fields that the templates do not use, such as
+	// spec.nodePools.spec.gvisor.  Every other field is supported.
+	IgnoredFields []string
+	// SkipSyntaxCheck renders files without parsing them as HCL.  By default Render returns a
+	// *SyntaxError for a file that is not valid HCL.
+	SkipSyntaxCheck bool
+	// Parameterize renders the fields of the cluster that the templates write with the Var
+	// function as references to variables.  Render then adds the variables, and their values,
+	// as params.VariablesFileName and params.TFVarsFileName.
+	Parameterize bool
+	// Terraform holds the versions of terraform and of the providers that the templates target,
+	// which the spec.terraform of a cluster overrides.  Render executes the templates with the
+	// Terraform and Expr functions of the resulting Target.
+	Terraform api.TerraformSpec
+	// LegacySyntax is true if the templates support the syntax of terraform 0.11, by writing
+	// their expressions with Expr.  Otherwise a cluster whose spec.terraform allows terraform
+	// 0.11 is an error.
+	LegacySyntax bool
+	// Partials only define named templates, such as "taints", that every template can execute.
+	// They are parsed in order before each template, so a later partial replaces the named
+	// templates of an earlier one.
+	Partials []string
 }
 
+// NewGKETemplates returns the templates of a registered terraform type.
 func NewGKETemplates(tfType TFType) (*GKETemplates, error) {
-	switch tfType {
-	case CFT:
-		return &GKETemplates{
-			[]*TerraformTemplate{
-				{
-					"main.tf",
-					cft.GKEMainTF,
-				},
-				{
-					"network.tf",
-					cft.GKENetworkTF,
-				},
-				{
-					"outputs.tf",
-					cft.GKEOutputsTF,
-				},
-				{
-					"variables.tf",
-					cft.GKEVariablesTF,
-				},
-			},
-		}, nil
-	case VANILLA:
-		return &GKETemplates{
-			[]*TerraformTemplate{
-				{
-					"main.tf",
-					vanilla.GKEMainTF,
-				},
-				{
-					"network.tf",
-					vanilla.GKENetworkTF,
-				},
-				{
-					"outputs.tf",
-					vanilla.GKEOutputsTF,
-				},
-				{
-					"variables.tf",
-					vanilla.GKEVariablesTF,
-				},
-			},
-		}, nil
-	default:
+	r := lookupType(tfType)
+	if r == nil {
 		return nil, fmt.Errorf("unable to find terraform type: %s", tfType)
 	}
+	return r.newTemplates()
 }
 
-// CopyTo is used to copy all of the templates in the
-// template directory to the given destination
-func (gkeTemplates *GKETemplates) CopyTo(allowOverwrite bool, dst string, cluster *api.GkeTF) error {
-	return gkeTemplates.processTemplates(allowOverwrite, dst, cluster)
+// newCFTTemplates returns the embedded templates of the CFT type.
+func newCFTTemplates() (*GKETemplates, error) {
+	return &GKETemplates{
+		Templates: []*TerraformTemplate{
+			{
+				"main.tf",
+				cft.GKEMainTF,
+			},
+			{
+				"network.tf",
+				cft.GKENetworkTF,
+			},
+			{
+				"outputs.tf",
+				cft.GKEOutputsTF,
+			},
+			{
+				"variables.tf",
+				cft.GKEVariablesTF,
+			},
+			{
+				"versions.tf",
+				cft.GKEVersionsTF,
+			},
+		},
+		IgnoredFields: cftIgnoredFields,
+		Terraform: api.TerraformSpec{
+			RequiredVersion:    ">= 0.12",
+			GoogleProvider:     "2.7.0",
+			GoogleBetaProvider: "2.7.0",
+		},
+		LegacySyntax: true,
+		Partials:     []string{partials.GKEPartials},
+	}, nil
 }
 
-func (gkeTemplates *GKETemplates) processTemplates(allowOverwrite bool, dst string, cluster *api.GkeTF) error {
-	// TODO refactor to access a bufio.NewWriter interface
-	// TODO need to be able to override file writing in unit tests
+// newVanillaTemplates returns the embedded templates of the Vanilla type.
+func newVanillaTemplates() (*GKETemplates, error) {
+	return &GKETemplates{
+		Templates: []*TerraformTemplate{
+			{
+				"main.tf",
+				vanilla.GKEMainTF,
+			},
+			{
+				"network.tf",
+				vanilla.GKENetworkTF,
+			},
+			{
+				"outputs.tf",
+				vanilla.GKEOutputsTF,
+			},
+			{
+				"variables.tf",
+				vanilla.GKEVariablesTF,
+			},
+			{
+				"versions.tf",
+				vanilla.GKEVersionsTF,
+			},
+		},
+		IgnoredFields: vanillaIgnoredFields,
+		Terraform: api.TerraformSpec{
+			RequiredVersion:    ">= 0.12",
+			GoogleProvider:     "2.13.0",
+			GoogleBetaProvider: "2.13.0",
+		},
+		Partials: []string{partials.GKEPartials},
+	}, nil
+}
 
+// newBuilderTemplates returns the templates of the Builder type, which has none.  Its versions
+// are the builder.DefaultTerraform.
+func newBuilderTemplates() (*GKETemplates, error) {
+	return &GKETemplates{
+		IgnoredFields: builderIgnoredFields,
+	}, nil
+}
+
+// Render executes every template with cluster and returns the terraform files, keyed by
+// file name.  Nothing is written to disk.  Each file is parsed as HCL, unless SkipSyntaxCheck
+// is set, so that a template bug or an input that the templates do not escape is caught before
+// terraform is run.  With Parameterize the variables of the fields and their values are added,
+// and so are the files of spec.backend if it is set.
+func (gkeTemplates *GKETemplates) Render(cluster *api.GkeTF) (map[string][]byte, error) {
+	target, err := NewTarget(cluster, gkeTemplates.Terraform)
+	if err != nil {
+		return nil, err
+	}
+	if err := gkeTemplates.checkTarget(target); err != nil {
+		return nil, err
+	}
+
+	var parameters *params.Parameters
+	if gkeTemplates.Parameterize {
+		if parameters, err = params.New(); err != nil {
+			return nil, err
+		}
+	}
+	funcs := FuncMap()
+	funcs["Var"] = parameters.Var
+	funcs["TFVar"] = parameters.TFVar
+	funcs["Terraform"] = func() *Target { return target }
+	funcs["Expr"] = target.Expr
+	funcs["Ref"] = target.Ref
+
+	files := map[string][]byte{}
 	for _, t := range gkeTemplates.Templates {
-		fileName := path.Join(dst, t.FileName)
-		if !allowOverwrite {
-			if f, err := os.Open(fileName); f != nil && err == nil {
-				return fmt.Errorf("file already exists and overwrites not allowed file: %s", fileName)
+		tmpl := template.New(t.FileName).Funcs(funcs)
+		for _, partial := range gkeTemplates.Partials {
+			if _, err := tmpl.Parse(partial); err != nil {
+				return nil, err
 			}
 		}
-		f, err := os.Create(fileName)
-		if err != nil {
-			return err
+		if _, err := tmpl.Parse(t.GoTemplate); err != nil {
+			return nil, err
 		}
 
-		w := bufio.NewWriter(f)
-
-		tmpl, err := template.New(t.FileName).Funcs(
-			template.FuncMap{"StringsJoin": strings.Join}).Parse(t.GoTemplate)
-		if err != nil {
-			return err
+		var b bytes.Buffer
+		if err := tmpl.Execute(&b, cluster); err != nil {
+			return nil, err
 		}
-
-		if err := tmpl.Execute(w, cluster); err != nil {
-			return err
+		if !gkeTemplates.SkipSyntaxCheck {
+			if err := checkSyntax(t.FileName, b.Bytes(), cluster); err != nil {
+				return nil, err
+			}
 		}
+		files[t.FileName] = b.Bytes()
+	}
 
-		if err := w.Flush(); err != nil {
-			return err
+	if parameters != nil {
+		for fileName, b := range map[string][]byte{
+			params.VariablesFileName: parameters.VariablesFile(),
+			params.TFVarsFileName:    parameters.TFVarsFile(),
+		} {
+			if _, ok := files[fileName]; ok {
+				return nil, fmt.Errorf("%s is rendered by a template, so the terraform can not be parameterized", fileName)
+			}
+			files[fileName] = b
 		}
-		klog.Infof("Created terraform file: %s", t.FileName)
-
 	}
-	klog.Infof("Finished creating terraform files in: %s", dst)
 
-	return nil
+	backendFiles, err := backend.Files(cluster)
+	if err != nil {
+		return nil, err
+	}
+	for fileName, b := range backendFiles {
+		if _, ok := files[fileName]; ok {
+			return nil, fmt.Errorf("%s is rendered by a template, so spec.backend can not be written", fileName)
+		}
+		files[fileName] = b
+	}
+	return files, nil
 }
@@ -17,16 +17,22 @@ limitations under the License.
 package templates
 
 import (
+	"fmt"
 	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
 	"strings"
 	"testing"
 
 	"github.com/GoogleCloudPlatform/gke-terraform-generator/pkg/api"
+	"github.com/GoogleCloudPlatform/gke-terraform-generator/pkg/ipam"
+	"github.com/GoogleCloudPlatform/gke-terraform-generator/pkg/params"
+	"github.com/GoogleCloudPlatform/gke-terraform-generator/pkg/schema"
 	"github.com/GoogleCloudPlatform/gke-terraform-generator/pkg/terraform/cft"
+	"github.com/GoogleCloudPlatform/gke-terraform-generator/pkg/terraform/partials"
 )
 
-// TODO implement https://github.com/hashicorp/hcl/blob/master/decoder_test.go
-
 func TestTemplates(t *testing.T) {
 
 	configFile := "../../examples/public-example.yaml"
@@ -44,11 +50,11 @@ func TestTemplates(t *testing.T) {
 		t.Fatal("gkeTF.Name is empty")
 	}
 
-	if gkeTF.Spec.Private == "true" {
+	if gkeTF.Spec.Private.IsTrue() {
 		t.Fatal("gkeTF.Spec.Private should be false")
 	}
 
-	if err := api.SetApiDefaultValues(gkeTF, configFile); err != nil {
+	if err := api.SetApiDefaultValues(gkeTF); err != nil {
 		t.Fatalf("error merging defaults: %v", gkeTF)
 	}
 
@@ -57,16 +63,12 @@ func TestTemplates(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	err = testTemplates.CopyTo(false, ".", gkeTF)
-
+	files, err := testTemplates.Render(gkeTF)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	b, err := ioutil.ReadFile("main.tf")
-	if err != nil {
-		t.Fatal(err)
-	}
+	b := files["main.tf"]
 
 	s := string(b)
 
@@ -96,29 +98,28 @@ func TestPrivateTemplate(t *testing.T) {
 		t.Fatal("gkeTF.Name is empty")
 	}
 
-	if gkeTF.Spec.Private == "false" {
+	if !gkeTF.Spec.Private.IsTrue() {
 		t.Fatal("gkeTF.Spec.Private should be true")
 	}
 
-	if err := api.SetApiDefaultValues(gkeTF, configFile); err != nil {
+	if err := api.SetApiDefaultValues(gkeTF); err != nil {
 		t.Fatalf("error merging defaults: %v", gkeTF)
 	}
 
+	// a label key that is not an identifier, as the labels of kubernetes often are
+	(*gkeTF.Spec.Labels)["app.kubernetes.io/team"] = "infra"
+
 	testTemplates, err := NewGKETemplates(CFT)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	err = testTemplates.CopyTo(true, ".", gkeTF)
-
+	files, err := testTemplates.Render(gkeTF)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	b, err := ioutil.ReadFile("main.tf")
-	if err != nil {
-		t.Fatal(err)
-	}
+	b := files["main.tf"]
 
 	s := string(b)
 
@@ -128,9 +129,25 @@ func TestPrivateTemplate(t *testing.T) {
 		t.Log(cft.GKEMainTF)
 		t.Fatalf("template does not contain the private source provider")
 	}
+
+	// the label key is quoted, or terraform would read it as an expression
+	label := `"app.kubernetes.io/team" = "infra"`
+	if !strings.Contains(s, label) {
+		t.Errorf("expected %s in the CFT main.tf:\n%s", label, s)
+	}
+	vanillaTemplates, err := NewGKETemplates(VANILLA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err = vanillaTemplates.Render(gkeTF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(files["main.tf"]), label) {
+		t.Errorf("expected %s in the Vanilla main.tf:\n%s", label, files["main.tf"])
+	}
 }
 
-// TODO test all yaml files
 func TestFullTemplate(t *testing.T) {
 
 	configFile := "../../examples/full.yaml"
@@ -148,11 +165,11 @@ func TestFullTemplate(t *testing.T) {
 		t.Fatal("gkeTF.Name is empty")
 	}
 
-	if gkeTF.Spec.Private == "false" {
+	if !gkeTF.Spec.Private.IsTrue() {
 		t.Fatal("gkeTF.Spec.Private should be true")
 	}
 
-	if err := api.SetApiDefaultValues(gkeTF, configFile); err != nil {
+	if err := api.SetApiDefaultValues(gkeTF); err != nil {
 		t.Fatalf("error merging defaults: %v", gkeTF)
 	}
 
@@ -161,16 +178,12 @@ func TestFullTemplate(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	err = testTemplates.CopyTo(true, ".", gkeTF)
-
+	files, err := testTemplates.Render(gkeTF)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	b, err := ioutil.ReadFile("network.tf")
-	if err != nil {
-		t.Fatal(err)
-	}
+	b := files["network.tf"]
 
 	s := string(b)
 
@@ -186,3 +199,836 @@ func TestFullTemplate(t *testing.T) {
 		t.Fatalf("template does not contain the defined instnace zone for the bastion")
 	}
 }
+
+func TestExistingNetworkTemplate(t *testing.T) {
+
+	configFile := "../../examples/shared-vpc-example.yaml"
+	gkeTF, err := api.UnmarshalGkeTF(configFile)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if gkeTF.Spec.Network.Spec.Existing == nil {
+		t.Fatal("gkeTF.Spec.Network.Spec.Existing should be set")
+	}
+
+	if err := api.SetApiDefaultValues(gkeTF); err != nil {
+		t.Fatalf("error merging defaults: %v", gkeTF)
+	}
+
+	testTemplates, err := NewGKETemplates(VANILLA)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := testTemplates.Render(gkeTF)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := files["network.tf"]
+
+	s := string(b)
+
+	if strings.Contains(s, "resource \"google_compute_network\"") || strings.Contains(s, "resource \"google_compute_router_nat\"") {
+		t.Log(s)
+		t.Fatalf("template should not create network resources for an existing network")
+	}
+
+	for _, expected := range []string{
+		"data \"google_compute_subnetwork\" \"subnetwork\"",
+		"role       = \"roles/compute.networkUser\"",
+		"role    = \"roles/container.hostServiceAgentUser\"",
+	} {
+		if !strings.Contains(s, expected) {
+			t.Log(s)
+			t.Fatalf("template does not contain %s", expected)
+		}
+	}
+
+	b = files["main.tf"]
+
+	s = string(b)
+
+	podRange := "cluster_secondary_range_name  = \"gke-pods\""
+	if !strings.Contains(s, podRange) {
+		t.Log(s)
+		t.Fatalf("template does not contain the existing pod range name")
+	}
+}
+
+func TestRootModule(t *testing.T) {
+	b, err := RenderRootModule([]string{"dev-cluster", "prod-cluster", "1st.cluster"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := string(b)
+
+	for name, label := range map[string]string{"dev-cluster": "dev-cluster", "prod-cluster": "prod-cluster", "1st.cluster": "_1st_cluster"} {
+		module := "module \"" + label + "\" {\n  source = \"./" + name + "\"\n}"
+		if !strings.Contains(s, module) {
+			t.Log(s)
+			t.Fatalf("root module does not contain the %s module", name)
+		}
+	}
+}
+
+// TestEscapedInput checks that the text of the user is written as HCL strings, which terraform
+// does not interpolate.
+func TestEscapedInput(t *testing.T) {
+	gkeTF, err := api.UnmarshalGkeTF("../../examples/example.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := api.SetApiDefaultValues(gkeTF); err != nil {
+		t.Fatal(err)
+	}
+	cidrBlock, displayName := "10.0.0.0/8", `office "${var.project_id}"`
+	gkeTF.Spec.MasterAuthorizedNetworksConfig = &[]api.MasterAuthorizedNetworksConfigSpec{{CidrBlock: &cidrBlock, DisplayName: &displayName}}
+
+	for _, tfType := range []TFType{CFT, VANILLA} {
+		gkeTemplates, err := NewGKETemplates(tfType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files, err := gkeTemplates.Render(gkeTF)
+		if err != nil {
+			t.Fatalf("%s: %v", tfType, err)
+		}
+		expected := `display_name = "office \"$${var.project_id}\""`
+		if !strings.Contains(string(files["main.tf"]), expected) {
+			t.Errorf("%s: expected %s in main.tf:\n%s", tfType, expected, files["main.tf"])
+		}
+	}
+}
+
+func TestSupports(t *testing.T) {
+	tests := []struct {
+		tfType    TFType
+		path      string
+		supported bool
+	}{
+		{CFT, "spec.nodePools.spec.imageType", true},
+		{CFT, "spec.nodePools.spec.gvisor", false},
+		{CFT, "spec.workloadIdentityConfig.identityNamespace", false},
+		{CFT, "spec.workloadIdentity", true},
+		{VANILLA, "spec.nodePools.spec.gvisor", true},
+		{VANILLA, "spec.stubDomains", false},
+		{VANILLA, "", true},
+	}
+	for _, test := range tests {
+		gkeTemplates, err := NewGKETemplates(test.tfType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if supported := gkeTemplates.Supports(test.path); supported != test.supported {
+			t.Errorf("%s %q: expected %v, got %v", test.tfType, test.path, test.supported, supported)
+		}
+	}
+}
+
+// TestIgnoredFieldsExist checks that the ignored fields name api fields, so that a renamed field
+// is not left in the lists.
+func TestIgnoredFieldsExist(t *testing.T) {
+	for _, tfType := range []TFType{CFT, VANILLA} {
+		gkeTemplates, err := NewGKETemplates(tfType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, path := range gkeTemplates.IgnoredFields {
+			if _, err := schema.Explain(path); err != nil {
+				t.Errorf("%s: %v", tfType, err)
+			}
+		}
+	}
+}
+
+func TestIgnoredSetFields(t *testing.T) {
+	gkeTF, err := api.UnmarshalGkeTF("../../examples/test-data.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := api.SetApiDefaultValues(gkeTF); err != nil {
+		t.Fatal(err)
+	}
+
+	gkeTemplates, err := NewGKETemplates(VANILLA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ignored, err := gkeTemplates.IgnoredSetFields(gkeTF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(ignored, ",") != "spec.addons.clusterAutoscaling,spec.stubDomains" {
+		t.Fatalf("unexpected ignored fields %v", ignored)
+	}
+}
+
+// TestExamplesSyntax renders every example with every terraform type, which fails if a file is
+// not valid HCL.
+func TestExamplesSyntax(t *testing.T) {
+	configFiles, err := filepath.Glob("../../examples/*.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, configFile := range configFiles {
+		documents, err := api.UnmarshalDocuments(configFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, document := range documents {
+			gkeTF := document.GkeTF
+			if err := api.SetApiDefaultValues(gkeTF); err != nil {
+				t.Fatal(err)
+			}
+			if err := ipam.FillNetworkSpec(&gkeTF.Spec); err != nil {
+				t.Fatal(err)
+			}
+			for _, tfType := range []TFType{CFT, VANILLA} {
+				gkeTemplates, err := NewGKETemplates(tfType)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := gkeTemplates.Render(gkeTF); err != nil {
+					t.Errorf("%s %s: %v", configFile, tfType, err)
+				}
+			}
+		}
+	}
+}
+
+// TestParameterize checks that the examples render with every field as a variable: every
+// variable that the terraform references is declared, and set by the tfvars.
+func TestParameterize(t *testing.T) {
+	configFiles, err := filepath.Glob("../../examples/*.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reference := regexp.MustCompile(`var\.([a-z0-9_]+)`)
+	declaration := regexp.MustCompile(`(?m)^variable "([a-z0-9_]+)"`)
+	assignment := regexp.MustCompile(`(?m)^([a-z0-9_]+) +=`)
+	for _, configFile := range configFiles {
+		gkeTF, err := api.UnmarshalGkeTF(configFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := api.SetApiDefaultValues(gkeTF); err != nil {
+			t.Fatal(err)
+		}
+		if err := ipam.FillNetworkSpec(&gkeTF.Spec); err != nil {
+			t.Fatal(err)
+		}
+		for _, tfType := range []TFType{CFT, VANILLA} {
+			gkeTemplates, err := NewGKETemplates(tfType)
+			if err != nil {
+				t.Fatal(err)
+			}
+			gkeTemplates.Parameterize = true
+			files, err := gkeTemplates.Render(gkeTF)
+			if err != nil {
+				t.Fatalf("%s %s: %v", configFile, tfType, err)
+			}
+
+			declared := map[string]bool{}
+			referenced := map[string]bool{}
+			for name, b := range files {
+				for _, m := range declaration.FindAllSubmatch(b, -1) {
+					declared[string(m[1])] = true
+				}
+				for _, m := range reference.FindAllSubmatch(b, -1) {
+					referenced[string(m[1])] = true
+				}
+				if name == params.TFVarsFileName {
+					continue
+				}
+				if strings.Contains(string(b), "= \"n1-standard-1\"") {
+					t.Errorf("%s %s: expected the machine type of %s to be a variable", configFile, tfType, name)
+				}
+			}
+			for name := range referenced {
+				if !declared[name] {
+					t.Errorf("%s %s: var.%s is not declared", configFile, tfType, name)
+				}
+			}
+
+			assigned := map[string]bool{}
+			for _, m := range assignment.FindAllSubmatch(files[params.TFVarsFileName], -1) {
+				assigned[string(m[1])] = true
+			}
+			for _, m := range declaration.FindAllSubmatch(files[params.VariablesFileName], -1) {
+				if !assigned[string(m[1])] {
+					t.Errorf("%s %s: %s is not set by %s", configFile, tfType, m[1], params.TFVarsFileName)
+				}
+			}
+			if !assigned["project_id"] || !assigned["cluster_name"] {
+				t.Errorf("%s %s: expected the defaults of variables.tf in %s", configFile, tfType, params.TFVarsFileName)
+			}
+		}
+	}
+}
+
+func TestTerraformTarget(t *testing.T) {
+	gkeTF, err := api.UnmarshalGkeTF("../../examples/example.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := api.SetApiDefaultValues(gkeTF); err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		tfType    TFType
+		terraform *api.TerraformSpec
+		contains  []string
+		excludes  []string
+	}{
+		{
+			tfType:   CFT,
+			contains: []string{`project_id = var.project_id`, `google      = "2.7.0"`},
+			excludes: []string{`"${var.project_id}"`, `version = "2.7.0"`},
+		},
+		{
+			tfType:    CFT,
+			terraform: &api.TerraformSpec{RequiredVersion: "~> 0.11.14"},
+			contains:  []string{`project_id = "${var.project_id}"`, `version = "2.7.0"`, `required_version = "~> 0.11.14"`},
+			excludes:  []string{"required_providers", `= var.`, `= module.`},
+		},
+		{
+			tfType:    VANILLA,
+			terraform: &api.TerraformSpec{GoogleBetaProvider: "~> 3.0"},
+			contains:  []string{`google      = "2.13.0"`, `google-beta = "~> 3.0"`},
+			excludes:  []string{`version = "2.13.0"`},
+		},
+		{
+			tfType:    VANILLA,
+			terraform: &api.TerraformSpec{RequiredVersion: ">= 0.13"},
+			contains:  []string{`source  = "hashicorp/google-beta"`, `version = "2.13.0"`},
+		},
+	} {
+		gkeTF.Spec.Terraform = test.terraform
+		gkeTemplates, err := NewGKETemplates(test.tfType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files, err := gkeTemplates.Render(gkeTF)
+		if err != nil {
+			t.Fatalf("%s %+v: %v", test.tfType, test.terraform, err)
+		}
+		var all []string
+		for _, b := range files {
+			all = append(all, string(b))
+		}
+		s := strings.Join(all, "\n")
+		for _, expected := range test.contains {
+			if !strings.Contains(s, expected) {
+				t.Errorf("%s %+v: expected %q", test.tfType, test.terraform, expected)
+			}
+		}
+		for _, unexpected := range test.excludes {
+			if strings.Contains(s, unexpected) {
+				t.Errorf("%s %+v: did not expect %q", test.tfType, test.terraform, unexpected)
+			}
+		}
+	}
+
+	// the Vanilla templates and the variables of params need the syntax of terraform 0.12
+	gkeTF.Spec.Terraform = &api.TerraformSpec{RequiredVersion: "~> 0.11.14"}
+	gkeTemplates, err := NewGKETemplates(VANILLA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gkeTemplates.Render(gkeTF); err == nil {
+		t.Error("expected an error for the Vanilla templates and terraform 0.11")
+	}
+	if gkeTemplates, err = NewGKETemplates(CFT); err != nil {
+		t.Fatal(err)
+	}
+	gkeTemplates.Parameterize = true
+	if _, err := gkeTemplates.Render(gkeTF); err == nil {
+		t.Error("expected an error for a parameterized cluster and terraform 0.11")
+	}
+}
+
+// TestTargetReferences checks that providers, the resources in depends_on and the types of
+// variables are bare for terraform 0.12 and later, and quoted for terraform 0.11.
+func TestTargetReferences(t *testing.T) {
+	gkeTF, err := api.UnmarshalGkeTF("../../examples/shared-vpc-example.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := api.SetApiDefaultValues(gkeTF); err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		tfType    TFType
+		terraform *api.TerraformSpec
+		contains  []string
+		excludes  []string
+	}{
+		{
+			tfType:   CFT,
+			contains: []string{`provider   = google-beta`},
+			excludes: []string{`provider   = "google-beta"`},
+		},
+		{
+			tfType:    CFT,
+			terraform: &api.TerraformSpec{RequiredVersion: "~> 0.11.14"},
+			contains:  []string{`provider   = "google-beta"`},
+			excludes:  []string{`provider   = google-beta`},
+		},
+		{
+			tfType: VANILLA,
+			contains: []string{
+				`provider = google-beta`,
+				"depends_on = [\n    google_project_service.service,",
+				"google_compute_subnetwork_iam_member.gke-network-user,",
+				`type = list(string)`,
+			},
+			excludes: []string{`= "google-beta"`, `"google_project_service.service"`, `"list"`},
+		},
+	} {
+		gkeTF.Spec.Terraform = test.terraform
+		gkeTemplates, err := NewGKETemplates(test.tfType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files, err := gkeTemplates.Render(gkeTF)
+		if err != nil {
+			t.Fatalf("%s %+v: %v", test.tfType, test.terraform, err)
+		}
+		var all []string
+		for _, b := range files {
+			all = append(all, string(b))
+		}
+		s := strings.Join(all, "\n")
+		for _, expected := range test.contains {
+			if !strings.Contains(s, expected) {
+				t.Errorf("%s %+v: expected %q", test.tfType, test.terraform, expected)
+			}
+		}
+		for _, unexpected := range test.excludes {
+			if strings.Contains(s, unexpected) {
+				t.Errorf("%s %+v: did not expect %q", test.tfType, test.terraform, unexpected)
+			}
+		}
+	}
+}
+
+func TestSyntaxError(t *testing.T) {
+	gkeTF := &api.GkeTF{}
+	gkeTF.Spec.Region = "us-east1"
+	description := "cost center"
+	gkeTF.Spec.Description = &description
+
+	// a template that writes a field as it is, and not as a string
+	gkeTemplates := &GKETemplates{
+		Templates: []*TerraformTemplate{{"main.tf", "region = {{ HCLString .Spec.Region }}\ndescription = {{ .Spec.Description }}\n"}},
+	}
+	_, err := gkeTemplates.Render(gkeTF)
+	syntaxErr, ok := err.(*SyntaxError)
+	if !ok {
+		t.Fatalf("expected a *SyntaxError, got %T: %v", err, err)
+	}
+	if syntaxErr.Template != "main.tf" || syntaxErr.Line != 2 || !strings.Contains(syntaxErr.Text, "cost center") {
+		t.Fatalf("unexpected error %v", syntaxErr)
+	}
+	if strings.Join(syntaxErr.Fields, ",") != "spec.description" {
+		t.Fatalf("unexpected fields %v", syntaxErr.Fields)
+	}
+
+	gkeTemplates.SkipSyntaxCheck = true
+	if _, err := gkeTemplates.Render(gkeTF); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	for name, expected := range map[string]TFType{"cft": CFT, "Vanilla": VANILLA, "BUILDER": BUILDER} {
+		if tfType, ok := Lookup(name); !ok || tfType != expected {
+			t.Errorf("%s: expected %s, got %s", name, expected, tfType)
+		}
+	}
+	if VANILLA.String() != "VANILLA" || VANILLA.Name() != "Vanilla" {
+		t.Errorf("unexpected names %s and %s", VANILLA.String(), VANILLA.Name())
+	}
+	if _, err := Register("vanilla", newVanillaTemplates); err == nil {
+		t.Fatal("expected an error for a name that is already registered")
+	}
+
+	tfType, err := Register("TestRegistry", func() (*GKETemplates, error) {
+		return &GKETemplates{Templates: []*TerraformTemplate{{"main.tf", `// {{.Name}}`}}}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found, ok := Lookup("testregistry"); !ok || found != tfType {
+		t.Fatalf("expected %d, got %d", tfType, found)
+	}
+	if types := Types(); types[len(types)-1] != tfType {
+		t.Fatalf("%s is not in %v", tfType, types)
+	}
+	gkeTemplates, err := NewGKETemplates(tfType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gkeTF := &api.GkeTF{}
+	gkeTF.Name = "my-cluster"
+	files, err := gkeTemplates.Render(gkeTF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(files["main.tf"]) != "// my-cluster" {
+		t.Fatalf("unexpected main.tf %q", files["main.tf"])
+	}
+	if _, err := NewGKETemplates(TFType(len(Types()))); err == nil {
+		t.Fatal("expected an error for a type that is not registered")
+	}
+}
+
+func TestLoadDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gke-tf-templates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	write := func(name, content string) {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("main.tf.tmpl", `// {{.Name}} {{StringsJoin .Spec.Tags ","}}`)
+	write("org.tf.tmpl", `{{template "org"}}`)
+	write("_helpers.tmpl", `{{define "org"}}// org{{end}}`)
+	write("README.md", "not a template")
+
+	base, err := NewGKETemplates(VANILLA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gkeTemplates, err := LoadDir(dir, base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, tmpl := range gkeTemplates.Templates {
+		names = append(names, tmpl.FileName)
+	}
+	if strings.Join(names, ",") != "main.tf,network.tf,outputs.tf,variables.tf,versions.tf,org.tf" {
+		t.Fatalf("unexpected files %v", names)
+	}
+	if gkeTemplates.template("network.tf").GoTemplate != base.template("network.tf").GoTemplate {
+		t.Fatal("network.tf is not the embedded template")
+	}
+	if strings.Join(gkeTemplates.IgnoredFields, ",") != strings.Join(base.IgnoredFields, ",") {
+		t.Fatal("the ignored fields are not those of the base")
+	}
+	if gkeTemplates.Terraform != base.Terraform {
+		t.Fatal("the versions of terraform are not those of the base")
+	}
+	if len(gkeTemplates.Partials) != len(base.Partials)+1 {
+		t.Fatalf("expected the partials of the base and _helpers.tmpl, got %d", len(gkeTemplates.Partials))
+	}
+
+	gkeTF := &api.GkeTF{}
+	gkeTF.Name = "my-cluster"
+	gkeTF.Spec.Tags = &[]string{"a", "b"}
+	gkeTemplates.Templates = []*TerraformTemplate{gkeTemplates.template("main.tf"), gkeTemplates.template("org.tf")}
+	files, err := gkeTemplates.Render(gkeTF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(files["main.tf"]) != "// my-cluster a,b" || string(files["org.tf"]) != "// org" {
+		t.Fatalf("unexpected files %q", files)
+	}
+
+	// the manifest selects and orders the files
+	write(ManifestFileName, "name: Acme\nfiles: [org.tf, main.tf, outputs.tf]\n")
+	gkeTemplates, err = LoadDir(dir, base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names = nil
+	for _, tmpl := range gkeTemplates.Templates {
+		names = append(names, tmpl.FileName)
+	}
+	if strings.Join(names, ",") != "org.tf,main.tf,outputs.tf" {
+		t.Fatalf("unexpected files %v", names)
+	}
+
+	tfType, err := RegisterDir(dir, VANILLA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tfType.Name() != "Acme" {
+		t.Fatalf("expected Acme, got %s", tfType.Name())
+	}
+	if _, err := RegisterDir(dir, BUILDER); err == nil {
+		t.Fatal("expected an error for a type without templates")
+	}
+
+	for _, manifest := range []string{
+		"files: [missing.tf]\n",
+		"files: [main.tf, main.tf]\n",
+		"unknown: field\n",
+	} {
+		write(ManifestFileName, manifest)
+		if _, err := LoadDir(dir, base); err == nil {
+			t.Errorf("expected an error for the manifest %q", manifest)
+		}
+	}
+}
+
+func TestHCLFuncs(t *testing.T) {
+	for s, expected := range map[string]string{
+		"plain":         `"plain"`,
+		`a "quoted" \`:  `"a \"quoted\" \\"`,
+		"${var.x}":      `"$${var.x}"`,
+		"%{if x}":       `"%%{if x}"`,
+		"line\nbreak":   `"line\nbreak"`,
+		"":              `""`,
+		"cost center":   `"cost center"`,
+		"$ and % alone": `"$ and % alone"`,
+	} {
+		if actual := HCLString(s); actual != expected {
+			t.Errorf("HCLString(%q): expected %s, got %s", s, expected, actual)
+		}
+	}
+	for s, expected := range map[string]string{
+		"env":         "env",
+		"cost-center": "cost-center",
+		"cost center": `"cost center"`,
+		"1st":         `"1st"`,
+	} {
+		if actual := HCLKey(s); actual != expected {
+			t.Errorf("HCLKey(%q): expected %s, got %s", s, expected, actual)
+		}
+	}
+
+	tags := []string{"a", "${b}"}
+	for _, test := range []struct {
+		list     interface{}
+		expected string
+	}{
+		{tags, `["a", "$${b}"]`},
+		{&tags, `["a", "$${b}"]`},
+		{(*[]string)(nil), `[]`},
+		{nil, `[]`},
+	} {
+		actual, err := HCLList(test.list)
+		if err != nil || actual != test.expected {
+			t.Errorf("HCLList(%#v): expected %s, got %s, %v", test.list, test.expected, actual, err)
+		}
+	}
+	if _, err := HCLList("a"); err == nil {
+		t.Error("expected an error for HCLList of a string")
+	}
+
+	labels := map[string]string{"team": "gke", "cost center": "42"}
+	for _, test := range []struct {
+		m        interface{}
+		expected string
+	}{
+		{labels, `{"cost center" = "42", team = "gke"}`},
+		{&labels, `{"cost center" = "42", team = "gke"}`},
+		{(*map[string]string)(nil), `{}`},
+	} {
+		actual, err := HCLMap(test.m)
+		if err != nil || actual != test.expected {
+			t.Errorf("HCLMap(%#v): expected %s, got %s, %v", test.m, test.expected, actual, err)
+		}
+	}
+	if _, err := HCLMap(tags); err == nil {
+		t.Error("expected an error for HCLMap of a list")
+	}
+
+	for expr, expected := range map[string]string{
+		"true":                "false",
+		"false":               "true",
+		"var.addons_hpa":      "!var.addons_hpa",
+		`"${var.addons_hpa}"`: `"${!var.addons_hpa}"`,
+		`"${var.a}-${var.b}"`: `!"${var.a}-${var.b}"`,
+	} {
+		if actual := HCLNot(expr); actual != expected {
+			t.Errorf("HCLNot(%s): expected %s, got %s", expr, expected, actual)
+		}
+	}
+}
+
+func TestListAndMapFuncs(t *testing.T) {
+	tags := []string{"b"}
+	values, err := Concat([]string{"a"}, &tags, (*[]string)(nil), nil, []int{1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(values) != "[a b 1]" {
+		t.Errorf("Concat: unexpected %v", values)
+	}
+	if _, err := Concat("a"); err == nil {
+		t.Error("expected an error for Concat of a string")
+	}
+
+	labels := map[string]string{"b": "node", "c": "node"}
+	merged, err := Merge(map[string]string{"a": "cluster", "b": "cluster"}, &labels, (*map[string]string)(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(merged) != "map[a:cluster b:node c:node]" {
+		t.Errorf("Merge: unexpected %v", merged)
+	}
+	if _, err := Merge(map[int]string{1: "a"}); err == nil {
+		t.Error("expected an error for Merge of a map with int keys")
+	}
+}
+
+func TestDefaultFuncs(t *testing.T) {
+	empty := ""
+	version := "1.16"
+	for _, test := range []struct {
+		value    interface{}
+		expected interface{}
+	}{
+		{"", "latest"},
+		{nil, "latest"},
+		{(*string)(nil), "latest"},
+		{&empty, "latest"},
+		{[]string{}, "latest"},
+		{0, "latest"},
+		{"1.16", "1.16"},
+		{&version, &version},
+	} {
+		if actual := Default("latest", test.value); actual != test.expected {
+			t.Errorf("Default(%#v): expected %v, got %v", test.value, test.expected, actual)
+		}
+	}
+
+	if actual := Coalesce("", nil, (*string)(nil), "a", "b"); actual != "a" {
+		t.Errorf("Coalesce: expected a, got %v", actual)
+	}
+	if actual := Coalesce("", nil); actual != nil {
+		t.Errorf("Coalesce: expected nil, got %v", actual)
+	}
+}
+
+func TestCIDRFuncs(t *testing.T) {
+	for _, test := range []struct {
+		prefix   string
+		hostnum  int
+		expected string
+	}{
+		{"10.0.0.0/24", 5, "10.0.0.5"},
+		{"10.0.0.0/24", -1, "10.0.0.255"},
+		{"10.0.1.128/25", 0, "10.0.1.128"},
+		{"10.0.0.0/24", 256, ""},
+		{"10.0.0.0/24", -257, ""},
+		{"fd00::/64", 17, "fd00::11"},
+		{"10.0.0.0", 1, ""},
+	} {
+		actual, err := CIDRHost(test.prefix, test.hostnum)
+		if test.expected == "" {
+			if err == nil {
+				t.Errorf("CIDRHost(%s, %d): expected an error, got %s", test.prefix, test.hostnum, actual)
+			}
+		} else if err != nil || actual != test.expected {
+			t.Errorf("CIDRHost(%s, %d): expected %s, got %s, %v", test.prefix, test.hostnum, test.expected, actual, err)
+		}
+	}
+
+	for prefix, expected := range map[string]string{
+		"10.0.0.0/20": "255.255.240.0",
+		"10.0.0.0/8":  "255.0.0.0",
+		"0.0.0.0/0":   "0.0.0.0",
+		"fd00::/64":   "",
+		"10.0.0.0":    "",
+	} {
+		actual, err := CIDRNetmask(prefix)
+		if expected == "" {
+			if err == nil {
+				t.Errorf("CIDRNetmask(%s): expected an error, got %s", prefix, actual)
+			}
+		} else if err != nil || actual != expected {
+			t.Errorf("CIDRNetmask(%s): expected %s, got %s, %v", prefix, expected, actual, err)
+		}
+	}
+
+	for _, test := range []struct {
+		prefix          string
+		newbits, netnum int
+		expected        string
+	}{
+		{"10.0.0.0/16", 4, 1, "10.0.16.0/20"},
+		{"10.0.0.0/16", 8, 255, "10.0.255.0/24"},
+		{"10.0.0.0/16", 0, 0, "10.0.0.0/16"},
+		{"fd00::/48", 16, 2, "fd00:0:0:2::/64"},
+		{"10.0.0.0/16", 4, 16, ""},
+		{"10.0.0.0/16", 17, 0, ""},
+		{"10.0.0.0/16", -1, 0, ""},
+	} {
+		actual, err := CIDRSubnet(test.prefix, test.newbits, test.netnum)
+		if test.expected == "" {
+			if err == nil {
+				t.Errorf("CIDRSubnet(%s, %d, %d): expected an error, got %s", test.prefix, test.newbits, test.netnum, actual)
+			}
+		} else if err != nil || actual != test.expected {
+			t.Errorf("CIDRSubnet(%s, %d, %d): expected %s, got %s, %v", test.prefix, test.newbits, test.netnum, test.expected, actual, err)
+		}
+	}
+}
+
+func TestNameFuncs(t *testing.T) {
+	for s, expected := range map[string]string{
+		"my-cluster":   "my-cluster",
+		"pool_1":       "pool_1",
+		"my.cluster 2": "my_cluster_2",
+		"1st-pool":     "_1st-pool",
+		"":             "_",
+		"café":         "caf_",
+	} {
+		if actual := ResourceName(s); actual != expected {
+			t.Errorf("ResourceName(%q): expected %s, got %s", s, expected, actual)
+		}
+	}
+
+	for s, expected := range map[string]string{
+		"my-cluster":                   "my-cluster",
+		"My_Cluster  Pool":             "my-cluster-pool",
+		"--edge--":                     "edge",
+		"1st":                          "x1st",
+		"":                             "x",
+		strings.Repeat("a", 70):        strings.Repeat("a", 63),
+		strings.Repeat("a", 62) + "_b": strings.Repeat("a", 62),
+	} {
+		if actual := GCPName(s); actual != expected {
+			t.Errorf("GCPName(%q): expected %s, got %s", s, expected, actual)
+		}
+	}
+}
+
+func TestPartials(t *testing.T) {
+	gkeTemplates := &GKETemplates{
+		Partials: []string{partials.GKEPartials},
+		Templates: []*TerraformTemplate{{"main.tf", `z = {{template "taintList" .Spec.Taints}}
+{{- template "taints" .Spec.Taints}}`}},
+	}
+	gkeTF := &api.GkeTF{}
+	files, err := gkeTemplates.Render(gkeTF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "z = []"
+	if string(files["main.tf"]) != expected {
+		t.Errorf("expected %q for an empty spec, got %q", expected, files["main.tf"])
+	}
+
+	gkeTF.Spec.Taints = &[]api.TaintSpec{{Key: "dedicated", Value: "gpu", Effect: "NO_SCHEDULE"}}
+	files, err = gkeTemplates.Render(gkeTF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{`key    = "dedicated"`, "taint {", `effect = "NO_SCHEDULE"`} {
+		if !strings.Contains(string(files["main.tf"]), s) {
+			t.Errorf("expected %s in %s", s, files["main.tf"])
+		}
+	}
+}
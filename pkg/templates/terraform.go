@@ -0,0 +1,109 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package templates
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/gke-terraform-generator/pkg/api"
+)
+
+// Target is the terraform that the templates render a cluster for: the version constraints of
+// terraform and of the providers, which the Terraform function returns, and the syntax that
+// they select.
+type Target struct {
+	api.TerraformSpec
+	Syntax api.TerraformSyntax
+}
+
+// NewTarget returns the target of a cluster, whose spec.terraform overrides the versions of
+// defaults.  Without a required version, as for templates that set no Terraform, the target has
+// the syntax of terraform 0.12.
+func NewTarget(cluster *api.GkeTF, defaults api.TerraformSpec) (*Target, error) {
+	spec := cluster.Spec.Terraform.WithDefaults(defaults)
+	if spec.RequiredVersion == "" {
+		return &Target{TerraformSpec: *spec, Syntax: api.Terraform012}, nil
+	}
+	syntax, err := spec.Syntax()
+	if err != nil {
+		return nil, err
+	}
+	return &Target{TerraformSpec: *spec, Syntax: syntax}, nil
+}
+
+// Legacy returns true if the target is terraform 0.11, whose expressions are interpolated in
+// strings and whose providers are pinned by their blocks, since it has no required_providers.
+func (t *Target) Legacy() bool {
+	return t != nil && t.Syntax == api.Terraform011
+}
+
+// ProviderSources returns true if the required_providers of the target have a source, from
+// terraform 0.13.
+func (t *Target) ProviderSources() bool {
+	return t != nil && t.Syntax >= api.Terraform013
+}
+
+// Expr returns an HCL expression, such as var.region, in the syntax of the target: as it is, or
+// interpolated in a string for terraform 0.11, "${var.region}".
+func (t *Target) Expr(expr string) string {
+	if t.Legacy() {
+		return `"${` + expr + `}"`
+	}
+	return expr
+}
+
+// Ref returns a reference that terraform does not evaluate, such as the provider of a resource or
+// a resource in depends_on, in the syntax of the target: as it is, or quoted for terraform 0.11,
+// "google-beta".
+func (t *Target) Ref(ref string) string {
+	if t.Legacy() {
+		return `"` + ref + `"`
+	}
+	return ref
+}
+
+// checkTarget returns an error if templates that do not support the terraform 0.11 syntax are
+// rendered for it, or if the cluster is parameterized for it, since the variables of params
+// have types.
+func (gkeTemplates *GKETemplates) checkTarget(target *Target) error {
+	if !target.Legacy() {
+		return nil
+	}
+	if !gkeTemplates.LegacySyntax {
+		return fmt.Errorf("spec.terraform.requiredVersion %q allows terraform %s, but the templates need terraform %s or later",
+			target.RequiredVersion, target.Syntax, api.Terraform012)
+	}
+	if gkeTemplates.Parameterize {
+		return fmt.Errorf("spec.terraform.requiredVersion %q allows terraform %s, but the variables of a parameterized cluster need terraform %s or later",
+			target.RequiredVersion, target.Syntax, api.Terraform012)
+	}
+	return nil
+}
+
+// interpolated returns the expression of a string that only interpolates it, "${var.region}",
+// and true, or else false.
+func interpolated(s string) (string, bool) {
+	if !strings.HasPrefix(s, `"${`) || !strings.HasSuffix(s, `}"`) {
+		return "", false
+	}
+	expr := s[len(`"${`) : len(s)-len(`}"`)]
+	if strings.Contains(expr, "${") {
+		return "", false
+	}
+	return expr, true
+}